@@ -0,0 +1,281 @@
+package my_utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+var (
+	// ErrInvalidBinary 二进制数据格式不合法或被截断
+	ErrInvalidBinary = errors.New("invalid md bitmap binary")
+	// ErrBinaryChecksum 二进制数据校验和不一致
+	ErrBinaryChecksum = errors.New("md bitmap binary checksum mismatch")
+	// ErrUnsupportedBinaryVersion 不支持的二进制格式版本
+	ErrUnsupportedBinaryVersion = errors.New("unsupported md bitmap binary version")
+)
+
+const (
+	binaryMagic   = "MDBM"
+	binaryVersion = 1
+	// 是否包含 schema
+	binaryFlagSchema = 1 << 0
+	// 位数据是否经过 flate 压缩
+	binaryFlagCompressed = 1 << 1
+	binaryFlagMask       = binaryFlagSchema | binaryFlagCompressed
+	// 最短长度：magic + version + flags + 维度个数 + 位数据长度 + 校验和
+	binaryMinLength = len(binaryMagic) + 1 + 1 + 1 + 1 + crc32.Size
+	// flate 的最大压缩比约为 1032:1，解压后长度超过该比例的数据不可能合法
+	binaryMaxFlateRatio = 1032
+)
+
+// MaxBinaryCellCount 反序列化时允许的最大元素个数，防止恶意数据申请过大内存
+//默认 1<<27 个元素，位数据解压后最多 16MB；需要反序列化更大的位图时调大该值
+var MaxBinaryCellCount int64 = 1 << 27
+
+// MarshalBinary 序列化为二进制，实现 encoding.BinaryMarshaler
+/**
+ * @Description 二进制格式（整数均为 uvarint，校验和为小端 uint32）：
+ *   magic "MDBM" | version(1 byte) | flags(1 byte) | 维度个数 | 各维度长度...
+ *   | [schema json 长度 | schema json]  flags 包含 binaryFlagSchema 时存在
+ *   | 位数据长度 | 位数据
+ *   | crc32(IEEE，覆盖之前的全部字节)
+ * 位数据按下标顺序（最后一个维度变化最快）每 8 个元素打包为 1 字节，低位在前，末尾补 0；
+ * 压缩后更小时使用 flate 压缩，flags 包含 binaryFlagCompressed；零值位图返回 ErrLengthListEmpty
+ **/
+func (m *MDBitMap) MarshalBinary() ([]byte, error) {
+	if len(m.lengthList) == 0 {
+		return nil, ErrLengthListEmpty
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(binaryMagic)
+	buffer.WriteByte(binaryVersion)
+	var schemaData []byte
+	flags := byte(0)
+	if m.schema != nil {
+		var err error
+		if schemaData, err = json.Marshal(m.schema); err != nil {
+			return nil, err
+		}
+		flags |= binaryFlagSchema
+	}
+	bitData := m.packBit()
+	compressedData, err := compressBinary(bitData)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressedData) < len(bitData) {
+		bitData = compressedData
+		flags |= binaryFlagCompressed
+	}
+	buffer.WriteByte(flags)
+	writeUvarint(&buffer, uint64(len(m.lengthList)))
+	for _, length := range m.lengthList {
+		writeUvarint(&buffer, uint64(length))
+	}
+	if schemaData != nil {
+		writeUvarint(&buffer, uint64(len(schemaData)))
+		buffer.Write(schemaData)
+	}
+	writeUvarint(&buffer, uint64(len(bitData)))
+	buffer.Write(bitData)
+	checksum := make([]byte, crc32.Size)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(buffer.Bytes()))
+	buffer.Write(checksum)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary 从二进制反序列化，实现 encoding.BinaryUnmarshaler
+/**
+ * @Description 严格校验：magic、版本、未知 flags、校验和、各段长度、元素个数上限 MaxBinaryCellCount、
+ * 位数据长度、补位是否为 0 以及末尾多余字节，任一不合法时返回错误且不修改当前位图
+ **/
+func (m *MDBitMap) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryMinLength {
+		return fmt.Errorf("%w: length %d too short", ErrInvalidBinary, len(data))
+	}
+	if string(data[:len(binaryMagic)]) != binaryMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidBinary)
+	}
+	body := data[:len(data)-crc32.Size]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[len(data)-crc32.Size:]) {
+		return ErrBinaryChecksum
+	}
+	reader := &binaryReader{data: body, offset: len(binaryMagic)}
+	version, err := reader.readByte()
+	if err != nil {
+		return err
+	}
+	if version != binaryVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedBinaryVersion, version)
+	}
+	flags, err := reader.readByte()
+	if err != nil {
+		return err
+	}
+	if flags&^byte(binaryFlagMask) != 0 {
+		return fmt.Errorf("%w: unknown flags %#x", ErrInvalidBinary, flags)
+	}
+	dimensionNum, err := reader.readUvarint()
+	if err != nil {
+		return err
+	}
+	if dimensionNum == 0 || dimensionNum > uint64(len(body)) {
+		return fmt.Errorf("%w: invalid dimension count %d", ErrInvalidBinary, dimensionNum)
+	}
+	lengthList := make([]int64, dimensionNum)
+	cellCount := int64(1)
+	for i := range lengthList {
+		length, err := reader.readUvarint()
+		if err != nil {
+			return err
+		}
+		if length == 0 || length > uint64(MaxBinaryCellCount) || cellCount > MaxBinaryCellCount/int64(length) {
+			return fmt.Errorf("%w: invalid length %d of dimension %d", ErrInvalidBinary, length, i)
+		}
+		lengthList[i] = int64(length)
+		cellCount *= int64(length)
+	}
+	var schema *MDSchema
+	if flags&binaryFlagSchema != 0 {
+		schemaData, err := reader.readBlock()
+		if err != nil {
+			return err
+		}
+		schema = &MDSchema{}
+		if err := json.Unmarshal(schemaData, schema); err != nil {
+			return fmt.Errorf("%w: invalid schema: %v", ErrInvalidBinary, err)
+		}
+	}
+	bitData, err := reader.readBlock()
+	if err != nil {
+		return err
+	}
+	if reader.offset != len(body) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidBinary, len(body)-reader.offset)
+	}
+	packedLength := (cellCount + 7) / 8
+	if flags&binaryFlagCompressed != 0 {
+		if bitData, err = decompressBinary(bitData, packedLength); err != nil {
+			return err
+		}
+	}
+	if int64(len(bitData)) != packedLength {
+		return fmt.Errorf("%w: bit data length %d, expect %d", ErrInvalidBinary, len(bitData), packedLength)
+	}
+	//末尾补位必须为 0
+	if cellCount%8 != 0 && bitData[len(bitData)-1]>>(cellCount%8) != 0 {
+		return fmt.Errorf("%w: non-zero padding bits", ErrInvalidBinary)
+	}
+	finalMDBitMap := MDBitMap{}
+	if err := finalMDBitMap.InitMDBitMap(lengthList, nil); err != nil {
+		return err
+	}
+	if schema != nil {
+		if err := finalMDBitMap.SetSchema(schema); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBinary, err)
+		}
+	}
+	finalMDBitMap.unpackBit(bitData)
+	*m = finalMDBitMap
+	return nil
+}
+
+//按下标顺序将位图打包为字节，低位在前，即位数组的小端字节序
+func (m *MDBitMap) packBit() []byte {
+	bitData := make([]byte, len(m.wordList)*8)
+	for i, word := range m.wordList {
+		binary.LittleEndian.PutUint64(bitData[i*8:], word)
+	}
+	return bitData[:(m.getCellCount()+7)/8]
+}
+
+//将打包的字节按下标顺序写回位图
+func (m *MDBitMap) unpackBit(bitData []byte) {
+	wordData := make([]byte, len(m.wordList)*8)
+	copy(wordData, bitData)
+	for i := range m.wordList {
+		m.wordList[i] = binary.LittleEndian.Uint64(wordData[i*8:])
+	}
+	m.clearPadding()
+}
+
+func compressBinary(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+//解压位数据，解压后长度超过 expectLength 时直接报错，防止解压炸弹
+//按压缩比上限预先拒绝不可能解压到 expectLength 的数据，解压时最多读取 expectLength+1 字节，分配的内存与实际解压长度成正比
+func decompressBinary(data []byte, expectLength int64) ([]byte, error) {
+	if expectLength/binaryMaxFlateRatio > int64(len(data)) {
+		return nil, fmt.Errorf("%w: compressed length %d too short for %d bytes", ErrInvalidBinary, len(data), expectLength)
+	}
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+	result, err := io.ReadAll(io.LimitReader(reader, expectLength+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decompress failed: %v", ErrInvalidBinary, err)
+	}
+	if int64(len(result)) != expectLength {
+		return nil, fmt.Errorf("%w: decompressed length %d, expect %d", ErrInvalidBinary, len(result), expectLength)
+	}
+	return result, nil
+}
+
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	var temp [binary.MaxVarintLen64]byte
+	buffer.Write(temp[:binary.PutUvarint(temp[:], value)])
+}
+
+// binaryReader 按顺序读取二进制数据，越界时返回 ErrInvalidBinary
+type binaryReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *binaryReader) readByte() (byte, error) {
+	if r.offset >= len(r.data) {
+		return 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidBinary)
+	}
+	r.offset++
+	return r.data[r.offset-1], nil
+}
+
+func (r *binaryReader) readUvarint() (uint64, error) {
+	value, n := binary.Uvarint(r.data[r.offset:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: invalid uvarint at offset %d", ErrInvalidBinary, r.offset)
+	}
+	r.offset += n
+	return value, nil
+}
+
+//读取 长度 + 内容 格式的数据块
+func (r *binaryReader) readBlock() ([]byte, error) {
+	length, err := r.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(r.data)-r.offset) || length > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: block length %d exceeds remaining %d bytes", ErrInvalidBinary, length, len(r.data)-r.offset)
+	}
+	r.offset += int(length)
+	return r.data[r.offset-int(length) : r.offset], nil
+}
@@ -0,0 +1,125 @@
+package my_utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+//构造任意内容的二进制数据并补上正确的校验和
+func appendBinaryChecksum(body []byte) []byte {
+	checksum := make([]byte, crc32.Size)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(body))
+	return append(body, checksum...)
+}
+
+func TestUnmarshalBinaryRoundTrip(t *testing.T) {
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG","TH"]}]}]`)
+	data, err := bitMap.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &MDBitMap{}
+	if err := result.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !result.EqualMDBitMap(bitMap) || result.Schema() == nil {
+		t.Fatalf("round trip mismatch")
+	}
+}
+
+func TestMarshalBinaryZeroValue(t *testing.T) {
+	if _, err := (&MDBitMap{}).MarshalBinary(); !errors.Is(err, ErrLengthListEmpty) {
+		t.Fatalf("MarshalBinary zero value error %v", err)
+	}
+}
+
+func TestUnmarshalBinaryCompressionBomb(t *testing.T) {
+	//维度长度合法，但极小的压缩数据不可能解压出 MaxBinaryCellCount/8 字节
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	writer.Write(make([]byte, 1024))
+	writer.Close()
+	var body bytes.Buffer
+	body.WriteString(binaryMagic)
+	body.Write([]byte{binaryVersion, binaryFlagCompressed})
+	writeUvarint(&body, 1)
+	writeUvarint(&body, uint64(MaxBinaryCellCount))
+	writeUvarint(&body, uint64(compressed.Len()))
+	body.Write(compressed.Bytes())
+	err := (&MDBitMap{}).UnmarshalBinary(appendBinaryChecksum(body.Bytes()))
+	if !errors.Is(err, ErrInvalidBinary) {
+		t.Fatalf("expect ErrInvalidBinary, got %v", err)
+	}
+
+	//元素个数超过上限
+	body.Reset()
+	body.WriteString(binaryMagic)
+	body.Write([]byte{binaryVersion, 0})
+	writeUvarint(&body, 1)
+	writeUvarint(&body, uint64(MaxBinaryCellCount)+1)
+	writeUvarint(&body, 0)
+	err = (&MDBitMap{}).UnmarshalBinary(appendBinaryChecksum(body.Bytes()))
+	if !errors.Is(err, ErrInvalidBinary) {
+		t.Fatalf("expect ErrInvalidBinary, got %v", err)
+	}
+}
+
+func FuzzUnmarshalBinary(f *testing.F) {
+	schema := newTestSchema(f)
+	for _, ruleJSON := range []string{
+		`[]`,
+		`[{"condition_list":[]}]`,
+		`[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[1000]}]}]`,
+	} {
+		bitMap := compileTestRuleList(f, schema, ruleJSON)
+		data, err := bitMap.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+		bitMap.SetSchema(nil)
+		if data, err = bitMap.MarshalBinary(); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	//压缩的大位图
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{64, 64, 8}, nil); err != nil {
+		f.Fatal(err)
+	}
+	if err := bitMap.SetBox([][]int64{{1, 2}, nil, {3}}); err != nil {
+		f.Fatal(err)
+	}
+	data, err := bitMap.MarshalBinary()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	f.Add([]byte(binaryMagic))
+	f.Add(appendBinaryChecksum([]byte{'M', 'D', 'B', 'M', binaryVersion, binaryFlagCompressed, 1, 0xff, 0xff, 0x7f, 1, 0}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bitMap := &MDBitMap{}
+		if err := bitMap.UnmarshalBinary(data); err != nil {
+			return
+		}
+		//合法数据重新序列化后结果一致
+		marshalData, err := bitMap.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &MDBitMap{}
+		if err := result.UnmarshalBinary(marshalData); err != nil {
+			t.Fatal(err)
+		}
+		if !result.EqualMDBitMap(bitMap) {
+			t.Fatalf("round trip mismatch")
+		}
+	})
+}
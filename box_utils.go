@@ -0,0 +1,121 @@
+package my_utils
+
+import "context"
+
+// SetBox 将盒子覆盖的元素设置为 true
+/**
+ * @Description 盒子为各维度槽位列表，nil 表示该维度全部槽位，盒子覆盖的元素为各维度槽位的笛卡尔积
+ * 直接按平铺偏移量填充，不会枚举下标列表：末尾连续的 nil 维度合并为一段连续的位，按 uint64 整段写入
+ * 盒子维度个数与位图不一致返回 *InconsistentLengthError，槽位越界返回 *IndexOutOfRangeError，两者的 IndexList 均为空；
+ * 出错时位图不做修改
+ * @e.g.
+	lengthList: [3,4], box: [[0,2], nil]
+	0 => 1 1 1 1
+	1 => 0 0 0 0
+	2 => 1 1 1 1
+ **/
+func (m *MDBitMap) SetBox(box [][]int64) error {
+	return m.fillBox(context.Background(), box, true)
+}
+
+// ClearBox 将盒子覆盖的元素设置为 false，盒子格式同 SetBox
+func (m *MDBitMap) ClearBox(box [][]int64) error {
+	return m.fillBox(context.Background(), box, false)
+}
+
+//每写入 boxCheckBlockNum 段连续的位检查一次 ctx
+const boxCheckBlockNum = 1024
+
+//填充盒子，ctx 取消时停止并返回 ctx.Err()，此时位图已被部分修改
+func (m *MDBitMap) fillBox(ctx context.Context, box [][]int64, value bool) error {
+	if err := m.checkBox(box); err != nil {
+		return err
+	}
+	//末尾全为 nil 的维度合并为一段连续的位，长度为上一个维度的步长
+	blockDepth := len(box)
+	for blockDepth > 0 && box[blockDepth-1] == nil {
+		blockDepth--
+	}
+	blockLength := m.getCellCount()
+	if blockDepth > 0 {
+		blockLength = m.strideList[blockDepth-1]
+	}
+	filler := &boxFiller{ctx: ctx, bitMap: m, box: box, blockDepth: blockDepth, blockLength: blockLength, value: value}
+	return filler.fillBlock(0, 0)
+}
+
+// boxFiller 填充单个盒子的参数
+type boxFiller struct {
+	ctx         context.Context
+	bitMap      *MDBitMap
+	box         [][]int64
+	blockDepth  int
+	blockLength int64
+	value       bool
+	// 已写入的段数
+	blockNum int64
+}
+
+//按维度递归，depth 到达 blockDepth 时写入以 offset 开始的一段连续的位
+func (f *boxFiller) fillBlock(depth int, offset int64) error {
+	m := f.bitMap
+	if depth == f.blockDepth {
+		if f.blockNum++; f.blockNum%boxCheckBlockNum == 0 {
+			if err := f.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		m.fillBitRange(offset, offset+f.blockLength, f.value)
+		return nil
+	}
+	if f.box[depth] == nil {
+		for slot := int64(0); slot < m.lengthList[depth]; slot++ {
+			if err := f.fillBlock(depth+1, offset+slot*m.strideList[depth]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, slot := range f.box[depth] {
+		if err := f.fillBlock(depth+1, offset+slot*m.strideList[depth]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//将 [startOffset, endOffset) 的位设置为 value
+func (m *MDBitMap) fillBitRange(startOffset int64, endOffset int64, value bool) {
+	for startOffset < endOffset {
+		wordIndex, bitIndex := startOffset>>6, uint64(startOffset)&63
+		bitNum := uint64(64) - bitIndex
+		if remainNum := uint64(endOffset - startOffset); remainNum < bitNum {
+			bitNum = remainNum
+		}
+		mask := ^uint64(0)
+		if bitNum < 64 {
+			mask = (1<<bitNum - 1) << bitIndex
+		}
+		if value {
+			m.wordList[wordIndex] |= mask
+		} else {
+			m.wordList[wordIndex] &^= mask
+		}
+		startOffset += int64(bitNum)
+	}
+}
+
+//校验盒子维度个数及槽位范围
+func (m *MDBitMap) checkBox(box [][]int64) error {
+	if len(box) != len(m.lengthList) {
+		return &InconsistentLengthError{DimensionNum: len(m.lengthList)}
+	}
+	for i, slotList := range box {
+		for _, slot := range slotList {
+			if slot < 0 || slot >= m.lengthList[i] {
+				return &IndexOutOfRangeError{Dimension: i, Index: slot, Length: m.lengthList[i]}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package my_utils
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+//随机盒子与逐个元素设置的结果一致
+func TestSetBoxClearBox(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iteration := 0; iteration < 300; iteration++ {
+		lengthList := make([]int64, 1+r.Intn(4))
+		for i := range lengthList {
+			lengthList[i] = int64(1 + r.Intn(9))
+		}
+		bitMap := newRandomMDBitMap(t, r, lengthList)
+		expectBitMap := bitMap.CopyMDBitMap()
+		for k := 0; k < 4; k++ {
+			box := make([][]int64, len(lengthList))
+			for i := range box {
+				if r.Intn(3) == 0 {
+					continue
+				}
+				box[i] = []int64{}
+				for slot := int64(0); slot < lengthList[i]; slot++ {
+					if r.Intn(2) == 0 {
+						box[i] = append(box[i], slot)
+					}
+				}
+			}
+			value := r.Intn(2) == 0
+			fill := bitMap.ClearBox
+			if value {
+				fill = bitMap.SetBox
+			}
+			if err := fill(box); err != nil {
+				t.Fatal(err)
+			}
+			cursor := expectBitMap.Cursor()
+			for cursor.Next() {
+				if isInBox(box, cursor.IndexList()) {
+					expectBitMap.setValue(cursor.IndexList(), value)
+				}
+			}
+			if !bitMap.EqualMDBitMap(expectBitMap) {
+				t.Fatalf("lengthList %v box %v value %v mismatch", lengthList, box, value)
+			}
+		}
+	}
+}
+
+func TestSetBoxError(t *testing.T) {
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{3, 4}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var lengthError *InconsistentLengthError
+	if err := bitMap.SetBox([][]int64{nil}); !errors.As(err, &lengthError) || lengthError.DimensionNum != 2 {
+		t.Errorf("SetBox error %v, want *InconsistentLengthError", err)
+	}
+	var rangeError *IndexOutOfRangeError
+	err := bitMap.SetBox([][]int64{{0}, {1, 4}})
+	if !errors.As(err, &rangeError) || rangeError.Dimension != 1 || rangeError.Index != 4 || rangeError.Length != 4 {
+		t.Errorf("SetBox error %v, want *IndexOutOfRangeError", err)
+	}
+	if bitMap.CountMDBitMap() != 0 {
+		t.Error("bitmap should not be modified on error")
+	}
+}
+
+func isInBox(box [][]int64, indexList []int64) bool {
+	for i, slotList := range box {
+		if slotList == nil {
+			continue
+		}
+		found := false
+		for _, slot := range slotList {
+			found = found || slot == indexList[i]
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+package my_utils
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PolicyCacheOption 策略缓存配置，两个上限同时生效，<=0 表示不限制
+type PolicyCacheOption struct {
+	// 最多缓存的位图个数
+	MaxEntryNum int
+	// 缓存位图的估算内存上限（字节），见 getMemoryBytes；单个位图超过上限时不缓存
+	MaxMemoryBytes int64
+	// 未命中缓存时的编译选项，nil 时元素个数上限为 DefaultCompileMaxCellNum，见 CompileMDBitMapWithOption
+	CompileOption *CompileOption
+}
+
+// PolicyCacheStats 策略缓存统计
+type PolicyCacheStats struct {
+	// 命中缓存的次数
+	HitCount int64 `json:"hit_count"`
+	// 未命中缓存、实际编译的次数
+	MissCount int64 `json:"miss_count"`
+	// 未命中缓存，但与正在进行的相同编译合并、共享其结果的次数
+	SharedCount int64 `json:"shared_count"`
+	// 因超过上限被淘汰的位图个数
+	EvictionCount int64 `json:"eviction_count"`
+	// 当前缓存的位图个数及估算内存
+	EntryNum    int64 `json:"entry_num"`
+	MemoryBytes int64 `json:"memory_bytes"`
+}
+
+// PolicyCache 编译结果缓存，避免每个请求都将相同的规则编译为 MDBitMap
+/**
+ * @Description key 为规则列表归一化后与 schema 版本号的 sha256，见 GetPolicyCacheKey
+ * 按 LRU 淘汰，同时限制个数及估算内存；相同 key 的并发编译只执行一次，其余调用等待并共享结果；编译失败的结果不缓存
+ * 返回的位图被所有调用方共享，只读，需要修改时先调用 CopyMDBitMap
+ * 并发安全
+ **/
+type PolicyCache struct {
+	option PolicyCacheOption
+	mutex  sync.Mutex
+	// 最近使用的在前，元素为 *policyCacheEntry
+	entryList *list.List
+	entryMap  map[string]*list.Element
+	// 正在进行的编译
+	callMap map[string]*policyCacheCall
+	stats   PolicyCacheStats
+}
+
+type policyCacheEntry struct {
+	key         string
+	bitMap      *MDBitMap
+	memoryBytes int64
+}
+
+// policyCacheCall 正在进行的编译，done 关闭后 bitMap / err 可读
+type policyCacheCall struct {
+	done   chan struct{}
+	bitMap *MDBitMap
+	err    error
+}
+
+// InitPolicyCache 构造方法，option 可为 nil，表示不限制
+func InitPolicyCache(option *PolicyCacheOption) *PolicyCache {
+	cache := &PolicyCache{
+		entryList: list.New(),
+		entryMap:  make(map[string]*list.Element),
+		callMap:   make(map[string]*policyCacheCall),
+	}
+	if option != nil {
+		cache.option = *option
+	}
+	return cache
+}
+
+// GetOrCompile 获取规则列表编译后的位图，未命中缓存时调用 CompileMDBitMap 编译并缓存
+func (c *PolicyCache) GetOrCompile(schema *MDSchema, ruleList []*MDRule) (*MDBitMap, error) {
+	key, err := GetPolicyCacheKey(schema, ruleList)
+	if err != nil {
+		return nil, err
+	}
+	return c.getOrCreate(key, func() (*MDBitMap, error) {
+		//编译结果由多个调用方共享，不使用单个调用方的 context
+		return CompileMDBitMapWithOption(context.Background(), schema, ruleList, c.option.CompileOption)
+	})
+}
+
+//获取 key 对应的位图，未命中缓存时调用 create 生成并缓存；相同 key 的并发调用只执行一次 create
+func (c *PolicyCache) getOrCreate(key string, create func() (*MDBitMap, error)) (*MDBitMap, error) {
+	c.mutex.Lock()
+	if element, ok := c.entryMap[key]; ok {
+		c.entryList.MoveToFront(element)
+		c.stats.HitCount++
+		c.mutex.Unlock()
+		return element.Value.(*policyCacheEntry).bitMap, nil
+	}
+	if call, ok := c.callMap[key]; ok {
+		c.stats.SharedCount++
+		c.mutex.Unlock()
+		<-call.done
+		return call.bitMap, call.err
+	}
+	call := &policyCacheCall{done: make(chan struct{})}
+	c.callMap[key] = call
+	c.stats.MissCount++
+	c.mutex.Unlock()
+
+	//编译 panic 时也要唤醒等待的调用方
+	defer func() {
+		c.mutex.Lock()
+		delete(c.callMap, key)
+		if call.err == nil && call.bitMap != nil {
+			c.add(key, call.bitMap)
+		}
+		c.mutex.Unlock()
+		close(call.done)
+	}()
+	//编译 panic 时等待的调用方得到该错误
+	call.err = fmt.Errorf("%w: compile panicked", ErrInvalidCondition)
+	call.bitMap, call.err = create()
+	return call.bitMap, call.err
+}
+
+// Remove 删除 key 对应的缓存
+func (c *PolicyCache) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entryMap[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Purge 清空缓存，统计计数保留
+func (c *PolicyCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entryList.Init()
+	c.entryMap = make(map[string]*list.Element)
+	c.stats.EntryNum = 0
+	c.stats.MemoryBytes = 0
+}
+
+// Stats 返回统计信息
+func (c *PolicyCache) Stats() PolicyCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stats
+}
+
+//加入缓存并按上限淘汰，调用方需持有锁
+func (c *PolicyCache) add(key string, bitMap *MDBitMap) {
+	memoryBytes := bitMap.getMemoryBytes()
+	if c.option.MaxMemoryBytes > 0 && memoryBytes > c.option.MaxMemoryBytes {
+		return
+	}
+	c.entryMap[key] = c.entryList.PushFront(&policyCacheEntry{key: key, bitMap: bitMap, memoryBytes: memoryBytes})
+	c.stats.EntryNum++
+	c.stats.MemoryBytes += memoryBytes
+	for (c.option.MaxEntryNum > 0 && c.stats.EntryNum > int64(c.option.MaxEntryNum)) ||
+		(c.option.MaxMemoryBytes > 0 && c.stats.MemoryBytes > c.option.MaxMemoryBytes) {
+		c.remove(c.entryList.Back())
+		c.stats.EvictionCount++
+	}
+}
+
+//删除缓存，调用方需持有锁
+func (c *PolicyCache) remove(element *list.Element) {
+	entry := c.entryList.Remove(element).(*policyCacheEntry)
+	delete(c.entryMap, entry.key)
+	c.stats.EntryNum--
+	c.stats.MemoryBytes -= entry.memoryBytes
+}
+
+// GetPolicyCacheKey 计算规则列表在 schema 下的缓存 key
+/**
+ * @Description 规则列表先归一化：运算符空值视为 in，条件内取值及区间、规则内条件、规则之间均排序去重，
+ * 数值取值按 normalizeValue 归一化（整数保持精确），因此语义相同、仅顺序或数值类型不同的规则列表 key 相同；再与 schema 版本号一起计算 sha256
+ **/
+func GetPolicyCacheKey(schema *MDSchema, ruleList []*MDRule) (string, error) {
+	version, err := schema.Version()
+	if err != nil {
+		return "", err
+	}
+	ruleKeyList := make([]string, 0, len(ruleList))
+	for _, rule := range ruleList {
+		ruleKey, err := getNormalizedRuleKey(rule)
+		if err != nil {
+			return "", err
+		}
+		ruleKeyList = append(ruleKeyList, ruleKey)
+	}
+	ruleKeyList = sortUniqueStringList(ruleKeyList)
+	data, err := json.Marshal(ruleKeyList)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(version))
+	hash.Write([]byte{'\n'})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// normalizedCondition 归一化后的条件
+type normalizedCondition struct {
+	Function     string   `json:"function"`
+	Operator     string   `json:"operator"`
+	ValueList    []string `json:"value_list"`
+	IntervalList []string `json:"interval_list"`
+}
+
+//归一化 key 中 OtherValue 的标记，其他取值均为合法 json，不会与之相同
+const otherValueKey = "<other>"
+
+//规则归一化后的 json
+func getNormalizedRuleKey(rule *MDRule) (string, error) {
+	if rule == nil {
+		return "", fmt.Errorf("%w: rule is null", ErrInvalidCondition)
+	}
+	conditionKeyList := make([]string, 0, len(rule.ConditionList))
+	for _, condition := range rule.ConditionList {
+		if condition == nil {
+			return "", fmt.Errorf("%w: condition is null", ErrInvalidCondition)
+		}
+		normalized := normalizedCondition{
+			Function:     condition.Function,
+			Operator:     condition.Operator,
+			ValueList:    make([]string, 0, len(condition.ValueList)),
+			IntervalList: make([]string, 0, len(condition.IntervalList)),
+		}
+		if normalized.Operator == "" {
+			normalized.Operator = OperatorIn
+		}
+		for _, value := range condition.ValueList {
+			//OtherValue 序列化为 "<other>"，与同名字符串区分，使用不是合法 json 的标记
+			if _, ok := value.(otherValue); ok {
+				normalized.ValueList = append(normalized.ValueList, otherValueKey)
+				continue
+			}
+			data, err := json.Marshal(normalizeValue(value))
+			if err != nil {
+				return "", err
+			}
+			normalized.ValueList = append(normalized.ValueList, string(data))
+		}
+		for _, interval := range condition.IntervalList {
+			if interval == nil {
+				return "", fmt.Errorf("%w: interval is null", ErrInvalidCondition)
+			}
+			normalized.IntervalList = append(normalized.IntervalList, interval.String())
+		}
+		normalized.ValueList = sortUniqueStringList(normalized.ValueList)
+		normalized.IntervalList = sortUniqueStringList(normalized.IntervalList)
+		data, err := json.Marshal(normalized)
+		if err != nil {
+			return "", err
+		}
+		conditionKeyList = append(conditionKeyList, string(data))
+	}
+	data, err := json.Marshal(sortUniqueStringList(conditionKeyList))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+//排序并去重
+func sortUniqueStringList(stringList []string) []string {
+	sort.Strings(stringList)
+	result := stringList[:0]
+	for _, str := range stringList {
+		if len(result) == 0 || str != result[len(result)-1] {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
+//估算位图占用的内存（字节）：位数组及 lengthList、strideList 三个 slice
+func (m *MDBitMap) getMemoryBytes() int64 {
+	const sliceBytes = 24
+	return 3*sliceBytes + int64(len(m.wordList))*8 + int64(len(m.lengthList)+len(m.strideList))*8
+}
@@ -0,0 +1,181 @@
+package my_utils
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestGetNormalizedRuleKey(t *testing.T) {
+	getKey := func(valueList ...interface{}) string {
+		key, err := getNormalizedRuleKey(&MDRule{ConditionList: []*MDCondition{{Function: "country", ValueList: valueList}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	if getKey("SG", "MY") != getKey("MY", "SG", "MY") {
+		t.Error("value order and duplicates should not change the key")
+	}
+	if getKey(1) != getKey(1.0) || getKey(int64(1)) != getKey(float32(1)) {
+		t.Error("numeric types should share the key")
+	}
+	if getKey(OtherValue) == getKey("<other>") {
+		t.Error("OtherValue should not collide with the literal string <other>")
+	}
+	if getKey(OtherValue, "SG") != getKey("SG", OtherValue) {
+		t.Error("OtherValue order should not change the key")
+	}
+	if getKey(uint64(1<<53+1)) == getKey(int64(1<<53)) {
+		t.Error("integers above 2^53 should not share the key")
+	}
+}
+
+func newTestCacheBitMap(t *testing.T, length int64) *MDBitMap {
+	t.Helper()
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{length}, [][]int64{{0}}); err != nil {
+		t.Fatal(err)
+	}
+	return bitMap
+}
+
+//从缓存获取 key，未命中时生成 bitMap，返回是否调用了生成方法
+func getTestCache(t *testing.T, cache *PolicyCache, key string, bitMap *MDBitMap) bool {
+	t.Helper()
+	created := false
+	result, err := cache.getOrCreate(key, func() (*MDBitMap, error) {
+		created = true
+		return bitMap, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created && result != bitMap {
+		t.Fatalf("key %s: created bitmap not returned", key)
+	}
+	return created
+}
+
+func TestPolicyCacheLRU(t *testing.T) {
+	cache := InitPolicyCache(&PolicyCacheOption{MaxEntryNum: 2})
+	bitMap := newTestCacheBitMap(t, 64)
+	getTestCache(t, cache, "a", bitMap)
+	getTestCache(t, cache, "b", bitMap)
+	//a 最近使用，加入 c 时淘汰 b
+	if getTestCache(t, cache, "a", bitMap) {
+		t.Fatal("a should hit")
+	}
+	getTestCache(t, cache, "c", bitMap)
+	if getTestCache(t, cache, "a", bitMap) || getTestCache(t, cache, "c", bitMap) {
+		t.Fatal("a and c should hit")
+	}
+	if !getTestCache(t, cache, "b", bitMap) {
+		t.Fatal("b should be evicted")
+	}
+	stats := cache.Stats()
+	if stats.HitCount != 3 || stats.MissCount != 4 || stats.EvictionCount != 2 || stats.EntryNum != 2 ||
+		stats.MemoryBytes != 2*bitMap.getMemoryBytes() {
+		t.Fatalf("stats %+v", stats)
+	}
+	cache.Remove("b")
+	cache.Remove("x")
+	if stats = cache.Stats(); stats.EntryNum != 1 || stats.MemoryBytes != bitMap.getMemoryBytes() {
+		t.Fatalf("stats after remove %+v", stats)
+	}
+	cache.Purge()
+	if stats = cache.Stats(); stats.EntryNum != 0 || stats.MemoryBytes != 0 || stats.HitCount != 3 {
+		t.Fatalf("stats after purge %+v", stats)
+	}
+	if !getTestCache(t, cache, "c", bitMap) {
+		t.Fatal("c should be purged")
+	}
+}
+
+func TestPolicyCacheMemoryBound(t *testing.T) {
+	smallBitMap, largeBitMap := newTestCacheBitMap(t, 64), newTestCacheBitMap(t, 64*100)
+	cache := InitPolicyCache(&PolicyCacheOption{MaxMemoryBytes: 2*smallBitMap.getMemoryBytes() + 1})
+	//单个位图超过上限时不缓存，也不淘汰已有的位图
+	getTestCache(t, cache, "a", smallBitMap)
+	getTestCache(t, cache, "large", largeBitMap)
+	if !getTestCache(t, cache, "large", largeBitMap) {
+		t.Fatal("large bitmap should not be cached")
+	}
+	getTestCache(t, cache, "b", smallBitMap)
+	getTestCache(t, cache, "c", smallBitMap)
+	stats := cache.Stats()
+	if stats.EntryNum != 2 || stats.EvictionCount != 1 || stats.MemoryBytes > 2*smallBitMap.getMemoryBytes()+1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if !getTestCache(t, cache, "a", smallBitMap) {
+		t.Fatal("a should be evicted")
+	}
+}
+
+//相同 key 的并发调用只编译一次，其余调用等待并共享结果
+func TestPolicyCacheSingleFlight(t *testing.T) {
+	cache := InitPolicyCache(nil)
+	bitMap := newTestCacheBitMap(t, 64)
+	const callNum = 8
+	release := make(chan struct{})
+	createCount := 0
+	resultList := make([]*MDBitMap, callNum)
+	var wg sync.WaitGroup
+	for i := 0; i < callNum; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := cache.getOrCreate("a", func() (*MDBitMap, error) {
+				createCount++
+				<-release
+				return bitMap, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			resultList[i] = result
+		}(i)
+	}
+	//等待其余调用都合并到正在进行的编译
+	for cache.Stats().SharedCount < callNum-1 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if createCount != 1 {
+		t.Fatalf("create count %d", createCount)
+	}
+	for _, result := range resultList {
+		if result != bitMap {
+			t.Fatal("result not shared")
+		}
+	}
+	stats := cache.Stats()
+	if stats.MissCount != 1 || stats.SharedCount != callNum-1 || stats.HitCount != 0 || stats.EntryNum != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+//编译失败或 panic 的结果不缓存，等待的调用方得到错误
+func TestPolicyCacheError(t *testing.T) {
+	cache := InitPolicyCache(nil)
+	createErr := errors.New("compile failed")
+	if _, err := cache.getOrCreate("a", func() (*MDBitMap, error) { return nil, createErr }); !errors.Is(err, createErr) {
+		t.Fatalf("error %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic not propagated")
+			}
+		}()
+		cache.getOrCreate("a", func() (*MDBitMap, error) { panic("compile panicked") })
+	}()
+	if !getTestCache(t, cache, "a", newTestCacheBitMap(t, 64)) {
+		t.Fatal("failed result should not be cached")
+	}
+	if stats := cache.Stats(); stats.MissCount != 3 || stats.EntryNum != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
@@ -0,0 +1,338 @@
+// mdbitmap 调试策略的命令行工具
+/**
+ * 用法：
+ *   mdbitmap compile -schema schema.json -rule rule.json -o policy.mdbm   规则列表编译为位图文件（二进制格式，包含 schema）
+ *                    [-max-cell n] [-max-expansion n] [-dry-run]         限制编译规模，-dry-run 只输出预估结果，见 EstimateCompile
+ *   mdbitmap check   -bitmap policy.mdbm -record record.json               判断记录是否允许，拒绝时输出原因
+ *   mdbitmap explain -bitmap policy.mdbm                                  输出位图的最简规则列表
+ *   mdbitmap diff    -old old.mdbm -new new.mdbm                          输出两个版本位图的差异
+ *   mdbitmap render  -bitmap policy.mdbm [-row country] [-column salary] [-format text|markdown|csv]  按二维切片输出位图，见 MDBitMap.Render
+ * 位图文件可以是 MarshalBinary 生成的二进制或 MarshalJSON 生成的 json，按文件头自动识别；
+ * 不包含 schema 的位图文件可通过 -schema 指定 schema；文件路径为 - 时读取标准输入
+ * 规则文件为 MDRule 列表的 json，如 [{"condition_list":[{"function":"country","value_list":["SG"]}]}]
+ **/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	my_utils "github.com/Hzg030/go_util"
+)
+
+// 判断结果为拒绝时的退出码
+const exitCodeDeny = 3
+
+var commandMap = map[string]func(argList []string) error{
+	"compile": runCompile,
+	"check":   runCheck,
+	"explain": runExplain,
+	"diff":    runDiff,
+	"render":  runRender,
+}
+
+// errDeny check 判断结果为拒绝
+var errDeny = errors.New("deny")
+
+// 命令的输出，测试时替换
+var stdout io.Writer = os.Stdout
+
+func main() {
+	if len(os.Args) < 2 || commandMap[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: mdbitmap compile|check|explain|diff|render [flags]")
+		os.Exit(2)
+	}
+	if err := commandMap[os.Args[1]](os.Args[2:]); err != nil {
+		if errors.Is(err, errDeny) {
+			os.Exit(exitCodeDeny)
+		}
+		fmt.Fprintln(os.Stderr, "mdbitmap:", err)
+		os.Exit(1)
+	}
+}
+
+func runCompile(argList []string) error {
+	flagSet := flag.NewFlagSet("compile", flag.ExitOnError)
+	schemaPath := flagSet.String("schema", "", "schema json 文件")
+	rulePath := flagSet.String("rule", "", "规则列表 json 文件")
+	outputPath := flagSet.String("o", "-", "输出的位图文件")
+	format := flagSet.String("format", "binary", "输出格式：binary / json")
+	maxCellNum := flagSet.Int64("max-cell", 0, "位图元素个数上限，0 表示不限制")
+	maxExpansion := flagSet.Int64("max-expansion", 0, "单条规则覆盖的元素个数上限，0 表示不限制")
+	dryRun := flagSet.Bool("dry-run", false, "只输出预估的位图规模，不编译")
+	flagSet.Parse(argList)
+	schema, err := readSchema(*schemaPath)
+	if err != nil {
+		return err
+	}
+	ruleList := make([]*my_utils.MDRule, 0)
+	if err := readJSON(*rulePath, &ruleList); err != nil {
+		return err
+	}
+	for _, rule := range ruleList {
+		if rule == nil {
+			continue
+		}
+		for _, condition := range rule.ConditionList {
+			if condition == nil {
+				continue
+			}
+			for i, value := range condition.ValueList {
+				condition.ValueList[i] = normalizeValue(value)
+			}
+		}
+	}
+	if *dryRun {
+		estimate, err := my_utils.EstimateCompile(schema, ruleList)
+		if err != nil {
+			return err
+		}
+		return printJSON(estimate)
+	}
+	option := &my_utils.CompileOption{MaxCellNum: *maxCellNum, MaxExpansion: *maxExpansion}
+	bitMap, err := my_utils.CompileMDBitMapWithOption(context.Background(), schema, ruleList, option)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch *format {
+	case "binary":
+		data, err = bitMap.MarshalBinary()
+	case "json":
+		data, err = bitMap.MarshalJSON()
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFile(*outputPath, data)
+}
+
+func runCheck(argList []string) error {
+	flagSet := flag.NewFlagSet("check", flag.ExitOnError)
+	bitMapPath := flagSet.String("bitmap", "", "位图文件")
+	schemaPath := flagSet.String("schema", "", "schema json 文件，位图文件不包含 schema 时必填")
+	recordPath := flagSet.String("record", "-", "记录 json 文件，维度 → 取值")
+	flagSet.Parse(argList)
+	bitMap, schema, err := readBitMap(*bitMapPath, *schemaPath)
+	if err != nil {
+		return err
+	}
+	record := make(map[string]interface{})
+	if err := readJSON(*recordPath, &record); err != nil {
+		return err
+	}
+	for function, value := range record {
+		record[function] = normalizeValue(value)
+	}
+	extractorMap := make(map[string]my_utils.FieldExtractor)
+	for _, function := range schema.FunctionList() {
+		function := function
+		extractorMap[function] = func(record interface{}) (interface{}, error) {
+			return record.(map[string]interface{})[function], nil
+		}
+	}
+	filter, err := my_utils.InitMDFilter(bitMap, schema, extractorMap)
+	if err != nil {
+		return err
+	}
+	allowed, reason, err := filter.Check(record)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		fmt.Fprintln(stdout, "allow")
+		return nil
+	}
+	fmt.Fprintln(stdout, "deny:", reason.Message)
+	return errDeny
+}
+
+func runExplain(argList []string) error {
+	flagSet := flag.NewFlagSet("explain", flag.ExitOnError)
+	bitMapPath := flagSet.String("bitmap", "", "位图文件")
+	schemaPath := flagSet.String("schema", "", "schema json 文件，位图文件不包含 schema 时必填")
+	asJSON := flagSet.Bool("json", false, "输出规则列表 json")
+	flagSet.Parse(argList)
+	bitMap, schema, err := readBitMap(*bitMapPath, *schemaPath)
+	if err != nil {
+		return err
+	}
+	ruleList, err := bitMap.ToMinimalRuleList(schema)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(ruleList)
+	}
+	if len(ruleList) == 0 {
+		fmt.Fprintln(stdout, "(empty)")
+	}
+	for _, rule := range ruleList {
+		fmt.Fprintln(stdout, rule.String())
+	}
+	return nil
+}
+
+func runDiff(argList []string) error {
+	flagSet := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldPath := flagSet.String("old", "", "旧版本位图文件")
+	newPath := flagSet.String("new", "", "新版本位图文件")
+	schemaPath := flagSet.String("schema", "", "schema json 文件，位图文件不包含 schema 时使用")
+	maxCellNum := flagSet.Int("max-cell", 0, "json 输出中每个方向最多列出的元素个数")
+	asJSON := flagSet.Bool("json", false, "输出差异 json")
+	flagSet.Parse(argList)
+	oldBitMap, oldSchema, err := readBitMap(*oldPath, *schemaPath)
+	if err != nil {
+		return err
+	}
+	newBitMap, newSchema, err := readBitMap(*newPath, *schemaPath)
+	if err != nil {
+		return err
+	}
+	diff, err := my_utils.DiffMDBitMap(oldBitMap, oldSchema, newBitMap, newSchema, &my_utils.MDDiffOption{MaxCellNum: *maxCellNum})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(diff)
+	}
+	for _, summary := range diff.AddedSummaryList {
+		fmt.Fprintln(stdout, "+", summary)
+	}
+	for _, summary := range diff.RemovedSummaryList {
+		fmt.Fprintln(stdout, "-", summary)
+	}
+	fmt.Fprintf(stdout, "%d cells added, %d cells removed\n", diff.AddedCellCount, diff.RemovedCellCount)
+	return nil
+}
+
+func runRender(argList []string) error {
+	flagSet := flag.NewFlagSet("render", flag.ExitOnError)
+	bitMapPath := flagSet.String("bitmap", "", "位图文件")
+	schemaPath := flagSet.String("schema", "", "schema json 文件，位图文件不包含 schema 时必填")
+	row := flagSet.String("row", "", "作为行的维度，默认为倒数第二个维度")
+	column := flagSet.String("column", "", "作为列的维度，默认为最后一个维度")
+	format := flagSet.String("format", "text", "输出格式：text / markdown / csv")
+	collapse := flagSet.Bool("collapse", true, "合并范围维度取值相同的相邻槽位")
+	flagSet.Parse(argList)
+	bitMap, schema, err := readBitMap(*bitMapPath, *schemaPath)
+	if err != nil {
+		return err
+	}
+	option := &my_utils.RenderOption{Row: *row, Column: *column, CollapseRange: *collapse}
+	switch *format {
+	case "text":
+		option.Format = my_utils.RenderFormatText
+	case "markdown":
+		option.Format = my_utils.RenderFormatMarkdown
+	case "csv":
+		option.Format = my_utils.RenderFormatCSV
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	return bitMap.Render(stdout, schema, option)
+}
+
+//读取位图文件，二进制或 json 格式，schemaPath 非空时使用该 schema
+func readBitMap(path string, schemaPath string) (*my_utils.MDBitMap, *my_utils.MDSchema, error) {
+	if path == "" {
+		return nil, nil, errors.New("bitmap file is required")
+	}
+	data, err := readFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	bitMap := &my_utils.MDBitMap{}
+	if bytes.HasPrefix(data, []byte("MDBM")) {
+		err = bitMap.UnmarshalBinary(data)
+	} else {
+		err = bitMap.UnmarshalJSON(data)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if schemaPath != "" {
+		schema, err := readSchema(schemaPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := bitMap.SetSchema(schema); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if bitMap.Schema() == nil {
+		return nil, nil, fmt.Errorf("%s: bitmap has no schema, use -schema", path)
+	}
+	return bitMap, bitMap.Schema(), nil
+}
+
+func readSchema(path string) (*my_utils.MDSchema, error) {
+	if path == "" {
+		return nil, errors.New("schema file is required")
+	}
+	schema := &my_utils.MDSchema{}
+	if err := readJSON(path, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+//数值解析为 json.Number，由调用方通过 normalizeValue 转换，超过 2^53 的整数取值（如 ID）保持精确
+func readJSON(path string, value interface{}) error {
+	data, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+//json.Number 转换为 int64、超过 int64 范围的 uint64 或 float64
+func normalizeValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if intValue, err := number.Int64(); err == nil {
+		return intValue
+	}
+	if uintValue, err := strconv.ParseUint(string(number), 10, 64); err == nil {
+		return uintValue
+	}
+	floatValue, _ := number.Float64()
+	return floatValue
+}
+
+func readFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func writeFile(path string, data []byte) error {
+	if path == "-" {
+		_, err := stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
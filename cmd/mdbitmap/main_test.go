@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//执行子命令，返回输出
+func runTestCommand(t *testing.T, argList ...string) (string, error) {
+	t.Helper()
+	buffer := &bytes.Buffer{}
+	defer func(writer io.Writer) { stdout = writer }(stdout)
+	stdout = buffer
+	err := commandMap[argList[0]](argList[1:])
+	return buffer.String(), err
+}
+
+func compileTestBitMap(t *testing.T, rulePath, outputPath, format string) {
+	t.Helper()
+	if _, err := runTestCommand(t, "compile", "-schema", "testdata/schema.json", "-rule", rulePath,
+		"-format", format, "-o", outputPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	dir := t.TempDir()
+	compileTestBitMap(t, "testdata/rule_old.json", filepath.Join(dir, "old.mdbm"), "binary")
+	compileTestBitMap(t, "testdata/rule_new.json", filepath.Join(dir, "new.json"), "json")
+	output, err := runTestCommand(t, "compile", "-schema", "testdata/schema.json", "-rule", "testdata/rule_new.json", "-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["cell_num"] != float64(30) || result["max_expansion"] != float64(5) {
+		t.Fatalf("dry run output %s", output)
+	}
+	if _, err := runTestCommand(t, "compile", "-schema", "testdata/schema.json", "-rule", "testdata/missing.json", "-dry-run"); err == nil {
+		t.Fatal("missing rule file should fail")
+	}
+}
+
+//超过 2^53 的整数取值按精确值匹配
+func TestCheck(t *testing.T) {
+	bitMapPath := filepath.Join(t.TempDir(), "old.mdbm")
+	compileTestBitMap(t, "testdata/rule_old.json", bitMapPath, "binary")
+	output, err := runTestCommand(t, "check", "-bitmap", bitMapPath, "-record", "testdata/record_allow.json")
+	if err != nil || output != "allow\n" {
+		t.Fatalf("allow record: %q %v", output, err)
+	}
+	output, err = runTestCommand(t, "check", "-bitmap", bitMapPath, "-record", "testdata/record_deny.json")
+	if !errors.Is(err, errDeny) || output != "deny: country=SG, employee_id=9007199254740992, salary=1200 not granted\n" {
+		t.Fatalf("deny record: %q %v", output, err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	bitMapPath := filepath.Join(t.TempDir(), "new.json")
+	compileTestBitMap(t, "testdata/rule_new.json", bitMapPath, "json")
+	output, err := runTestCommand(t, "explain", "-bitmap", bitMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "country=SG, employee_id=9007199254740993\ncountry=MY, salary in (5000,+inf)\n" {
+		t.Fatalf("explain output %q", output)
+	}
+	output, err = runTestCommand(t, "explain", "-bitmap", bitMapPath, "-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "9007199254740993") {
+		t.Fatalf("explain json output %s", output)
+	}
+	ruleList := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(output), &ruleList); err != nil || len(ruleList) != 2 {
+		t.Fatalf("explain json output %s, err %v", output, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	compileTestBitMap(t, "testdata/rule_old.json", filepath.Join(dir, "old.mdbm"), "binary")
+	compileTestBitMap(t, "testdata/rule_new.json", filepath.Join(dir, "new.json"), "json")
+	output, err := runTestCommand(t, "diff", "-old", filepath.Join(dir, "old.mdbm"), "-new", filepath.Join(dir, "new.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "+ country=MY, salary in (5000,+inf)\n2 cells added, 0 cells removed\n" {
+		t.Fatalf("diff output %q", output)
+	}
+}
+
+func TestRender(t *testing.T) {
+	bitMapPath := filepath.Join(t.TempDir(), "new.json")
+	compileTestBitMap(t, "testdata/rule_new.json", bitMapPath, "json")
+	output, err := runTestCommand(t, "render", "-bitmap", bitMapPath, "-row", "country", "-column", "salary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `employee_id=9007199254740992
+country/salary  (-inf,5000]  (5000,+inf)
+SG              0            0
+MY              0            1
+TH              0            0
+
+employee_id=9007199254740993
+country/salary  (-inf,5000]  (5000,+inf)
+SG              1            1
+MY              0            1
+TH              0            0
+`
+	if output != want {
+		t.Fatalf("render output\n%s", output)
+	}
+}
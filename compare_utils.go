@@ -0,0 +1,148 @@
+package my_utils
+
+import "fmt"
+
+// DefaultMaxWitnessNum 默认最多返回的差异规则条数
+const DefaultMaxWitnessNum = 10
+
+// MDCompareOption 比较配置
+type MDCompareOption struct {
+	// 当前位图及目标位图在说明中的名称，默认为 A / B
+	SourceName string
+	TargetName string
+	// 每个方向最多返回的差异规则条数，<=0 时使用 DefaultMaxWitnessNum
+	MaxWitnessNum int
+}
+
+// MDWitness 差异说明：一组只被一方授予的元素
+type MDWitness struct {
+	Rule      *MDRule
+	CellCount int64
+	// 如 country=MY, salary in (5000,+inf) granted by B but not A
+	Message string
+}
+
+// MDCompareResult 比较结果
+type MDCompareResult struct {
+	// 包含 / 相等是否成立
+	Holds bool
+	// 只被当前位图授予的元素，按最简规则分组
+	OnlySourceList      []*MDWitness
+	OnlySourceCellCount int64
+	// 只被目标位图授予的元素，按最简规则分组
+	OnlyTargetList      []*MDWitness
+	OnlyTargetCellCount int64
+	// 差异规则条数超过 MaxWitnessNum 时为 true，此时只返回前 MaxWitnessNum 条
+	Truncated bool
+	Summary   string
+}
+
+// ExplainContainsMDBitMap 判断是否包含另一个 MDBitMap，不包含时说明原因
+/**
+ * @Description 与 ContainsMDBitMap 一致，A 包含 B 当且仅当 B & !A 为空；
+ * 不包含时 OnlyTargetList 列出 B 有而 A 没有的元素（以最简规则表示）
+ * @e.g.
+	manager.ExplainContainsMDBitMap(newScope, schema, &MDCompareOption{SourceName: "manager", TargetName: "new scope"})
+	不包含时 OnlyTargetList[0].Message 如：country=MY, salary in (5000,+inf) granted by new scope but not manager
+ **/
+func (m *MDBitMap) ExplainContainsMDBitMap(targetBitMap *MDBitMap, schema *MDSchema, option *MDCompareOption) (*MDCompareResult, error) {
+	return m.compareMDBitMap(targetBitMap, schema, option, false)
+}
+
+// ExplainEqualMDBitMap 判断与另一个 MDBitMap 是否相等，不相等时说明两个方向的差异
+func (m *MDBitMap) ExplainEqualMDBitMap(targetBitMap *MDBitMap, schema *MDSchema, option *MDCompareOption) (*MDCompareResult, error) {
+	return m.compareMDBitMap(targetBitMap, schema, option, true)
+}
+
+func (m *MDBitMap) compareMDBitMap(targetBitMap *MDBitMap, schema *MDSchema, option *MDCompareOption, equal bool) (*MDCompareResult, error) {
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
+		return nil, err
+	}
+	if err := schema.checkMDBitMap(m); err != nil {
+		return nil, err
+	}
+	option = getCompareOption(option)
+	result := &MDCompareResult{}
+	//B & !A 即 B 有而 A 没有
+	onlyTarget, err := targetBitMap.AndMDBitMap(m.NotMDBitMap())
+	if err != nil {
+		return nil, err
+	}
+	result.OnlyTargetList, result.OnlyTargetCellCount, result.Truncated = onlyTarget.getWitnessList(schema, option, option.TargetName, option.SourceName)
+	if equal {
+		onlySource, err := m.AndMDBitMap(targetBitMap.NotMDBitMap())
+		if err != nil {
+			return nil, err
+		}
+		var truncated bool
+		result.OnlySourceList, result.OnlySourceCellCount, truncated = onlySource.getWitnessList(schema, option, option.SourceName, option.TargetName)
+		result.Truncated = result.Truncated || truncated
+	}
+	result.Holds = result.OnlyTargetCellCount == 0 && result.OnlySourceCellCount == 0
+	result.Summary = getCompareSummary(result, option, equal)
+	return result, nil
+}
+
+//将差异位图转换为说明列表，最多 MaxWitnessNum 条
+func (m *MDBitMap) getWitnessList(schema *MDSchema, option *MDCompareOption, grantedBy string, notGrantedBy string) ([]*MDWitness, int64, bool) {
+	boxList := m.getMinimalBoxList(make([]int64, 0, len(m.lengthList)))
+	witnessList := make([]*MDWitness, 0)
+	cellCount := int64(0)
+	for i, box := range boxList {
+		count := m.getBoxCellCount(box)
+		cellCount += count
+		if i >= option.MaxWitnessNum {
+			continue
+		}
+		rule := schema.boxToRule(box)
+		witnessList = append(witnessList, &MDWitness{
+			Rule:      rule,
+			CellCount: count,
+			Message:   fmt.Sprintf("%s granted by %s but not %s", rule, grantedBy, notGrantedBy),
+		})
+	}
+	return witnessList, cellCount, len(boxList) > option.MaxWitnessNum
+}
+
+func getCompareOption(option *MDCompareOption) *MDCompareOption {
+	finalOption := MDCompareOption{SourceName: "A", TargetName: "B", MaxWitnessNum: DefaultMaxWitnessNum}
+	if option == nil {
+		return &finalOption
+	}
+	if option.SourceName != "" {
+		finalOption.SourceName = option.SourceName
+	}
+	if option.TargetName != "" {
+		finalOption.TargetName = option.TargetName
+	}
+	if option.MaxWitnessNum > 0 {
+		finalOption.MaxWitnessNum = option.MaxWitnessNum
+	}
+	return &finalOption
+}
+
+//生成比较结果概要，如：A does not contain B: 12 cells in 3 rules granted by B but not A
+func getCompareSummary(result *MDCompareResult, option *MDCompareOption, equal bool) string {
+	relation := "contains"
+	if equal {
+		relation = "equals"
+	}
+	if result.Holds {
+		return fmt.Sprintf("%s %s %s", option.SourceName, relation, option.TargetName)
+	}
+	relation = "does not contain"
+	if equal {
+		relation = "does not equal"
+	}
+	summary := fmt.Sprintf("%s %s %s:", option.SourceName, relation, option.TargetName)
+	if result.OnlyTargetCellCount > 0 {
+		summary += fmt.Sprintf(" %d cells granted by %s but not %s;", result.OnlyTargetCellCount, option.TargetName, option.SourceName)
+	}
+	if result.OnlySourceCellCount > 0 {
+		summary += fmt.Sprintf(" %d cells granted by %s but not %s;", result.OnlySourceCellCount, option.SourceName, option.TargetName)
+	}
+	if result.Truncated {
+		summary += fmt.Sprintf(" showing at most %d rules per side;", option.MaxWitnessNum)
+	}
+	return summary[:len(summary)-1]
+}
@@ -0,0 +1,117 @@
+package my_utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExplainEqualMDBitMap(t *testing.T) {
+	schema := newTestSchema(t)
+	source := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG"]}]}]`)
+	target := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]}]`)
+	result, err := source.ExplainEqualMDBitMap(target, schema, &MDCompareOption{SourceName: "manager", TargetName: "new scope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Holds || result.Truncated {
+		t.Fatalf("holds %v, truncated %v", result.Holds, result.Truncated)
+	}
+	if len(result.OnlyTargetList) != 1 || result.OnlyTargetCellCount != 1 || result.OnlyTargetList[0].CellCount != 1 ||
+		result.OnlyTargetList[0].Message != "country=MY, salary in (5000,+inf) granted by new scope but not manager" {
+		t.Fatalf("only target %d %+v", result.OnlyTargetCellCount, result.OnlyTargetList)
+	}
+	if len(result.OnlySourceList) != 1 || result.OnlySourceCellCount != 4 ||
+		result.OnlySourceList[0].Message != "country=SG, salary in (-inf,5000] granted by manager but not new scope" {
+		t.Fatalf("only source %d %+v", result.OnlySourceCellCount, result.OnlySourceList)
+	}
+	if result.Summary != "manager does not equal new scope: 1 cells granted by new scope but not manager; 4 cells granted by manager but not new scope" {
+		t.Fatalf("summary %q", result.Summary)
+	}
+	//差异规则重新编译后与差异位图一致
+	onlyTarget, _ := target.AndMDBitMap(source.NotMDBitMap())
+	witnessBitMap, err := CompileMDBitMap(schema, []*MDRule{result.OnlyTargetList[0].Rule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !witnessBitMap.EqualMDBitMap(onlyTarget) {
+		t.Fatal("witness rule mismatch")
+	}
+
+	result, err = source.ExplainEqualMDBitMap(source.CopyMDBitMap(), schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Holds || len(result.OnlySourceList) != 0 || len(result.OnlyTargetList) != 0 || result.Summary != "A equals B" {
+		t.Fatalf("equal result %+v", result)
+	}
+}
+
+func TestExplainContainsMDBitMap(t *testing.T) {
+	schema := newTestSchema(t)
+	source := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG"]}]}]`)
+	target := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]}]`)
+	result, err := source.ExplainContainsMDBitMap(target, schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//只检查 B 有而 A 没有的元素
+	if result.Holds || len(result.OnlySourceList) != 0 || result.OnlySourceCellCount != 0 {
+		t.Fatalf("contains result %+v", result)
+	}
+	if len(result.OnlyTargetList) != 1 || result.OnlyTargetList[0].Message != "country=MY, salary in (5000,+inf) granted by B but not A" {
+		t.Fatalf("only target %+v", result.OnlyTargetList)
+	}
+	if result.Summary != "A does not contain B: 1 cells granted by B but not A" {
+		t.Fatalf("summary %q", result.Summary)
+	}
+	result, err = target.ExplainContainsMDBitMap(source, schema, &MDCompareOption{SourceName: "new scope", TargetName: "manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Holds || result.OnlyTargetCellCount != 4 ||
+		result.OnlyTargetList[0].Message != "country=SG, salary in (-inf,5000] granted by manager but not new scope" {
+		t.Fatalf("contains result %+v", result)
+	}
+	onlySource, _ := source.AndMDBitMap(target.NotMDBitMap())
+	result, err = source.ExplainContainsMDBitMap(onlySource, schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Holds || result.Summary != "A contains B" {
+		t.Fatalf("contains result %+v", result)
+	}
+}
+
+//差异规则条数超过 MaxWitnessNum 时截断，元素个数仍为全部差异
+func TestExplainMDBitMapTruncated(t *testing.T) {
+	schema := newTestSchema(t)
+	source := &MDBitMap{}
+	if err := source.InitMDBitMap(schema.LengthList(), nil); err != nil {
+		t.Fatal(err)
+	}
+	//棋盘格的奇偶行分别合并为一条最简规则，共 2 条
+	target := source.CopyMDBitMap()
+	for cursor := target.Cursor(); cursor.Next(); {
+		indexList := cursor.IndexList()
+		if (indexList[0]+indexList[1])%2 == 0 {
+			target.setBit(cursor.Offset())
+		}
+	}
+	result, err := source.ExplainContainsMDBitMap(target, schema, &MDCompareOption{MaxWitnessNum: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || len(result.OnlyTargetList) != 1 || result.OnlyTargetCellCount != target.CountMDBitMap() {
+		t.Fatalf("truncated %v, witness count %d, cell count %d", result.Truncated, len(result.OnlyTargetList), result.OnlyTargetCellCount)
+	}
+	if result.Summary != "A does not contain B: 13 cells granted by B but not A; showing at most 1 rules per side" {
+		t.Fatalf("summary %q", result.Summary)
+	}
+	otherBitMap := &MDBitMap{}
+	if err := otherBitMap.InitMDBitMap([]int64{5, 4}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.ExplainEqualMDBitMap(otherBitMap, schema, nil); !errors.Is(err, ErrInconsistentMap) {
+		t.Fatalf("inconsistent map error %v", err)
+	}
+}
@@ -0,0 +1,387 @@
+package my_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrInvalidCondition 条件不合法
+var ErrInvalidCondition = errors.New("invalid md condition")
+
+// ErrCompileLimitExceeded 编译超过 CompileOption 的限制，具体错误为 *CompileLimitError
+var ErrCompileLimitExceeded = errors.New("md bitmap compile limit exceeded")
+
+// 条件运算符
+const (
+	OperatorIn    = "in"
+	OperatorNotIn = "not_in"
+	OperatorGT    = "gt"
+	OperatorGTE   = "gte"
+	OperatorLT    = "lt"
+	OperatorLTE   = "lte"
+)
+
+// CompileMDBitMap 将规则列表编译为 MDBitMap，规则之间为"或"关系，规则内各条件为"与"关系，元素个数上限为 DefaultCompileMaxCellNum
+/**
+ * @Description 每条规则即各维度槽位集合的笛卡尔积，同一维度出现多个条件时取交集，未出现的维度不做限制
+ * 运算符：
+ *   in / 空：离散维度取值在 ValueList 中，树形维度的中间节点展开为所有后代叶子节点；
+ *           ValueList 中不在枚举取值中的取值返回 ErrValueNotFound，其他取值槽位需显式使用 OtherValue
+ *           范围维度取值落在 IntervalList 任一区间中，或等于 ValueList 中的边界值
+ *   not_in：in 的补集
+ *   gt / gte / lt / lte：仅用于范围维度，ValueList[0] 为比较的边界值，与 getGTBitMapIndexList 一致
+ * 范围维度使用的数值及区间端点必须是 schema 中的边界值，否则返回 ErrInvalidCondition
+ * 编译结果附加 schema，可直接与 ToMinimalRuleList 的结果互相转换
+ * @e.g.
+	country 取值 [SG, MY, TH]，salary 边界值 [5000]
+	规则：[{country in [SG, MY], salary gt [5000]}, {country in [TH]}]
+	编译为 3*3 的位图：
+	country/salary (-inf,5000) [5000] (5000,+inf)
+	SG             0           0      1
+	MY             0           0      1
+	TH             1           1      1
+ **/
+func CompileMDBitMap(schema *MDSchema, ruleList []*MDRule) (*MDBitMap, error) {
+	return CompileMDBitMapWithOption(context.Background(), schema, ruleList, nil)
+}
+
+// DefaultCompileMaxCellNum 未指定 CompileOption 时的位图元素个数上限，即位数组最多 128MB
+const DefaultCompileMaxCellNum int64 = 1 << 30
+
+// CompileOption 编译选项，限制单次编译占用的资源，防止恶意或错误的规则耗尽内存
+type CompileOption struct {
+	// 位图元素个数上限，即各维度长度的乘积，<=0 表示不限制；option 为 nil 时为 DefaultCompileMaxCellNum
+	MaxCellNum int64
+	// 单条规则覆盖的元素个数上限，<=0 表示不限制
+	MaxExpansion int64
+}
+
+// 超过的编译限制
+const (
+	CompileLimitCellNum   = "cell_num"
+	CompileLimitExpansion = "expansion"
+)
+
+// CompileLimitError 编译超过 CompileOption 的限制，errors.Is 判断为 ErrCompileLimitExceeded
+type CompileLimitError struct {
+	// CompileLimitCellNum / CompileLimitExpansion
+	Limit string
+	// 超过单条规则限制时为规则下标，否则为 -1
+	RuleIndex int
+	Value     int64
+	Max       int64
+}
+
+func (e *CompileLimitError) Error() string {
+	if e.RuleIndex >= 0 {
+		return fmt.Sprintf("%v: rule %d %s %d exceeds %d", ErrCompileLimitExceeded, e.RuleIndex, e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%v: %s %d exceeds %d", ErrCompileLimitExceeded, e.Limit, e.Value, e.Max)
+}
+
+// Unwrap 返回 ErrCompileLimitExceeded
+func (e *CompileLimitError) Unwrap() error {
+	return ErrCompileLimitExceeded
+}
+
+// CompileEstimate 编译预估结果，见 EstimateCompile
+type CompileEstimate struct {
+	// 位图元素个数，超过 int64 范围时为 math.MaxInt64
+	CellNum int64 `json:"cell_num"`
+	// 位图位数组占用的内存（字节）
+	MemoryBytes int64 `json:"memory_bytes"`
+	// 各规则覆盖的元素个数，与规则列表一一对应，规则不覆盖任何元素时为 0
+	ExpansionList []int64 `json:"expansion_list"`
+	// ExpansionList 中的最大值
+	MaxExpansion int64 `json:"max_expansion"`
+}
+
+// EstimateCompile 预估编译结果的规模，只校验规则、计算元素个数，不申请位图内存
+/**
+ * @Description 可在编译前根据预估结果拒绝请求或选择 MDD 等其他表示；规则不合法时返回与 CompileMDBitMap 相同的错误
+ * @e.g.
+	country 取值 [SG, MY, TH]，salary 边界值 [5000]
+	规则：[{country in [SG, MY], salary gt [5000]}, {country in [TH]}]
+	返回：{cell_num: 9, memory_bytes: 8, expansion_list: [2, 3], max_expansion: 3}
+ **/
+func EstimateCompile(schema *MDSchema, ruleList []*MDRule) (*CompileEstimate, error) {
+	boxList, err := schema.getRuleBoxList(ruleList)
+	if err != nil {
+		return nil, err
+	}
+	return getCompileEstimate(schema.LengthList(), boxList), nil
+}
+
+// CompileMDBitMapWithOption 带选项的 CompileMDBitMap，编译结果一致
+/**
+ * @Description 申请位图内存前先按 EstimateCompile 校验全部规则及限制，超过限制时返回 *CompileLimitError；
+ * 编译每条规则前及填充每条规则的过程中检查 ctx，ctx 取消或超时时返回 ctx.Err()；
+ * option 为 nil 时元素个数上限为 DefaultCompileMaxCellNum，不限制单条规则，需要编译更大的位图时显式指定 option
+ **/
+func CompileMDBitMapWithOption(ctx context.Context, schema *MDSchema, ruleList []*MDRule, option *CompileOption) (*MDBitMap, error) {
+	if option == nil {
+		option = &CompileOption{MaxCellNum: DefaultCompileMaxCellNum}
+	}
+	boxList, err := schema.getRuleBoxList(ruleList)
+	if err != nil {
+		return nil, err
+	}
+	estimate := getCompileEstimate(schema.LengthList(), boxList)
+	if option.MaxCellNum > 0 && estimate.CellNum > option.MaxCellNum {
+		return nil, &CompileLimitError{Limit: CompileLimitCellNum, RuleIndex: -1, Value: estimate.CellNum, Max: option.MaxCellNum}
+	}
+	if option.MaxExpansion > 0 {
+		for i, expansion := range estimate.ExpansionList {
+			if expansion > option.MaxExpansion {
+				return nil, &CompileLimitError{Limit: CompileLimitExpansion, RuleIndex: i, Value: expansion, Max: option.MaxExpansion}
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	finalMDBitMap := MDBitMap{}
+	if err := finalMDBitMap.InitMDBitMap(schema.LengthList(), nil); err != nil {
+		return nil, err
+	}
+	finalMDBitMap.schema = schema
+	for _, box := range boxList {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if box == nil {
+			continue
+		}
+		//单个盒子较大时填充过程中也会检查 ctx
+		if err := finalMDBitMap.fillBox(ctx, box, true); err != nil {
+			return nil, err
+		}
+	}
+	return &finalMDBitMap, nil
+}
+
+// getRuleBoxList 将规则列表转换为盒子列表，与规则一一对应，规则不覆盖任何元素时为 nil
+func (s *MDSchema) getRuleBoxList(ruleList []*MDRule) ([][][]int64, error) {
+	boxList := make([][][]int64, len(ruleList))
+	for i, rule := range ruleList {
+		box, err := s.getRuleBox(rule)
+		if err != nil {
+			return nil, err
+		}
+		boxList[i] = box
+	}
+	return boxList, nil
+}
+
+//根据盒子列表计算编译预估结果
+func getCompileEstimate(lengthList []int64, boxList [][][]int64) *CompileEstimate {
+	estimate := &CompileEstimate{CellNum: getSaturatedCellNum(lengthList), ExpansionList: make([]int64, len(boxList))}
+	estimate.MemoryBytes = multiplySaturated(getWordNum(estimate.CellNum), 8)
+	for i, box := range boxList {
+		if box == nil {
+			continue
+		}
+		estimate.ExpansionList[i] = getSaturatedBoxCellNum(box, lengthList)
+		if estimate.ExpansionList[i] > estimate.MaxExpansion {
+			estimate.MaxExpansion = estimate.ExpansionList[i]
+		}
+	}
+	return estimate
+}
+
+//各维度长度的乘积，超过 int64 范围时为 math.MaxInt64
+func getSaturatedCellNum(lengthList []int64) int64 {
+	cellNum := int64(1)
+	for _, length := range lengthList {
+		cellNum = multiplySaturated(cellNum, length)
+	}
+	return cellNum
+}
+
+//盒子覆盖的元素个数，nil 表示该维度全部槽位，超过 int64 范围时为 math.MaxInt64
+func getSaturatedBoxCellNum(box [][]int64, lengthList []int64) int64 {
+	cellNum := int64(1)
+	for i, slotList := range box {
+		if slotList == nil {
+			cellNum = multiplySaturated(cellNum, lengthList[i])
+			continue
+		}
+		cellNum = multiplySaturated(cellNum, int64(len(slotList)))
+	}
+	return cellNum
+}
+
+//两个非负数相乘，溢出时返回 math.MaxInt64
+func multiplySaturated(a int64, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
+
+// getRuleBox 将规则转换为各维度槽位列表，nil 表示该维度不做限制；规则不覆盖任何元素时返回 nil
+func (s *MDSchema) getRuleBox(rule *MDRule) ([][]int64, error) {
+	if rule == nil {
+		return nil, fmt.Errorf("%w: rule is null", ErrInvalidCondition)
+	}
+	box := make([][]int64, len(s.functionList))
+	for _, condition := range rule.ConditionList {
+		if condition == nil {
+			return nil, fmt.Errorf("%w: condition is null", ErrInvalidCondition)
+		}
+		functionIndex, ok := s.functionIndexMap[condition.Function]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, condition.Function)
+		}
+		slotList, err := s.getConditionSlotList(condition)
+		if err != nil {
+			return nil, err
+		}
+		if box[functionIndex] != nil {
+			slotList = intersectSlotList(box[functionIndex], slotList)
+		}
+		if len(slotList) == 0 {
+			return nil, nil
+		}
+		box[functionIndex] = slotList
+	}
+	return box, nil
+}
+
+// getConditionSlotList 获取条件覆盖的槽位列表，升序不重复
+func (s *MDSchema) getConditionSlotList(condition *MDCondition) ([]int64, error) {
+	length := s.LengthList()[s.functionIndexMap[condition.Function]]
+	slotSet := make(map[int64]bool)
+	switch condition.Operator {
+	case "", OperatorIn, OperatorNotIn:
+		for _, value := range condition.ValueList {
+			var slotList []int64
+			var err error
+			if s.IsRangeFunction(condition.Function) {
+				slotList, err = s.getBoundarySlotList(condition.Function, value)
+			} else {
+				slotList, err = s.getValueSlotList(condition.Function, value)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, slot := range slotList {
+				slotSet[slot] = true
+			}
+		}
+		for _, interval := range condition.IntervalList {
+			startSlot, endSlot, err := s.getIntervalSlotRange(condition.Function, interval)
+			if err != nil {
+				return nil, err
+			}
+			for slot := startSlot; slot <= endSlot; slot++ {
+				slotSet[slot] = true
+			}
+		}
+		if condition.Operator == OperatorNotIn {
+			complementSet := make(map[int64]bool)
+			for slot := int64(0); slot < length; slot++ {
+				if !slotSet[slot] {
+					complementSet[slot] = true
+				}
+			}
+			slotSet = complementSet
+		}
+	case OperatorGT, OperatorGTE, OperatorLT, OperatorLTE:
+		if !s.IsRangeFunction(condition.Function) || len(condition.ValueList) != 1 || len(condition.IntervalList) != 0 {
+			return nil, fmt.Errorf("%w: %s requires a range function and one value", ErrInvalidCondition, condition.Operator)
+		}
+		boundarySlotList, err := s.getBoundarySlotList(condition.Function, condition.ValueList[0])
+		if err != nil {
+			return nil, err
+		}
+		startSlot, endSlot := int64(0), length-1
+		switch condition.Operator {
+		case OperatorGT:
+			startSlot = boundarySlotList[0] + 1
+		case OperatorGTE:
+			startSlot = boundarySlotList[0]
+		case OperatorLT:
+			endSlot = boundarySlotList[0] - 1
+		case OperatorLTE:
+			endSlot = boundarySlotList[0]
+		}
+		for slot := startSlot; slot <= endSlot; slot++ {
+			slotSet[slot] = true
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidCondition, condition.Operator)
+	}
+	slotList := make([]int64, 0, len(slotSet))
+	for slot := range slotSet {
+		slotList = append(slotList, slot)
+	}
+	sort.Slice(slotList, func(i, j int) bool { return slotList[i] < slotList[j] })
+	return slotList, nil
+}
+
+// getBoundarySlotList 获取范围维度边界值对应的槽位，取值必须是 schema 中的边界值
+func (s *MDSchema) getBoundarySlotList(function string, value interface{}) ([]int64, error) {
+	slot, err := s.GetSlotIndex(function, value)
+	if err != nil {
+		return nil, err
+	}
+	if slot%2 == 0 {
+		return nil, fmt.Errorf("%w: %v is not a boundary of function %s", ErrInvalidCondition, value, function)
+	}
+	return []int64{slot}, nil
+}
+
+// getIntervalSlotRange 获取区间覆盖的槽位范围 [startSlot, endSlot]，区间端点必须是 schema 中的边界值
+//示例：边界值 [1000, 5000]，区间 (1000,+inf) 覆盖槽位 [2, 4]
+func (s *MDSchema) getIntervalSlotRange(function string, interval *Interval) (int64, int64, error) {
+	if !s.IsRangeFunction(function) {
+		return 0, 0, fmt.Errorf("%w: interval requires a range function, got %s", ErrInvalidCondition, function)
+	}
+	if interval == nil {
+		return 0, 0, fmt.Errorf("%w: interval is null", ErrInvalidCondition)
+	}
+	startSlot, endSlot := int64(0), int64(2*len(s.boundaryListMap[function]))
+	if interval.leftBoundary != nil {
+		slotList, err := s.getBoundarySlotList(function, *interval.leftBoundary)
+		if err != nil {
+			return 0, 0, err
+		}
+		startSlot = slotList[0]
+		if !interval.leftEqual {
+			startSlot++
+		}
+	}
+	if interval.rightBoundary != nil {
+		slotList, err := s.getBoundarySlotList(function, *interval.rightBoundary)
+		if err != nil {
+			return 0, 0, err
+		}
+		endSlot = slotList[0]
+		if !interval.rightEqual {
+			endSlot--
+		}
+	}
+	return startSlot, endSlot, nil
+}
+
+//求两个升序槽位列表的交集
+func intersectSlotList(leftList []int64, rightList []int64) []int64 {
+	result := make([]int64, 0)
+	for i, j := 0, 0; i < len(leftList) && j < len(rightList); {
+		switch {
+		case leftList[i] == rightList[j]:
+			result = append(result, leftList[i])
+			i++
+			j++
+		case leftList[i] < rightList[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
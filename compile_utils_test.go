@@ -0,0 +1,121 @@
+package my_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const testCompileRuleJSON = `[
+	{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]},
+	{"condition_list":[{"function":"country","value_list":["TH"]}]}]`
+
+func TestEstimateCompile(t *testing.T) {
+	schema := newTestSchema(t)
+	estimate, err := EstimateCompile(schema, getTestRuleList(t, testCompileRuleJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &CompileEstimate{CellNum: 25, MemoryBytes: 8, ExpansionList: []int64{2, 5}, MaxExpansion: 5}
+	if !reflect.DeepEqual(estimate, expect) {
+		t.Fatalf("EstimateCompile() = %+v, want %+v", estimate, expect)
+	}
+	if _, err := EstimateCompile(schema, getTestRuleList(t, `[{"condition_list":[{"function":"level","value_list":[1]}]}]`)); !errors.Is(err, ErrFunctionNotFound) {
+		t.Fatalf("EstimateCompile unknown function error %v", err)
+	}
+}
+
+func TestCompileMDBitMapWithOption(t *testing.T) {
+	schema := newTestSchema(t)
+	ruleList := getTestRuleList(t, testCompileRuleJSON)
+	expectBitMap, err := CompileMDBitMap(schema, ruleList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := expectBitMap.CountMDBitMap(); count != 7 {
+		t.Fatalf("CompileMDBitMap() count %d, want 7", count)
+	}
+	bitMap, err := CompileMDBitMapWithOption(context.Background(), schema, ruleList, &CompileOption{MaxCellNum: 25, MaxExpansion: 5})
+	if err != nil || !bitMap.EqualMDBitMap(expectBitMap) {
+		t.Fatalf("CompileMDBitMapWithOption() = %v, %v", bitMap, err)
+	}
+	caseList := []struct {
+		option *CompileOption
+		expect *CompileLimitError
+	}{
+		{&CompileOption{MaxCellNum: 24}, &CompileLimitError{Limit: CompileLimitCellNum, RuleIndex: -1, Value: 25, Max: 24}},
+		{&CompileOption{MaxExpansion: 4}, &CompileLimitError{Limit: CompileLimitExpansion, RuleIndex: 1, Value: 5, Max: 4}},
+	}
+	for _, testCase := range caseList {
+		_, err := CompileMDBitMapWithOption(context.Background(), schema, ruleList, testCase.option)
+		var limitError *CompileLimitError
+		if !errors.Is(err, ErrCompileLimitExceeded) || !errors.As(err, &limitError) || !reflect.DeepEqual(limitError, testCase.expect) {
+			t.Errorf("option %+v error %v, want %v", testCase.option, err, testCase.expect)
+		}
+	}
+}
+
+//未指定 CompileOption 时也限制元素个数
+func TestCompileDefaultLimit(t *testing.T) {
+	valueIndexMap := make(map[interface{}]int64)
+	for i := 0; i < 1<<16; i++ {
+		valueIndexMap[fmt.Sprint(i)] = int64(i)
+	}
+	schema, err := InitMDSchema(map[string]int64{"a": 0, "b": 1},
+		map[string]map[interface{}]int64{"a": valueIndexMap, "b": valueIndexMap}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleList := []*MDRule{{ConditionList: []*MDCondition{{Function: "a", ValueList: []interface{}{"1"}}}}}
+	expect := &CompileLimitError{Limit: CompileLimitCellNum, RuleIndex: -1, Value: 1 << 32, Max: DefaultCompileMaxCellNum}
+	_, err = CompileMDBitMap(schema, ruleList)
+	var limitError *CompileLimitError
+	if !errors.As(err, &limitError) || !reflect.DeepEqual(limitError, expect) {
+		t.Fatalf("CompileMDBitMap() error %v, want %v", err, expect)
+	}
+	if _, err := InitPolicyCache(nil).GetOrCompile(schema, ruleList); !errors.Is(err, ErrCompileLimitExceeded) {
+		t.Fatalf("PolicyCache without option error %v", err)
+	}
+}
+
+// countdownContext 前 n 次调用 Err 返回 nil，之后返回 context.Canceled
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCompileMDBitMapCancel(t *testing.T) {
+	schema := newTestSchema(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CompileMDBitMapWithOption(ctx, schema, getTestRuleList(t, testCompileRuleJSON), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled compile error %v", err)
+	}
+	//单条规则覆盖 2048*2 段不连续的位，编译前检查两次 ctx 后，在填充过程中取消
+	valueIndexMap := make(map[interface{}]int64)
+	for i := 0; i < 2048; i++ {
+		valueIndexMap[fmt.Sprint(i)] = int64(i)
+	}
+	schema, err := InitMDSchema(map[string]int64{"a": 0, "b": 1, "c": 2}, map[string]map[interface{}]int64{
+		"a": valueIndexMap, "b": {"b0": 0, "b1": 1}, "c": {"c0": 0, "c1": 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleList := []*MDRule{{ConditionList: []*MDCondition{{Function: "c", ValueList: []interface{}{"c0"}}}}}
+	if _, err := CompileMDBitMapWithOption(&countdownContext{Context: context.Background(), n: 2}, schema, ruleList, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("compile canceled inside a rule error %v", err)
+	}
+	bitMap, err := CompileMDBitMapWithOption(&countdownContext{Context: context.Background(), n: 100}, schema, ruleList, nil)
+	if err != nil || bitMap.CountMDBitMap() != 4096 {
+		t.Fatalf("compile = %v, %v", bitMap, err)
+	}
+}
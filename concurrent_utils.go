@@ -0,0 +1,140 @@
+package my_utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNilMDBitMap 位图为 nil
+var ErrNilMDBitMap = errors.New("md bitmap is nil")
+
+// ConcurrentMDBitMap 并发安全的 MDBitMap，适用于多个请求 goroutine 共享、偶尔热更新的权限位图
+/**
+ * @Description 内部持有一个不可变的位图快照：
+ *   读：Snapshot / Check / CheckValue 通过 atomic.Value 读取当前快照，无锁，不会被写操作阻塞
+ *   写：Store / Update / Or / And 在写锁下基于当前快照生成新位图（写时复制），生成完成后原子替换快照，
+ *       写操作之间串行执行，不会丢失更新；生成新位图失败时快照保持不变
+ * 内存模型：
+ *   1. 快照发布后不再被修改，写操作只会替换快照，不会修改已发布的快照
+ *   2. 快照的写入（atomic.Value.Store）happens-before 读到该快照的 Load，
+ *      因此读到快照的 goroutine 一定能看到该快照的完整内容
+ *   3. 读操作可能读到替换前的旧快照；同一次读操作内只读取一次快照，不会看到新旧混合的位图
+ *   4. Snapshot 返回的位图为只读，调用方不能修改；需要修改时先调用 CopyMDBitMap
+ *   5. 快照附加的 schema 与快照共用，schema 在投入使用后不能再修改
+ * 零值没有快照，Store 之前 Snapshot 返回 nil，其余操作返回 ErrNilMDBitMap；一般通过 InitConcurrentMDBitMap 构造
+ **/
+type ConcurrentMDBitMap struct {
+	// 当前快照，类型为 *MDBitMap
+	snapshot atomic.Value
+	// 串行化写操作
+	mutex sync.Mutex
+}
+
+// InitConcurrentMDBitMap 构造方法，拷贝 bitMap 作为初始快照，之后调用方对 bitMap 的修改不会影响快照
+func InitConcurrentMDBitMap(bitMap *MDBitMap) (*ConcurrentMDBitMap, error) {
+	if bitMap == nil {
+		return nil, ErrNilMDBitMap
+	}
+	concurrentMDBitMap := &ConcurrentMDBitMap{}
+	concurrentMDBitMap.snapshot.Store(bitMap.CopyMDBitMap())
+	return concurrentMDBitMap, nil
+}
+
+// Snapshot 返回当前快照，快照为只读，不能修改；零值未 Store 时返回 nil
+func (c *ConcurrentMDBitMap) Snapshot() *MDBitMap {
+	snapshot, _ := c.snapshot.Load().(*MDBitMap)
+	return snapshot
+}
+
+// Check 判断当前快照中下标 indexList 对应元素是否为 true
+func (c *ConcurrentMDBitMap) Check(indexList []int64) (bool, error) {
+	snapshot := c.Snapshot()
+	if snapshot == nil {
+		return false, ErrNilMDBitMap
+	}
+	return snapshot.CheckMDBitMap(indexList)
+}
+
+// CheckValue 根据维度取值判断当前快照中对应元素是否为 true，快照需附加 schema，取值转换规则见 MDSchema.GetIndexList
+func (c *ConcurrentMDBitMap) CheckValue(valueMap map[string]interface{}) (bool, error) {
+	snapshot := c.Snapshot()
+	if snapshot == nil {
+		return false, ErrNilMDBitMap
+	}
+	if snapshot.schema == nil {
+		return false, fmt.Errorf("%w: snapshot has no schema", ErrInvalidSchema)
+	}
+	indexList, err := snapshot.schema.GetIndexList(valueMap)
+	if err != nil {
+		return false, err
+	}
+	return snapshot.CheckMDBitMap(indexList)
+}
+
+// Store 热更新：拷贝 bitMap 并替换当前快照，位图结构可以与当前快照不同
+func (c *ConcurrentMDBitMap) Store(bitMap *MDBitMap) error {
+	if bitMap == nil {
+		return ErrNilMDBitMap
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.snapshot.Store(bitMap.CopyMDBitMap())
+	return nil
+}
+
+// Update 写时复制更新：fn 接收当前快照的拷贝，可直接修改并返回，也可返回新的位图；fn 返回错误时快照保持不变
+/**
+ * @Description fn 在写锁内执行，不能在 fn 中再调用当前 ConcurrentMDBitMap 的写操作，否则会死锁
+ **/
+func (c *ConcurrentMDBitMap) Update(fn func(bitMap *MDBitMap) (*MDBitMap, error)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	snapshot := c.Snapshot()
+	if snapshot == nil {
+		return ErrNilMDBitMap
+	}
+	bitMap, err := fn(snapshot.CopyMDBitMap())
+	if err != nil {
+		return err
+	}
+	if bitMap == nil {
+		return ErrNilMDBitMap
+	}
+	c.snapshot.Store(bitMap)
+	return nil
+}
+
+// Or 将当前快照与 targetBitMap 做或运算，结果作为新的快照
+func (c *ConcurrentMDBitMap) Or(targetBitMap *MDBitMap) error {
+	return c.swap(targetBitMap, func(snapshot *MDBitMap) (*MDBitMap, error) {
+		return snapshot.OrMDBitMap(targetBitMap)
+	})
+}
+
+// And 将当前快照与 targetBitMap 做与运算，结果作为新的快照
+func (c *ConcurrentMDBitMap) And(targetBitMap *MDBitMap) error {
+	return c.swap(targetBitMap, func(snapshot *MDBitMap) (*MDBitMap, error) {
+		return snapshot.AndMDBitMap(targetBitMap)
+	})
+}
+
+//在写锁内基于当前快照及 targetBitMap 生成新位图并替换，fn 不能修改传入的快照
+func (c *ConcurrentMDBitMap) swap(targetBitMap *MDBitMap, fn func(snapshot *MDBitMap) (*MDBitMap, error)) error {
+	if targetBitMap == nil {
+		return ErrNilMDBitMap
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	snapshot := c.Snapshot()
+	if snapshot == nil {
+		return ErrNilMDBitMap
+	}
+	bitMap, err := fn(snapshot)
+	if err != nil {
+		return err
+	}
+	c.snapshot.Store(bitMap)
+	return nil
+}
@@ -0,0 +1,93 @@
+package my_utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentMDBitMapZeroValue(t *testing.T) {
+	concurrentMDBitMap := &ConcurrentMDBitMap{}
+	if concurrentMDBitMap.Snapshot() != nil {
+		t.Fatal("zero value snapshot should be nil")
+	}
+	if _, err := concurrentMDBitMap.Check([]int64{0}); !errors.Is(err, ErrNilMDBitMap) {
+		t.Fatalf("Check error %v, want ErrNilMDBitMap", err)
+	}
+	err := concurrentMDBitMap.Update(func(bitMap *MDBitMap) (*MDBitMap, error) { return bitMap, nil })
+	if !errors.Is(err, ErrNilMDBitMap) {
+		t.Fatalf("Update error %v, want ErrNilMDBitMap", err)
+	}
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := concurrentMDBitMap.Or(bitMap); !errors.Is(err, ErrNilMDBitMap) {
+		t.Fatalf("Or error %v, want ErrNilMDBitMap", err)
+	}
+	if err := concurrentMDBitMap.Store(bitMap); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := concurrentMDBitMap.Check([]int64{1}); err != nil || value {
+		t.Fatalf("Check = %v, %v", value, err)
+	}
+}
+
+//使用 go test -race 运行：并发 Update 不丢失更新，并发读到的快照只增不减
+func TestConcurrentMDBitMapUpdateSnapshot(t *testing.T) {
+	const writerNum, updateNum, readerNum = 4, 50, 4
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{writerNum, updateNum}, nil); err != nil {
+		t.Fatal(err)
+	}
+	concurrentMDBitMap, err := InitConcurrentMDBitMap(bitMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var writerGroup, readerGroup sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < readerNum; i++ {
+		readerGroup.Add(1)
+		go func() {
+			defer readerGroup.Done()
+			lastCount := int64(0)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				count := concurrentMDBitMap.Snapshot().CountMDBitMap()
+				if count < lastCount {
+					t.Errorf("snapshot count decreased from %d to %d", lastCount, count)
+					return
+				}
+				lastCount = count
+			}
+		}()
+	}
+	for i := 0; i < writerNum; i++ {
+		writerGroup.Add(1)
+		go func(i int64) {
+			defer writerGroup.Done()
+			for j := int64(0); j < updateNum; j++ {
+				err := concurrentMDBitMap.Update(func(bitMap *MDBitMap) (*MDBitMap, error) {
+					return bitMap, bitMap.SetBox([][]int64{{i}, {j}})
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	writerGroup.Wait()
+	close(done)
+	readerGroup.Wait()
+	if count := concurrentMDBitMap.Snapshot().CountMDBitMap(); count != writerNum*updateNum {
+		t.Fatalf("count %d, want %d", count, writerNum*updateNum)
+	}
+	if bitMap.CountMDBitMap() != 0 {
+		t.Fatal("initial bitmap should not be modified")
+	}
+}
@@ -0,0 +1,201 @@
+package my_utils
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// MDCountMap 多维计数张量，与 MDBitMap 使用相同的维度、下标及 schema，每个元素为计数而不是 bool
+/**
+ * @Description 用于覆盖分析，如统计每个元素被多少个角色授权：
+ *   Add 将位图中为 true 的元素计数加 1，Threshold 将计数 >= minCount 的元素转换回位图（如"至少 2 个角色授权"）
+ *   Histogram 按维度统计每个槽位的计数之和，MaxByDimension / MinByDimension 按维度统计每个槽位的最大、最小计数
+ *   Max / Min 返回全部元素的最大、最小计数及第一个取到该计数的下标
+ * 计数按下标顺序平铺存储，每个元素占 8 字节；非并发安全
+ * @e.g.
+	lengthList: [2,3]
+	Add(A): 1 1 0    Add(B): 1 0 0    计数：2 1 0
+	        0 0 0            1 0 0          1 0 0
+	Threshold(2)：1 0 0，Histogram(0)：[3, 1]，MaxByDimension(1)：[2, 1, 0]
+	              0 0 0
+ **/
+type MDCountMap struct {
+	lengthList []int64
+	strideList []int64
+	countList  []int64
+	// 可选的 schema，Threshold 的结果附加该 schema
+	schema *MDSchema
+}
+
+// DefaultCountMapMaxCellNum 未指定 MDCountMapOption.MaxCellNum 时的元素个数上限，每个元素占 8 字节，即最多 128MB
+const DefaultCountMapMaxCellNum int64 = 1 << 24
+
+// MDCountMapOption 计数张量选项
+type MDCountMapOption struct {
+	// 元素个数上限，<=0 时使用 DefaultCountMapMaxCellNum；超过切片可分配的长度时按可分配的长度处理
+	MaxCellNum int64
+}
+
+// InitMDCountMap 构造方法，初始化全部计数为 0 的计数张量，option 可为 nil
+/**
+ * @Description 元素个数超过 option.MaxCellNum 时返回 *CellNumError，errors.Is 判断为 ErrCellNumTooLarge
+ **/
+func InitMDCountMap(lengthList []int64, option *MDCountMapOption) (*MDCountMap, error) {
+	if err := checkLengthList(lengthList); err != nil {
+		return nil, err
+	}
+	maxCellNum := DefaultCountMapMaxCellNum
+	if option != nil && option.MaxCellNum > 0 {
+		maxCellNum = option.MaxCellNum
+	}
+	if maxCellNum > int64(math.MaxInt/8) {
+		maxCellNum = int64(math.MaxInt / 8)
+	}
+	cellNum := getSaturatedCellNum(lengthList)
+	if cellNum > maxCellNum {
+		return nil, &CellNumError{LengthList: append([]int64{}, lengthList...), CellNum: cellNum, Max: maxCellNum}
+	}
+	countMap := &MDCountMap{lengthList: lengthList, strideList: getStrideList(lengthList)}
+	countMap.countList = make([]int64, cellNum)
+	return countMap, nil
+}
+
+// SetSchema 附加 schema，schema 的维度长度必须与计数张量一致；传入 nil 表示移除
+func (c *MDCountMap) SetSchema(schema *MDSchema) error {
+	if schema != nil {
+		if err := checkSameLengthList(schema.LengthList(), c.lengthList); err != nil {
+			return fmt.Errorf("%w: %v", ErrInconsistentSchema, err)
+		}
+	}
+	c.schema = schema
+	return nil
+}
+
+// Schema 返回附加的 schema，未附加时返回 nil
+func (c *MDCountMap) Schema() *MDSchema {
+	return c.schema
+}
+
+// LengthList 返回各维度长度
+func (c *MDCountMap) LengthList() []int64 {
+	lengthList := make([]int64, len(c.lengthList))
+	copy(lengthList, c.lengthList)
+	return lengthList
+}
+
+// Add 将位图中为 true 的元素计数加 1，结构不一致时返回 ErrInconsistentMap
+func (c *MDCountMap) Add(bitMap *MDBitMap) error {
+	if err := checkSameLengthList(c.lengthList, bitMap.lengthList); err != nil {
+		return err
+	}
+	for i, word := range bitMap.wordList {
+		//只遍历为 1 的位
+		for word != 0 {
+			c.countList[int64(i)<<6+int64(bits.TrailingZeros64(word))]++
+			word &= word - 1
+		}
+	}
+	return nil
+}
+
+// Get 返回下标 indexList 对应元素的计数
+func (c *MDCountMap) Get(indexList []int64) (int64, error) {
+	if err := checkIndexList(c.lengthList, indexList); err != nil {
+		return 0, err
+	}
+	offset := int64(0)
+	for i, index := range indexList {
+		offset += index * c.strideList[i]
+	}
+	return c.countList[offset], nil
+}
+
+// Threshold 将计数 >= minCount 的元素设置为 true，生成新位图
+func (c *MDCountMap) Threshold(minCount int64) *MDBitMap {
+	finalMDBitMap := &MDBitMap{lengthList: c.LengthList(), schema: c.schema}
+	finalMDBitMap.createEmptyMDBitmap()
+	for offset, count := range c.countList {
+		if count >= minCount {
+			finalMDBitMap.setBit(int64(offset))
+		}
+	}
+	return finalMDBitMap
+}
+
+// Histogram 按维度 dimension 统计每个槽位的计数之和，返回长度为该维度长度
+func (c *MDCountMap) Histogram(dimension int) ([]int64, error) {
+	return c.reduceByDimension(dimension, func(result int64, count int64) int64 {
+		return result + count
+	})
+}
+
+// MaxByDimension 按维度 dimension 统计每个槽位的最大计数，返回长度为该维度长度
+func (c *MDCountMap) MaxByDimension(dimension int) ([]int64, error) {
+	return c.reduceByDimension(dimension, func(result int64, count int64) int64 {
+		if count > result {
+			return count
+		}
+		return result
+	})
+}
+
+// MinByDimension 按维度 dimension 统计每个槽位的最小计数，返回长度为该维度长度
+func (c *MDCountMap) MinByDimension(dimension int) ([]int64, error) {
+	return c.reduceByDimension(dimension, func(result int64, count int64) int64 {
+		if count < result {
+			return count
+		}
+		return result
+	})
+}
+
+// Max 返回全部元素的最大计数及第一个取到该计数的下标
+func (c *MDCountMap) Max() (int64, []int64) {
+	return c.reduce(func(count int64, result int64) bool {
+		return count > result
+	})
+}
+
+// Min 返回全部元素的最小计数及第一个取到该计数的下标
+func (c *MDCountMap) Min() (int64, []int64) {
+	return c.reduce(func(count int64, result int64) bool {
+		return count < result
+	})
+}
+
+//按 better 选出的计数及其下标，相同时取下标顺序在前的元素
+func (c *MDCountMap) reduce(better func(count int64, result int64) bool) (int64, []int64) {
+	resultOffset := 0
+	for offset, count := range c.countList {
+		if better(count, c.countList[resultOffset]) {
+			resultOffset = offset
+		}
+	}
+	indexList := make([]int64, len(c.strideList))
+	remainOffset := int64(resultOffset)
+	for i, stride := range c.strideList {
+		indexList[i] = remainOffset / stride
+		remainOffset %= stride
+	}
+	return c.countList[resultOffset], indexList
+}
+
+//按维度 dimension 的槽位分组，依次用 fn 合并组内计数，每组以组内第一个计数为初始值
+func (c *MDCountMap) reduceByDimension(dimension int, fn func(result int64, count int64) int64) ([]int64, error) {
+	if dimension < 0 || dimension >= len(c.lengthList) {
+		return nil, fmt.Errorf("%w: dimension %d not in [0,%d)", ErrMDBitMapIndexOutOfRange, dimension, len(c.lengthList))
+	}
+	length, stride := c.lengthList[dimension], c.strideList[dimension]
+	resultList := make([]int64, length)
+	initList := make([]bool, length)
+	for offset, count := range c.countList {
+		slot := int64(offset) / stride % length
+		if !initList[slot] {
+			resultList[slot], initList[slot] = count, true
+			continue
+		}
+		resultList[slot] = fn(resultList[slot], count)
+	}
+	return resultList, nil
+}
@@ -0,0 +1,79 @@
+package my_utils
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMDCountMap(t *testing.T) {
+	countMap, err := InitMDCountMap([]int64{2, 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, indexListList := range [][][]int64{{{0, 0}, {0, 1}}, {{0, 0}, {1, 0}}} {
+		bitMap := &MDBitMap{}
+		if err := bitMap.InitMDBitMap([]int64{2, 3}, indexListList); err != nil {
+			t.Fatal(err)
+		}
+		if err := countMap.Add(bitMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectBitMap := &MDBitMap{}
+	if err := expectBitMap.InitMDBitMap([]int64{2, 3}, [][]int64{{0, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if !countMap.Threshold(2).EqualMDBitMap(expectBitMap) || countMap.Threshold(0).CountMDBitMap() != 6 {
+		t.Fatal("threshold mismatch")
+	}
+	histogram, _ := countMap.Histogram(0)
+	maxList, _ := countMap.MaxByDimension(1)
+	minList, _ := countMap.MinByDimension(0)
+	if !reflect.DeepEqual(histogram, []int64{3, 1}) || !reflect.DeepEqual(maxList, []int64{2, 1, 0}) || !reflect.DeepEqual(minList, []int64{0, 0}) {
+		t.Fatalf("histogram %v, max %v, min %v", histogram, maxList, minList)
+	}
+	maxCount, maxIndexList := countMap.Max()
+	minCount, minIndexList := countMap.Min()
+	if maxCount != 2 || !equalInt64List(maxIndexList, []int64{0, 0}) || minCount != 0 || !equalInt64List(minIndexList, []int64{0, 2}) {
+		t.Fatalf("max %d %v, min %d %v", maxCount, maxIndexList, minCount, minIndexList)
+	}
+	if count, err := countMap.Get([]int64{1, 0}); err != nil || count != 1 {
+		t.Fatalf("Get = %d, %v", count, err)
+	}
+	if _, err := countMap.Histogram(2); !errors.Is(err, ErrMDBitMapIndexOutOfRange) {
+		t.Fatalf("Histogram(2) error %v", err)
+	}
+}
+
+//元素个数过多或超过 int64 范围时返回错误，而不是 panic
+func TestInitMDCountMapLimit(t *testing.T) {
+	caseList := []struct {
+		lengthList []int64
+		option     *MDCountMapOption
+		max        int64
+	}{
+		{[]int64{DefaultCountMapMaxCellNum + 1}, nil, DefaultCountMapMaxCellNum},
+		{[]int64{1 << 20, 1 << 20}, &MDCountMapOption{}, DefaultCountMapMaxCellNum},
+		{[]int64{math.MaxInt64, math.MaxInt64, 2}, &MDCountMapOption{MaxCellNum: math.MaxInt64}, math.MaxInt / 8},
+		{[]int64{10, 10}, &MDCountMapOption{MaxCellNum: 99}, 99},
+	}
+	for _, testCase := range caseList {
+		_, err := InitMDCountMap(testCase.lengthList, testCase.option)
+		var cellNumError *CellNumError
+		if !errors.Is(err, ErrCellNumTooLarge) || errors.Is(err, ErrCompileLimitExceeded) || !errors.As(err, &cellNumError) {
+			t.Errorf("InitMDCountMap(%v) error %v", testCase.lengthList, err)
+			continue
+		}
+		if cellNumError.Max != testCase.max {
+			t.Errorf("InitMDCountMap(%v) max %d, want %d", testCase.lengthList, cellNumError.Max, testCase.max)
+		}
+	}
+	if _, err := InitMDCountMap([]int64{1024, 1024}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitMDCountMap([]int64{10, 10}, &MDCountMapOption{MaxCellNum: 100}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,362 @@
+package my_utils
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Decision 三态判断结果
+type Decision int
+
+const (
+	// DecisionUnspecified 没有规则决定结果，由调用方决定默认行为
+	DecisionUnspecified Decision = iota
+	DecisionAllow
+	DecisionDeny
+)
+
+var decisionNameList = []string{"unspecified", "allow", "deny"}
+
+func (d Decision) String() string {
+	if d < 0 || int(d) >= len(decisionNameList) {
+		return fmt.Sprintf("Decision(%d)", int(d))
+	}
+	return decisionNameList[d]
+}
+
+// MarshalText 序列化为 "unspecified" / "allow" / "deny"
+func (d Decision) MarshalText() ([]byte, error) {
+	if d < 0 || int(d) >= len(decisionNameList) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidEffect, int(d))
+	}
+	return []byte(decisionNameList[d]), nil
+}
+
+// UnmarshalText 从 "unspecified" / "allow" / "deny" 反序列化
+func (d *Decision) UnmarshalText(data []byte) error {
+	for i, name := range decisionNameList {
+		if name == string(data) {
+			*d = Decision(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidEffect, data)
+}
+
+// MDEffectRule 带效果的规则，命中规则的元素按 Effect 允许或拒绝
+type MDEffectRule struct {
+	// 规则名称，用于说明判断结果由哪条规则决定
+	Name   string   `json:"name,omitempty"`
+	Effect Decision `json:"effect"`
+	Rule   *MDRule  `json:"rule"`
+}
+
+// CombiningAlgorithm 组合算法，多条规则命中同一元素时决定最终结果
+/**
+ * @Description effectList 为全部规则的效果，matchIndexList 为命中元素的规则下标，升序；
+ * 返回最终结果及决定结果的规则下标，没有规则决定结果时下标为 -1
+ **/
+type CombiningAlgorithm func(effectList []Decision, matchIndexList []int) (Decision, int)
+
+// DenyOverrides 拒绝优先：任一命中的规则拒绝即拒绝，由第一条命中的拒绝规则决定；否则由第一条命中的允许规则决定
+func DenyOverrides(effectList []Decision, matchIndexList []int) (Decision, int) {
+	return overrideEffect(effectList, matchIndexList, DecisionDeny)
+}
+
+// AllowOverrides 允许优先：任一命中的规则允许即允许，由第一条命中的允许规则决定；否则由第一条命中的拒绝规则决定
+func AllowOverrides(effectList []Decision, matchIndexList []int) (Decision, int) {
+	return overrideEffect(effectList, matchIndexList, DecisionAllow)
+}
+
+// FirstApplicable 按规则顺序，由第一条命中的规则决定
+func FirstApplicable(effectList []Decision, matchIndexList []int) (Decision, int) {
+	if len(matchIndexList) == 0 {
+		return DecisionUnspecified, -1
+	}
+	return effectList[matchIndexList[0]], matchIndexList[0]
+}
+
+//effect 优先，其次为另一种效果
+func overrideEffect(effectList []Decision, matchIndexList []int, effect Decision) (Decision, int) {
+	for _, index := range matchIndexList {
+		if effectList[index] == effect {
+			return effect, index
+		}
+	}
+	if len(matchIndexList) == 0 {
+		return DecisionUnspecified, -1
+	}
+	return effectList[matchIndexList[0]], matchIndexList[0]
+}
+
+//内置组合算法，DecisionBitMap 可直接用掩码按位运算，不需要逐个元素判断
+type builtinAlgorithm int
+
+const (
+	algorithmCustom builtinAlgorithm = iota
+	algorithmDenyOverrides
+	algorithmAllowOverrides
+	algorithmFirstApplicable
+)
+
+//函数不能直接比较，按函数入口地址识别内置组合算法
+func getBuiltinAlgorithm(algorithm CombiningAlgorithm) builtinAlgorithm {
+	switch reflect.ValueOf(algorithm).Pointer() {
+	case reflect.ValueOf(DenyOverrides).Pointer():
+		return algorithmDenyOverrides
+	case reflect.ValueOf(AllowOverrides).Pointer():
+		return algorithmAllowOverrides
+	case reflect.ValueOf(FirstApplicable).Pointer():
+		return algorithmFirstApplicable
+	}
+	return algorithmCustom
+}
+
+// MDDecisionResult 三态判断结果及决定结果的规则
+type MDDecisionResult struct {
+	Decision Decision `json:"decision"`
+	// 决定结果的规则下标及名称，没有规则决定结果时下标为 -1
+	RuleIndex int    `json:"rule_index"`
+	RuleName  string `json:"rule_name,omitempty"`
+}
+
+// MDTriStatePolicy 三态策略，每个元素的结果为允许、拒绝或未指定
+/**
+ * @Description 由允许掩码、拒绝掩码两个 MDBitMap 及组合算法构成，掩码为对应效果的规则覆盖的元素之并；
+ * 同一元素同时被允许及拒绝规则命中时，由组合算法决定结果，如"禁止查看高管薪资"的拒绝规则在 DenyOverrides 下
+ * 优先于其他允许规则；Decide 同时返回决定结果的规则，便于说明原因
+ * 策略构建后不可修改，可并发判断
+ * @e.g.
+	规则：[{name: hr, effect: allow, rule: {dept in [HR]}}, {name: exec, effect: deny, rule: {level in [executive]}}]
+	DenyOverrides 下 HR 部门的高管薪资：deny，由规则 1 exec 决定
+	FirstApplicable 下：allow，由规则 0 hr 决定
+ **/
+type MDTriStatePolicy struct {
+	schema      *MDSchema
+	algorithm   CombiningAlgorithm
+	builtin     builtinAlgorithm
+	allowBitMap *MDBitMap
+	denyBitMap  *MDBitMap
+	nameList    []string
+	effectList  []Decision
+	// 规则覆盖的元素：编译生成的规则为盒子，由掩码构建的规则为位图
+	boxList    [][][]int64
+	bitMapList []*MDBitMap
+}
+
+// CompileMDTriStatePolicy 将带效果的规则列表编译为三态策略，规则格式见 CompileMDBitMap；algorithm 为 nil 时使用 DenyOverrides
+func CompileMDTriStatePolicy(schema *MDSchema, ruleList []*MDEffectRule, algorithm CombiningAlgorithm) (*MDTriStatePolicy, error) {
+	policy := newMDTriStatePolicy(schema, algorithm)
+	policy.allowBitMap, policy.denyBitMap = &MDBitMap{schema: schema}, &MDBitMap{schema: schema}
+	if err := policy.allowBitMap.InitMDBitMap(schema.LengthList(), nil); err != nil {
+		return nil, err
+	}
+	if err := policy.denyBitMap.InitMDBitMap(schema.LengthList(), nil); err != nil {
+		return nil, err
+	}
+	for i, effectRule := range ruleList {
+		if effectRule == nil {
+			return nil, fmt.Errorf("%w: effect rule %d is null", ErrInvalidCondition, i)
+		}
+		if effectRule.Effect != DecisionAllow && effectRule.Effect != DecisionDeny {
+			return nil, fmt.Errorf("%w: rule %d effect %v", ErrInvalidEffect, i, effectRule.Effect)
+		}
+		box, err := schema.getRuleBox(effectRule.Rule)
+		if err != nil {
+			return nil, err
+		}
+		if box != nil {
+			if err := policy.getEffectBitMap(effectRule.Effect).SetBox(box); err != nil {
+				return nil, err
+			}
+		}
+		policy.addRule(effectRule.Name, effectRule.Effect, box, nil)
+	}
+	return policy, nil
+}
+
+// InitMDTriStatePolicy 构造方法，由允许、拒绝两个掩码构建三态策略，掩码结构必须一致，algorithm 为 nil 时使用 DenyOverrides
+/**
+ * @Description 拒绝掩码为规则 0（名称 deny），允许掩码为规则 1（名称 allow），FirstApplicable 下拒绝优先；
+ * 策略附加允许掩码的 schema，掩码直接引用，不做拷贝，策略使用期间不能修改
+ **/
+func InitMDTriStatePolicy(allowBitMap *MDBitMap, denyBitMap *MDBitMap, algorithm CombiningAlgorithm) (*MDTriStatePolicy, error) {
+	if allowBitMap == nil || denyBitMap == nil {
+		return nil, ErrNilMDBitMap
+	}
+	if err := checkSameLengthList(allowBitMap.lengthList, denyBitMap.lengthList); err != nil {
+		return nil, err
+	}
+	policy := newMDTriStatePolicy(allowBitMap.schema, algorithm)
+	policy.allowBitMap, policy.denyBitMap = allowBitMap, denyBitMap
+	policy.addRule("deny", DecisionDeny, nil, denyBitMap)
+	policy.addRule("allow", DecisionAllow, nil, allowBitMap)
+	return policy, nil
+}
+
+// AllowBitMap 返回允许掩码，即允许规则覆盖的元素，只读
+func (p *MDTriStatePolicy) AllowBitMap() *MDBitMap {
+	return p.allowBitMap
+}
+
+// DenyBitMap 返回拒绝掩码，即拒绝规则覆盖的元素，只读
+func (p *MDTriStatePolicy) DenyBitMap() *MDBitMap {
+	return p.denyBitMap
+}
+
+// Decide 判断下标 indexList 对应元素的结果及决定结果的规则
+func (p *MDTriStatePolicy) Decide(indexList []int64) (*MDDecisionResult, error) {
+	if err := checkIndexList(p.allowBitMap.lengthList, indexList); err != nil {
+		return nil, err
+	}
+	return p.decide(indexList, p.allowBitMap.flatten(indexList)), nil
+}
+
+// DecideValue 根据维度取值判断结果，策略需附加 schema，取值转换规则见 MDSchema.GetIndexList
+func (p *MDTriStatePolicy) DecideValue(valueMap map[string]interface{}) (*MDDecisionResult, error) {
+	if p.schema == nil {
+		return nil, fmt.Errorf("%w: policy has no schema", ErrInvalidSchema)
+	}
+	indexList, err := p.schema.GetIndexList(valueMap)
+	if err != nil {
+		return nil, err
+	}
+	return p.Decide(indexList)
+}
+
+// DecisionBitMap 返回结果为 decision 的元素，如 DecisionBitMap(DecisionAllow) 为最终允许的元素，可用于生成 SQL 等
+/**
+ * @Description 自定义组合算法逐个元素判断，内置组合算法按 uint64 整段运算：
+ *   未指定：^(允许掩码 | 拒绝掩码)
+ *   DenyOverrides：拒绝为拒绝掩码，允许为 允许掩码 &^ 拒绝掩码；AllowOverrides 反之
+ *   FirstApplicable：按规则顺序，每条规则决定之前的规则都未命中的元素
+ **/
+func (p *MDTriStatePolicy) DecisionBitMap(decision Decision) *MDBitMap {
+	finalMDBitMap := p.allowBitMap.newEmptyMDBitMap()
+	finalMDBitMap.schema = p.schema
+	allowWordList, denyWordList := p.allowBitMap.wordList, p.denyBitMap.wordList
+	switch {
+	case p.builtin == algorithmCustom:
+		finalMDBitMap.rangeSubIndexList(nil, func(indexList []int64, offset int64) bool {
+			if p.decide(indexList, offset).Decision == decision {
+				finalMDBitMap.setBit(offset)
+			}
+			return true
+		})
+	case decision == DecisionUnspecified:
+		for i := range finalMDBitMap.wordList {
+			finalMDBitMap.wordList[i] = ^(allowWordList[i] | denyWordList[i])
+		}
+		finalMDBitMap.clearPadding()
+	case decision != DecisionAllow && decision != DecisionDeny:
+		//不合法的 decision 没有对应的元素
+	case p.builtin == algorithmDenyOverrides:
+		for i := range finalMDBitMap.wordList {
+			if decision == DecisionDeny {
+				finalMDBitMap.wordList[i] = denyWordList[i]
+			} else {
+				finalMDBitMap.wordList[i] = allowWordList[i] &^ denyWordList[i]
+			}
+		}
+	case p.builtin == algorithmAllowOverrides:
+		for i := range finalMDBitMap.wordList {
+			if decision == DecisionAllow {
+				finalMDBitMap.wordList[i] = allowWordList[i]
+			} else {
+				finalMDBitMap.wordList[i] = denyWordList[i] &^ allowWordList[i]
+			}
+		}
+	case p.builtin == algorithmFirstApplicable:
+		p.fillFirstApplicable(finalMDBitMap, decision)
+	}
+	return finalMDBitMap
+}
+
+//按规则顺序，将效果为 decision 的规则覆盖、且之前的规则都未覆盖的元素设置为 true
+func (p *MDTriStatePolicy) fillFirstApplicable(finalMDBitMap *MDBitMap, decision Decision) {
+	//之前的规则覆盖的元素，及盒子规则展开的位图
+	decidedBitMap, boxBitMap := p.allowBitMap.newEmptyMDBitMap(), p.allowBitMap.newEmptyMDBitMap()
+	for ruleIndex, effect := range p.effectList {
+		ruleBitMap := p.bitMapList[ruleIndex]
+		if ruleBitMap == nil {
+			if p.boxList[ruleIndex] == nil {
+				continue
+			}
+			for i := range boxBitMap.wordList {
+				boxBitMap.wordList[i] = 0
+			}
+			//盒子在编译时已校验
+			_ = boxBitMap.SetBox(p.boxList[ruleIndex])
+			ruleBitMap = boxBitMap
+		}
+		for i, word := range ruleBitMap.wordList {
+			if effect == decision {
+				finalMDBitMap.wordList[i] |= word &^ decidedBitMap.wordList[i]
+			}
+			decidedBitMap.wordList[i] |= word
+		}
+	}
+}
+
+func newMDTriStatePolicy(schema *MDSchema, algorithm CombiningAlgorithm) *MDTriStatePolicy {
+	if algorithm == nil {
+		algorithm = DenyOverrides
+	}
+	return &MDTriStatePolicy{schema: schema, algorithm: algorithm, builtin: getBuiltinAlgorithm(algorithm)}
+}
+
+func (p *MDTriStatePolicy) addRule(name string, effect Decision, box [][]int64, bitMap *MDBitMap) {
+	p.nameList = append(p.nameList, name)
+	p.effectList = append(p.effectList, effect)
+	p.boxList = append(p.boxList, box)
+	p.bitMapList = append(p.bitMapList, bitMap)
+}
+
+func (p *MDTriStatePolicy) getEffectBitMap(effect Decision) *MDBitMap {
+	if effect == DecisionDeny {
+		return p.denyBitMap
+	}
+	return p.allowBitMap
+}
+
+//调用方需保证下标合法，offset 为下标的平铺偏移量
+func (p *MDTriStatePolicy) decide(indexList []int64, offset int64) *MDDecisionResult {
+	matchIndexList := make([]int, 0)
+	//两个掩码都不包含该元素时，没有规则命中
+	if p.allowBitMap.getBit(offset) || p.denyBitMap.getBit(offset) {
+		for i := range p.effectList {
+			if p.matchRule(i, indexList, offset) {
+				matchIndexList = append(matchIndexList, i)
+			}
+		}
+	}
+	decision, ruleIndex := p.algorithm(p.effectList, matchIndexList)
+	result := &MDDecisionResult{Decision: decision, RuleIndex: ruleIndex}
+	if ruleIndex >= 0 {
+		result.RuleName = p.nameList[ruleIndex]
+	}
+	return result
+}
+
+//规则 ruleIndex 是否命中元素
+func (p *MDTriStatePolicy) matchRule(ruleIndex int, indexList []int64, offset int64) bool {
+	if p.bitMapList[ruleIndex] != nil {
+		return p.bitMapList[ruleIndex].getBit(offset)
+	}
+	box := p.boxList[ruleIndex]
+	if box == nil {
+		return false
+	}
+	for i, slotList := range box {
+		if slotList == nil {
+			continue
+		}
+		//盒子的槽位列表升序
+		j := sort.Search(len(slotList), func(j int) bool { return slotList[j] >= indexList[i] })
+		if j == len(slotList) || slotList[j] != indexList[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+//规则：0 sg 允许 country=SG，1 rich 拒绝 salary>5000，2 th 允许 country=TH
+const testEffectRuleJSON = `[
+	{"name":"sg","effect":"allow","rule":{"condition_list":[{"function":"country","value_list":["SG"]}]}},
+	{"name":"rich","effect":"deny","rule":{"condition_list":[{"function":"salary","operator":"gt","value_list":[5000]}]}},
+	{"name":"th","effect":"allow","rule":{"condition_list":[{"function":"country","value_list":["TH"]}]}}]`
+
+func newTestEffectRuleList(t testing.TB) []*MDEffectRule {
+	t.Helper()
+	ruleList := make([]*MDEffectRule, 0)
+	if err := json.Unmarshal([]byte(testEffectRuleJSON), &ruleList); err != nil {
+		t.Fatal(err)
+	}
+	return ruleList
+}
+
+func TestCombiningAlgorithm(t *testing.T) {
+	schema := newTestSchema(t)
+	ruleList := newTestEffectRuleList(t)
+	type expectResult struct {
+		decision Decision
+		ruleName string
+	}
+	valueMapList := []map[string]interface{}{
+		{"country": "SG", "salary": 9000},
+		{"country": "MY", "salary": 100},
+		{"country": "MY", "salary": 9000},
+		{"country": "TH", "salary": 100},
+	}
+	caseList := []struct {
+		name       string
+		algorithm  CombiningAlgorithm
+		resultList []expectResult
+	}{
+		{"deny_overrides", DenyOverrides, []expectResult{{DecisionDeny, "rich"}, {DecisionUnspecified, ""}, {DecisionDeny, "rich"}, {DecisionAllow, "th"}}},
+		{"allow_overrides", AllowOverrides, []expectResult{{DecisionAllow, "sg"}, {DecisionUnspecified, ""}, {DecisionDeny, "rich"}, {DecisionAllow, "th"}}},
+		{"first_applicable", FirstApplicable, []expectResult{{DecisionAllow, "sg"}, {DecisionUnspecified, ""}, {DecisionDeny, "rich"}, {DecisionAllow, "th"}}},
+	}
+	for _, testCase := range caseList {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, err := CompileMDTriStatePolicy(schema, ruleList, testCase.algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, valueMap := range valueMapList {
+				result, err := policy.DecideValue(valueMap)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expect := testCase.resultList[i]
+				if result.Decision != expect.decision || result.RuleName != expect.ruleName {
+					t.Errorf("DecideValue(%v) = %+v, want %+v", valueMap, result, expect)
+				}
+			}
+		})
+	}
+}
+
+//内置组合算法按位运算的结果与逐个元素判断一致，三种结果互不相交且覆盖全部元素
+func TestDecisionBitMap(t *testing.T) {
+	schema := newTestSchema(t)
+	r := rand.New(rand.NewSource(1))
+	ruleList := newTestEffectRuleList(t)
+	//再加入随机规则，覆盖规则之间相互重叠的情况
+	for i := 0; i < 4; i++ {
+		effect := DecisionAllow
+		if r.Intn(2) == 0 {
+			effect = DecisionDeny
+		}
+		conditionList := []*MDCondition{{Function: "country", ValueList: []interface{}{[]string{"SG", "MY", "TH"}[r.Intn(3)], OtherValue}}}
+		if r.Intn(2) == 0 {
+			conditionList = append(conditionList, &MDCondition{Function: "salary", Operator: OperatorLTE, ValueList: []interface{}{5000}})
+		}
+		ruleList = append(ruleList, &MDEffectRule{Effect: effect, Rule: &MDRule{ConditionList: conditionList}})
+	}
+	for _, algorithm := range []CombiningAlgorithm{DenyOverrides, AllowOverrides, FirstApplicable} {
+		policy, err := CompileMDTriStatePolicy(schema, ruleList, algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//自定义组合算法逐个元素判断
+		customPolicy, err := CompileMDTriStatePolicy(schema, ruleList, func(effectList []Decision, matchIndexList []int) (Decision, int) {
+			return algorithm(effectList, matchIndexList)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.builtin == algorithmCustom || customPolicy.builtin != algorithmCustom {
+			t.Fatal("builtin algorithm not detected")
+		}
+		unionBitMap := policy.DecisionBitMap(DecisionUnspecified)
+		for _, decision := range []Decision{DecisionAllow, DecisionDeny, DecisionUnspecified} {
+			decisionBitMap := policy.DecisionBitMap(decision)
+			if !decisionBitMap.EqualMDBitMap(customPolicy.DecisionBitMap(decision)) {
+				t.Fatalf("%v bitmap mismatch", decision)
+			}
+			if decision == DecisionUnspecified {
+				continue
+			}
+			if intersection, _ := unionBitMap.AndMDBitMap(decisionBitMap); intersection.CountMDBitMap() != 0 {
+				t.Fatalf("%v bitmap overlaps", decision)
+			}
+			unionBitMap, _ = unionBitMap.OrMDBitMap(decisionBitMap)
+		}
+		if unionBitMap.CountMDBitMap() != unionBitMap.getCellCount() {
+			t.Fatal("decision bitmaps should cover every cell")
+		}
+		if policy.DecisionBitMap(Decision(9)).CountMDBitMap() != 0 {
+			t.Fatal("invalid decision should be empty")
+		}
+	}
+}
+
+func TestInitMDTriStatePolicy(t *testing.T) {
+	schema := newTestSchema(t)
+	policy, err := CompileMDTriStatePolicy(schema, newTestEffectRuleList(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maskPolicy, err := InitMDTriStatePolicy(policy.AllowBitMap(), policy.DenyBitMap(), FirstApplicable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//FirstApplicable 下拒绝掩码为规则 0
+	result, err := maskPolicy.DecideValue(map[string]interface{}{"country": "SG", "salary": 9000})
+	if err != nil || result.Decision != DecisionDeny || result.RuleName != "deny" {
+		t.Fatalf("DecideValue = %+v, %v", result, err)
+	}
+	if !maskPolicy.DecisionBitMap(DecisionAllow).EqualMDBitMap(policy.DecisionBitMap(DecisionAllow)) {
+		t.Fatal("mask policy allow bitmap mismatch")
+	}
+	ruleList := newTestEffectRuleList(t)
+	ruleList[0].Effect = DecisionUnspecified
+	if _, err := CompileMDTriStatePolicy(schema, ruleList, nil); !errors.Is(err, ErrInvalidEffect) {
+		t.Fatalf("invalid effect error %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package my_utils
+
+import "encoding/json"
+
+// DefaultMaxDiffCellNum 默认最多列出的差异元素个数
+const DefaultMaxDiffCellNum = 1000
+
+// MDDiffOption 差异配置
+type MDDiffOption struct {
+	// 每个方向最多列出的差异元素个数，<=0 时使用 DefaultMaxDiffCellNum；规则及计数不受影响
+	MaxCellNum int
+}
+
+// MDDiff 两个版本位图之间的差异，可直接 json 序列化写入审计日志
+type MDDiff struct {
+	// 合并后的 schema 及基于该 schema 的新增、删除位图
+	Schema  *MDSchema `json:"-"`
+	Added   *MDBitMap `json:"-"`
+	Removed *MDBitMap `json:"-"`
+
+	AddedCellCount   int64 `json:"added_cell_count"`
+	RemovedCellCount int64 `json:"removed_cell_count"`
+	// 新增、删除元素的最简规则及其字符串表示
+	AddedRuleList      []*MDRule `json:"added_rule_list"`
+	RemovedRuleList    []*MDRule `json:"removed_rule_list"`
+	AddedSummaryList   []string  `json:"added_summary_list"`
+	RemovedSummaryList []string  `json:"removed_summary_list"`
+	// 新增、删除的元素，维度 → 标签（离散维度为取值，范围维度为区间字符串），最多 MaxCellNum 个
+	AddedCellList   []map[string]interface{} `json:"added_cell_list"`
+	RemovedCellList []map[string]interface{} `json:"removed_cell_list"`
+	// 差异元素个数超过 MaxCellNum 时为 true
+	Truncated bool `json:"truncated"`
+}
+
+// DiffMDBitMap 比较同一策略的新旧两个版本
+/**
+ * @Description 先将两个 schema 合并（取值取并集，维度顺序以 newSchema 为准），再将新旧位图转换到合并后的 schema 上比较，
+ * 因此 schema 新增取值、新增范围边界值或删除取值时均可比较；两个 schema 的维度及维度类型必须一致
+ * @Param oldBitMap/oldSchema 旧版本， newBitMap/newSchema 新版本， option 可为 nil
+ * @e.g.
+	旧：{country in [SG]}，新：{country in [SG, MY], salary in (5000,+inf)}
+	AddedSummaryList: ["country=MY, salary in (5000,+inf)"]，RemovedSummaryList: []
+ **/
+func DiffMDBitMap(oldBitMap *MDBitMap, oldSchema *MDSchema, newBitMap *MDBitMap, newSchema *MDSchema, option *MDDiffOption) (*MDDiff, error) {
+	schema, err := mergeMDSchema(oldSchema, newSchema)
+	if err != nil {
+		return nil, err
+	}
+	oldRemapBitMap, err := oldBitMap.RemapMDBitMap(oldSchema, schema)
+	if err != nil {
+		return nil, err
+	}
+	newRemapBitMap, err := newBitMap.RemapMDBitMap(newSchema, schema)
+	if err != nil {
+		return nil, err
+	}
+	maxCellNum := DefaultMaxDiffCellNum
+	if option != nil && option.MaxCellNum > 0 {
+		maxCellNum = option.MaxCellNum
+	}
+	diff := &MDDiff{Schema: schema}
+	if diff.Added, err = newRemapBitMap.AndMDBitMap(oldRemapBitMap.NotMDBitMap()); err != nil {
+		return nil, err
+	}
+	if diff.Removed, err = oldRemapBitMap.AndMDBitMap(newRemapBitMap.NotMDBitMap()); err != nil {
+		return nil, err
+	}
+	var addedTruncated, removedTruncated bool
+	diff.AddedRuleList, diff.AddedSummaryList, diff.AddedCellList, diff.AddedCellCount, addedTruncated = diff.Added.getDiffDetail(schema, maxCellNum)
+	diff.RemovedRuleList, diff.RemovedSummaryList, diff.RemovedCellList, diff.RemovedCellCount, removedTruncated = diff.Removed.getDiffDetail(schema, maxCellNum)
+	diff.Truncated = addedTruncated || removedTruncated
+	return diff, nil
+}
+
+// IsEmpty 判断新旧版本是否没有差异
+func (d *MDDiff) IsEmpty() bool {
+	return d.AddedCellCount == 0 && d.RemovedCellCount == 0
+}
+
+// ToJSON 序列化为 json
+func (d *MDDiff) ToJSON() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+//获取差异位图的规则、规则字符串、带标签的元素列表（最多 maxCellNum 个）及元素个数
+func (m *MDBitMap) getDiffDetail(schema *MDSchema, maxCellNum int) ([]*MDRule, []string, []map[string]interface{}, int64, bool) {
+	boxList := m.getMinimalBoxList(make([]int64, 0, len(m.lengthList)))
+	ruleList := make([]*MDRule, 0, len(boxList))
+	summaryList := make([]string, 0, len(boxList))
+	for _, box := range boxList {
+		rule := schema.boxToRule(box)
+		ruleList = append(ruleList, rule)
+		summaryList = append(summaryList, rule.String())
+	}
+	cellList := make([]map[string]interface{}, 0)
+	cellCount := int64(0)
+	m.rangeSubIndexList(nil, func(indexList []int64, offset int64) bool {
+		if !m.getBit(offset) {
+			return true
+		}
+		cellCount++
+		if len(cellList) < maxCellNum {
+			cell := make(map[string]interface{}, len(indexList))
+			for i, slot := range indexList {
+				cell[schema.functionList[i]] = schema.getSlotLabel(schema.functionList[i], slot)
+			}
+			cellList = append(cellList, cell)
+		}
+		return true
+	})
+	return ruleList, summaryList, cellList, cellCount, cellCount > int64(maxCellNum)
+}
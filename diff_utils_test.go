@@ -0,0 +1,114 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestDiffSchema(t *testing.T, schemaJSON string) *MDSchema {
+	t.Helper()
+	schema := &MDSchema{}
+	if err := json.Unmarshal([]byte(schemaJSON), schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+//新版本 schema 删除取值 TH、新增取值 MY 及边界值 5000，合并后的 schema 为取值、边界值的并集
+func TestDiffMDBitMapSchemaChange(t *testing.T) {
+	oldSchema := newTestDiffSchema(t, `{"function_list":[
+		{"function":"country","type":"discrete","value_list":["SG","TH"]},
+		{"function":"salary","type":"range","boundary_list":[1000]}]}`)
+	newSchema := newTestDiffSchema(t, `{"function_list":[
+		{"function":"country","type":"discrete","value_list":["SG","MY"]},
+		{"function":"salary","type":"range","boundary_list":[1000,5000]}]}`)
+	oldBitMap := compileTestRuleList(t, oldSchema, `[{"condition_list":[{"function":"country","value_list":["SG","TH"]},{"function":"salary","operator":"gte","value_list":[1000]}]}]`)
+	newBitMap := compileTestRuleList(t, newSchema, `[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+		{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"lt","value_list":[1000]}]}]`)
+	diff, err := DiffMDBitMap(oldBitMap, oldSchema, newBitMap, newSchema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lengthList := diff.Schema.LengthList(); !equalInt64List(lengthList, []int64{3, 5}) {
+		t.Fatalf("merged length list %v", lengthList)
+	}
+	if diff.IsEmpty() || diff.Truncated {
+		t.Fatalf("empty %v, truncated %v", diff.IsEmpty(), diff.Truncated)
+	}
+	if !reflect.DeepEqual(diff.AddedSummaryList, []string{"country=SG, salary in (-inf,1000)", "country=MY, salary in [1000,+inf)"}) ||
+		diff.AddedCellCount != 5 || len(diff.AddedCellList) != 5 {
+		t.Fatalf("added %d %v", diff.AddedCellCount, diff.AddedSummaryList)
+	}
+	if !reflect.DeepEqual(diff.RemovedSummaryList, []string{"country=TH, salary in [1000,+inf)"}) ||
+		diff.RemovedCellCount != 4 || len(diff.RemovedCellList) != 4 {
+		t.Fatalf("removed %d %v", diff.RemovedCellCount, diff.RemovedSummaryList)
+	}
+	if cell := diff.RemovedCellList[0]; cell["country"] != "TH" || cell["salary"] != "[1000,1000]" {
+		t.Fatalf("removed cell %v", cell)
+	}
+	//差异规则在合并后的 schema 上编译，与新增、删除位图一致
+	for _, testCase := range []struct {
+		ruleList []*MDRule
+		bitMap   *MDBitMap
+	}{
+		{diff.AddedRuleList, diff.Added},
+		{diff.RemovedRuleList, diff.Removed},
+	} {
+		bitMap, err := CompileMDBitMap(diff.Schema, testCase.ruleList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bitMap.EqualMDBitMap(testCase.bitMap) {
+			t.Fatalf("diff rule list %v mismatch", testCase.ruleList)
+		}
+	}
+	data, err := diff.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["added_cell_count"] != float64(5) || result["removed_cell_count"] != float64(4) || result["truncated"] != false {
+		t.Fatalf("diff json %s", data)
+	}
+}
+
+func TestDiffMDBitMap(t *testing.T) {
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG",null]}]}]`)
+	diff, err := DiffMDBitMap(bitMap, schema, bitMap.CopyMDBitMap(), schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.IsEmpty() || len(diff.AddedRuleList) != 0 || len(diff.RemovedCellList) != 0 {
+		t.Fatalf("diff of same bitmap %+v", diff)
+	}
+	//元素个数超过 MaxCellNum 时截断元素列表，规则及计数不受影响
+	diff, err = DiffMDBitMap(bitMap, schema, bitMap.NotMDBitMap(), schema, &MDDiffOption{MaxCellNum: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Truncated || diff.AddedCellCount != 15 || diff.RemovedCellCount != 10 ||
+		len(diff.AddedCellList) != 3 || len(diff.RemovedCellList) != 3 {
+		t.Fatalf("truncated %v, added %d %d, removed %d %d", diff.Truncated,
+			diff.AddedCellCount, len(diff.AddedCellList), diff.RemovedCellCount, len(diff.RemovedCellList))
+	}
+	if !reflect.DeepEqual(diff.RemovedSummaryList, []string{"country in [SG, <nil>]"}) {
+		t.Fatalf("removed summary %v", diff.RemovedSummaryList)
+	}
+	//维度类型不一致时无法合并
+	rangeSchema := newTestDiffSchema(t, `{"function_list":[
+		{"function":"country","type":"range","boundary_list":[1, 2, 3]},
+		{"function":"salary","type":"range","boundary_list":[1000,5000]}]}`)
+	rangeBitMap := &MDBitMap{}
+	if err := rangeBitMap.InitMDBitMap(rangeSchema.LengthList(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DiffMDBitMap(bitMap, schema, rangeBitMap, rangeSchema, nil); !errors.Is(err, ErrInconsistentSchema) {
+		t.Fatalf("merge error %v", err)
+	}
+}
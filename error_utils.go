@@ -0,0 +1,159 @@
+package my_utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MDBitMap 基础操作的错误，可用 errors.Is 判断；带上下文的错误类型可用 errors.As 获取出错的维度、下标及长度
+var (
+	// ErrLengthListEmpty 维度长度列表为空
+	ErrLengthListEmpty = errors.New("md bitmap length list empty")
+	// ErrDimensionLengthTooSmall 维度长度 <= 0，具体错误为 *DimensionLengthError
+	ErrDimensionLengthTooSmall = errors.New("md bitmap dimension length too small")
+	// ErrInconsistentLength 下标个数与维度个数不一致，具体错误为 *InconsistentLengthError
+	ErrInconsistentLength = errors.New("md bitmap index list length inconsistent with dimension count")
+	// ErrMDBitMapIndexOutOfRange 下标越界，具体错误为 *IndexOutOfRangeError
+	ErrMDBitMapIndexOutOfRange = errors.New("md bitmap index out of range")
+	// ErrInconsistentMap 两个位图结构不一致，具体错误为 *InconsistentMapError
+	ErrInconsistentMap = errors.New("md bitmap structure inconsistent")
+	// ErrCellNumTooLarge 元素个数超过位图、计数张量的上限或 int64 范围，具体错误为 *CellNumError
+	ErrCellNumTooLarge = errors.New("md bitmap cell count too large")
+)
+
+// ErrInvalidEffect 规则效果或三态判断结果不合法，规则效果只能是 allow 或 deny
+var ErrInvalidEffect = errors.New("invalid md rule effect")
+
+// DimensionLengthError 维度长度不合法
+type DimensionLengthError struct {
+	// 维度下标
+	Dimension int
+	Length    int64
+}
+
+func (e *DimensionLengthError) Error() string {
+	return fmt.Sprintf("%v: dimension %d length %d", ErrDimensionLengthTooSmall, e.Dimension, e.Length)
+}
+
+// Unwrap 返回 ErrDimensionLengthTooSmall
+func (e *DimensionLengthError) Unwrap() error {
+	return ErrDimensionLengthTooSmall
+}
+
+// InconsistentLengthError 下标个数与维度个数不一致
+type InconsistentLengthError struct {
+	IndexList []int64
+	// 维度个数
+	DimensionNum int
+}
+
+func (e *InconsistentLengthError) Error() string {
+	return fmt.Sprintf("%v: index list %v, dimension count %d", ErrInconsistentLength, e.IndexList, e.DimensionNum)
+}
+
+// Unwrap 返回 ErrInconsistentLength
+func (e *InconsistentLengthError) Unwrap() error {
+	return ErrInconsistentLength
+}
+
+// IndexOutOfRangeError 下标越界
+type IndexOutOfRangeError struct {
+	IndexList []int64
+	// 越界的维度下标及该维度的下标、长度；平铺偏移量越界时 Dimension 为 -1，Index 为偏移量，Length 为元素总数
+	Dimension int
+	Index     int64
+	Length    int64
+}
+
+func (e *IndexOutOfRangeError) Error() string {
+	if e.Dimension < 0 {
+		return fmt.Sprintf("%v: offset %d not in [0,%d)", ErrMDBitMapIndexOutOfRange, e.Index, e.Length)
+	}
+	return fmt.Sprintf("%v: index list %v, index %d of dimension %d not in [0,%d)", ErrMDBitMapIndexOutOfRange, e.IndexList, e.Index, e.Dimension, e.Length)
+}
+
+// Unwrap 返回 ErrMDBitMapIndexOutOfRange
+func (e *IndexOutOfRangeError) Unwrap() error {
+	return ErrMDBitMapIndexOutOfRange
+}
+
+// InconsistentMapError 两个位图结构不一致
+type InconsistentMapError struct {
+	LengthList       []int64
+	TargetLengthList []int64
+}
+
+func (e *InconsistentMapError) Error() string {
+	return fmt.Sprintf("%v: length list %v, target length list %v", ErrInconsistentMap, e.LengthList, e.TargetLengthList)
+}
+
+// Unwrap 返回 ErrInconsistentMap
+func (e *InconsistentMapError) Unwrap() error {
+	return ErrInconsistentMap
+}
+
+// CellNumError 各维度长度的乘积超过元素个数上限，位图见 InitMDBitMap，计数张量见 InitMDCountMap
+type CellNumError struct {
+	LengthList []int64
+	// 元素个数，超过 int64 范围时为 math.MaxInt64
+	CellNum int64
+	Max     int64
+}
+
+func (e *CellNumError) Error() string {
+	return fmt.Sprintf("%v: length list %v, cell count %d exceeds %d", ErrCellNumTooLarge, e.LengthList, e.CellNum, e.Max)
+}
+
+// Unwrap 返回 ErrCellNumTooLarge
+func (e *CellNumError) Unwrap() error {
+	return ErrCellNumTooLarge
+}
+
+//校验维度长度列表非空，且任一维度的 长度不能<=0
+func checkLengthList(lengthList []int64) error {
+	if len(lengthList) == 0 {
+		return ErrLengthListEmpty
+	}
+	for i, length := range lengthList {
+		if length <= 0 {
+			return &DimensionLengthError{Dimension: i, Length: length}
+		}
+	}
+	return nil
+}
+
+//校验各维度长度的乘积不超过 maxCellNum，且位数组长度不超过 int 范围，调用方需先通过 checkLengthList
+func checkCellNum(lengthList []int64) error {
+	cellNum := getSaturatedCellNum(lengthList)
+	if cellNum > maxCellNum || getWordNum(cellNum) > int64(math.MaxInt/8) {
+		return &CellNumError{LengthList: append([]int64{}, lengthList...), CellNum: cellNum, Max: maxCellNum}
+	}
+	return nil
+}
+
+//校验下标个数及范围，下标合法时返回 nil
+func checkIndexList(lengthList []int64, indexList []int64) error {
+	if len(indexList) != len(lengthList) {
+		return &InconsistentLengthError{IndexList: append([]int64{}, indexList...), DimensionNum: len(lengthList)}
+	}
+	for i, index := range indexList {
+		if index < 0 || index >= lengthList[i] {
+			return &IndexOutOfRangeError{IndexList: append([]int64{}, indexList...), Dimension: i, Index: index, Length: lengthList[i]}
+		}
+	}
+	return nil
+}
+
+//校验两个位图结构一致
+func checkSameLengthList(lengthList []int64, targetLengthList []int64) error {
+	if len(lengthList) != len(targetLengthList) {
+		return &InconsistentMapError{LengthList: append([]int64{}, lengthList...), TargetLengthList: append([]int64{}, targetLengthList...)}
+	}
+	for i := range lengthList {
+		if lengthList[i] != targetLengthList[i] {
+			return &InconsistentMapError{LengthList: append([]int64{}, lengthList...), TargetLengthList: append([]int64{}, targetLengthList...)}
+		}
+	}
+	return nil
+}
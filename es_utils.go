@@ -0,0 +1,179 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrESFieldNotFound 维度没有配置对应的字段名
+	ErrESFieldNotFound = errors.New("es field of function not found")
+	// ErrESTermsTooLarge terms 列表长度超过上限
+	ErrESTermsTooLarge = errors.New("es terms too large")
+)
+
+// DefaultESMaxTermsSize 默认 terms 列表长度上限，与 ES index.max_terms_count 默认值一致
+const DefaultESMaxTermsSize = 65536
+
+// ESOption 生成 Elasticsearch / OpenSearch 查询的配置
+type ESOption struct {
+	// 维度 → 字段名，离散维度应为 keyword 类型字段
+	FieldMap map[string]string
+	// 单个 terms 列表的长度上限，<=0 时使用 DefaultESMaxTermsSize
+	MaxTermsSize int
+}
+
+// ToESQuery 将 MDBitMap 转换为 Elasticsearch bool 查询
+/**
+ * @Description 先反编译为最简规则列表，规则之间为 bool.should，规则内各维度条件为 bool.filter
+ * 离散维度生成 terms，取值 nil 生成 must_not exists；范围维度按区间开闭生成 range 的 gt/gte/lt/lte，单点区间生成 term
+ * 位图全为 false 时返回 match_none，全为 true 时返回 match_all
+ * 返回值只包含 map / slice / 基础类型，json 序列化时 key 有序，可直接与 golden 文件比对，见 testdata/es_*.golden
+ * @e.g.
+	country 取值 [SG, MY, TH]，salary 边界值 [5000]
+	规则 {country in [SG, MY], salary in (5000,+∞)}
+	返回：{"bool":{"filter":[{"terms":{"country":["SG","MY"]}},{"range":{"salary":{"gt":5000}}}]}}
+ **/
+func (m *MDBitMap) ToESQuery(schema *MDSchema, option *ESOption) (map[string]interface{}, error) {
+	ruleList, err := m.ToMinimalRuleList(schema)
+	if err != nil {
+		return nil, err
+	}
+	if option == nil {
+		option = &ESOption{}
+	}
+	if len(ruleList) == 0 {
+		return map[string]interface{}{"match_none": map[string]interface{}{}}, nil
+	}
+	ruleQueryList := make([]interface{}, 0, len(ruleList))
+	for _, rule := range ruleList {
+		//规则不限制任何维度，说明位图全为 true
+		if len(rule.ConditionList) == 0 {
+			return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+		}
+		conditionQueryList := make([]interface{}, 0, len(rule.ConditionList))
+		for _, condition := range rule.ConditionList {
+			conditionQuery, err := buildESCondition(schema, option, condition)
+			if err != nil {
+				return nil, err
+			}
+			conditionQueryList = append(conditionQueryList, conditionQuery)
+		}
+		ruleQueryList = append(ruleQueryList, map[string]interface{}{
+			"bool": map[string]interface{}{"filter": conditionQueryList},
+		})
+	}
+	if len(ruleQueryList) == 1 {
+		return ruleQueryList[0].(map[string]interface{}), nil
+	}
+	return esShould(ruleQueryList), nil
+}
+
+// ToESQueryJSON 将 MDBitMap 转换为 Elasticsearch bool 查询的 json
+func (m *MDBitMap) ToESQueryJSON(schema *MDSchema, option *ESOption) ([]byte, error) {
+	query, err := m.ToESQuery(schema, option)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(query)
+}
+
+func buildESCondition(schema *MDSchema, option *ESOption, condition *MDCondition) (map[string]interface{}, error) {
+	field, ok := option.FieldMap[condition.Function]
+	if !ok || field == "" {
+		return nil, fmt.Errorf("%w: %s", ErrESFieldNotFound, condition.Function)
+	}
+	queryList := make([]interface{}, 0)
+	if schema.IsRangeFunction(condition.Function) {
+		for _, interval := range condition.IntervalList {
+			queryList = append(queryList, buildESInterval(schema, condition.Function, field, interval))
+		}
+		return esShould(queryList), nil
+	}
+	conditionValueList := schema.getConditionValueList(condition)
+	valueList := make([]interface{}, 0, len(conditionValueList))
+	hasNull := false
+	for _, value := range conditionValueList {
+		if value == nil {
+			hasNull = true
+			continue
+		}
+		valueList = append(valueList, value)
+	}
+	maxTermsSize := option.MaxTermsSize
+	if maxTermsSize <= 0 {
+		maxTermsSize = DefaultESMaxTermsSize
+	}
+	//包含其他取值槽位时，改为字段存在且不在条件未覆盖的枚举取值中
+	excludeList, hasOther := schema.getOtherExcludeValueList(condition.Function, conditionValueList)
+	if hasOther {
+		valueList = nil
+		if len(excludeList) > maxTermsSize {
+			return nil, fmt.Errorf("%w: function %s excludes %d values, limit %d", ErrESTermsTooLarge, condition.Function, len(excludeList), maxTermsSize)
+		}
+		otherQuery := map[string]interface{}{
+			"filter": []interface{}{map[string]interface{}{"exists": map[string]interface{}{"field": field}}},
+		}
+		if len(excludeList) > 0 {
+			otherQuery["must_not"] = []interface{}{map[string]interface{}{"terms": map[string]interface{}{field: excludeList}}}
+		}
+		queryList = append(queryList, map[string]interface{}{"bool": otherQuery})
+	}
+	if len(valueList) > maxTermsSize {
+		return nil, fmt.Errorf("%w: function %s has %d values, limit %d", ErrESTermsTooLarge, condition.Function, len(valueList), maxTermsSize)
+	}
+	if len(valueList) > 0 {
+		queryList = append(queryList, map[string]interface{}{
+			"terms": map[string]interface{}{field: valueList},
+		})
+	}
+	if hasNull {
+		queryList = append(queryList, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []interface{}{map[string]interface{}{"exists": map[string]interface{}{"field": field}}},
+			},
+		})
+	}
+	return esShould(queryList), nil
+}
+
+//区间转换为 range 查询，如 [1000,5000) → {"range":{"salary":{"gte":1000,"lt":5000}}}
+func buildESInterval(schema *MDSchema, function string, field string, interval *Interval) map[string]interface{} {
+	if interval.isPoint() {
+		return map[string]interface{}{
+			"term": map[string]interface{}{field: schema.getBoundaryValue(function, interval.leftBoundary)},
+		}
+	}
+	rangeQuery := make(map[string]interface{})
+	if interval.leftBoundary != nil {
+		operator := "gt"
+		if interval.leftEqual {
+			operator = "gte"
+		}
+		rangeQuery[operator] = schema.getBoundaryValue(function, interval.leftBoundary)
+	}
+	if interval.rightBoundary != nil {
+		operator := "lt"
+		if interval.rightEqual {
+			operator = "lte"
+		}
+		rangeQuery[operator] = schema.getBoundaryValue(function, interval.rightBoundary)
+	}
+	return map[string]interface{}{
+		"range": map[string]interface{}{field: rangeQuery},
+	}
+}
+
+//多个查询用 bool.should 连接，单个查询原样返回
+func esShould(queryList []interface{}) map[string]interface{} {
+	if len(queryList) == 1 {
+		return queryList[0].(map[string]interface{})
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               queryList,
+			"minimum_should_match": 1,
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package my_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "重新生成 testdata 下的 golden 文件")
+
+const testSchemaJSON = `{"function_list":[
+	{"function":"country","type":"discrete","value_list":["SG","MY","TH"],"null_slot":true,"other_slot":true},
+	{"function":"salary","type":"range","boundary_list":[1000,5000]}]}`
+
+//测试用 schema：country 取值 [SG, MY, TH, null, other]，salary 边界值 [1000, 5000]
+func newTestSchema(t testing.TB) *MDSchema {
+	t.Helper()
+	schema := &MDSchema{}
+	if err := json.Unmarshal([]byte(testSchemaJSON), schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+//将 json 编码的规则列表编译为位图
+func compileTestRuleList(t testing.TB, schema *MDSchema, ruleJSON string) *MDBitMap {
+	t.Helper()
+	bitMap, err := CompileMDBitMap(schema, getTestRuleList(t, ruleJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bitMap
+}
+
+//解析 json 编码的规则列表
+func getTestRuleList(t testing.TB, ruleJSON string) []*MDRule {
+	t.Helper()
+	ruleList := make([]*MDRule, 0)
+	if err := json.Unmarshal([]byte(ruleJSON), &ruleList); err != nil {
+		t.Fatal(err)
+	}
+	return ruleList
+}
+
+//与 testdata/name 比对，-update 时重新生成
+func checkGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", path, data, expected)
+	}
+}
+
+func TestToESQueryGolden(t *testing.T) {
+	schema := newTestSchema(t)
+	option := &ESOption{FieldMap: map[string]string{"country": "country", "salary": "salary"}}
+	caseList := []struct {
+		name     string
+		ruleJSON string
+	}{
+		{"es_empty.golden", `[]`},
+		{"es_all.golden", `[{"condition_list":[]}]`},
+		{"es_single_rule.golden", `[{"condition_list":[
+			{"function":"country","value_list":["SG","MY"]},
+			{"function":"salary","operator":"gt","value_list":[5000]}]}]`},
+		{"es_multi_rule.golden", `[
+			{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"lte","value_list":[1000]}]},
+			{"condition_list":[{"function":"country","value_list":["TH"]},{"function":"salary","value_list":[5000]}]}]`},
+		{"es_null_other.golden", `[{"condition_list":[{"function":"country","operator":"not_in","value_list":["SG","MY"]}]}]`},
+	}
+	for _, testCase := range caseList {
+		t.Run(testCase.name, func(t *testing.T) {
+			bitMap := compileTestRuleList(t, schema, testCase.ruleJSON)
+			data, err := bitMap.ToESQueryJSON(schema, option)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buffer bytes.Buffer
+			if err := json.Indent(&buffer, data, "", "  "); err != nil {
+				t.Fatal(err)
+			}
+			buffer.WriteByte('\n')
+			checkGolden(t, testCase.name, buffer.Bytes())
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package my_utils
+
+// MDExpr 位图表达式，Or / And / Not / Xor 只构建表达式 DAG，不生成中间位图
+/**
+ * @Description 组合大量策略时（如 30 个角色求或、与租户掩码求与、排除黑名单），逐步调用 OrMDBitMap 等方法
+ * 每一步都会生成完整的中间位图；表达式只在 Count / Check / Materialize 时求值：
+ *   Materialize：按 uint64 逐字求值，多元 or / and 在同一个结果上累积，not 作为 or / and 的操作数时直接取反参与运算，
+ *                同一次求值中共用的子表达式只计算一次
+ *   Check：只计算单个元素，and / or 短路，不生成位图
+ *   Count：叶子、常量及 not 直接计数，其余先 Materialize
+ * 构建时化简：
+ *   常量折叠：叶子位图全为 false / true 时视为 empty / full 常量，x&empty=empty、x|full=full、x&full=x、x|empty=x、
+ *            x^empty=x、x^full=!x、x&!x=empty、x|!x=full、x^x=empty
+ *   双重否定：!!x=x，!empty=full
+ *   展平及去重：(x|y)|z=x|y|z，x|x=x
+ *   吸收律：x&(x|y)=x，x|(x&y)=x
+ * 表达式构建后不可修改，可并发求值；叶子直接引用传入的位图，不做拷贝，表达式使用期间不能修改叶子位图
+ * 相同性按节点判断：同一个 *MDBitMap 生成的叶子视为相同，内容相同的不同位图视为不同
+ **/
+type MDExpr struct {
+	op         mdExprOp
+	lengthList []int64
+	// 第一个附加了 schema 的叶子的 schema，作为 Materialize 结果的 schema
+	schema *MDSchema
+	// op 为 mdExprLeaf 时的叶子位图
+	bitMap *MDBitMap
+	// op 为 not 时只有一个操作数，or / and 至少两个，xor 为两个
+	operandList []*MDExpr
+}
+
+type mdExprOp int
+
+const (
+	mdExprLeaf mdExprOp = iota
+	mdExprEmpty
+	mdExprFull
+	mdExprNot
+	mdExprOr
+	mdExprAnd
+	mdExprXor
+)
+
+// InitMDExpr 构造方法，以位图作为叶子生成表达式
+func InitMDExpr(bitMap *MDBitMap) (*MDExpr, error) {
+	if bitMap == nil {
+		return nil, ErrNilMDBitMap
+	}
+	expr := &MDExpr{op: mdExprLeaf, lengthList: bitMap.lengthList, schema: bitMap.schema, bitMap: bitMap}
+	switch bitMap.CountMDBitMap() {
+	case 0:
+		expr.op, expr.bitMap = mdExprEmpty, nil
+	case bitMap.getCellCount():
+		expr.op, expr.bitMap = mdExprFull, nil
+	}
+	return expr, nil
+}
+
+// InitConstMDExpr 构造方法，生成全为 value 的常量表达式，各维度长度的乘积超过位图上限时返回 *CellNumError
+func InitConstMDExpr(lengthList []int64, value bool) (*MDExpr, error) {
+	if err := checkLengthList(lengthList); err != nil {
+		return nil, err
+	}
+	if err := checkCellNum(lengthList); err != nil {
+		return nil, err
+	}
+	expr := &MDExpr{op: mdExprEmpty, lengthList: lengthList}
+	if value {
+		expr.op = mdExprFull
+	}
+	return expr, nil
+}
+
+// LengthList 返回表达式各维度长度
+func (e *MDExpr) LengthList() []int64 {
+	lengthList := make([]int64, len(e.lengthList))
+	copy(lengthList, e.lengthList)
+	return lengthList
+}
+
+// Not 取反
+func (e *MDExpr) Not() *MDExpr {
+	switch e.op {
+	case mdExprEmpty:
+		return e.newConstExpr(mdExprFull)
+	case mdExprFull:
+		return e.newConstExpr(mdExprEmpty)
+	case mdExprNot:
+		return e.operandList[0]
+	}
+	return &MDExpr{op: mdExprNot, lengthList: e.lengthList, schema: e.schema, operandList: []*MDExpr{e}}
+}
+
+// Or 或运算，结构不一致时返回 ErrInconsistentMap
+func (e *MDExpr) Or(targetExpr *MDExpr) (*MDExpr, error) {
+	return e.combine(mdExprOr, targetExpr)
+}
+
+// And 与运算，结构不一致时返回 ErrInconsistentMap
+func (e *MDExpr) And(targetExpr *MDExpr) (*MDExpr, error) {
+	return e.combine(mdExprAnd, targetExpr)
+}
+
+// Xor 异或运算，结构不一致时返回 ErrInconsistentMap
+func (e *MDExpr) Xor(targetExpr *MDExpr) (*MDExpr, error) {
+	if err := checkSameLengthList(e.lengthList, targetExpr.lengthList); err != nil {
+		return nil, err
+	}
+	switch {
+	case targetExpr.op == mdExprEmpty:
+		return e, nil
+	case e.op == mdExprEmpty:
+		return targetExpr, nil
+	case targetExpr.op == mdExprFull:
+		return e.Not(), nil
+	case e.op == mdExprFull:
+		return targetExpr.Not(), nil
+	case e.isSame(targetExpr):
+		return e.newConstExpr(mdExprEmpty), nil
+	case e.isComplement(targetExpr):
+		return e.newConstExpr(mdExprFull), nil
+	}
+	return &MDExpr{op: mdExprXor, lengthList: e.lengthList, schema: e.getSchema(targetExpr), operandList: []*MDExpr{e, targetExpr}}, nil
+}
+
+// Check 判断下标 indexList 对应元素是否为 true，只计算该元素，不生成位图
+func (e *MDExpr) Check(indexList []int64) (bool, error) {
+	if err := checkIndexList(e.lengthList, indexList); err != nil {
+		return false, err
+	}
+	offset := int64(0)
+	for i, stride := range getStrideList(e.lengthList) {
+		offset += indexList[i] * stride
+	}
+	return e.checkOffset(offset), nil
+}
+
+// Count 统计取值为 true 的元素个数
+func (e *MDExpr) Count() int64 {
+	switch e.op {
+	case mdExprLeaf:
+		return e.bitMap.CountMDBitMap()
+	case mdExprEmpty:
+		return 0
+	case mdExprFull:
+		return e.getCellCount()
+	case mdExprNot:
+		return e.getCellCount() - e.operandList[0].Count()
+	}
+	return e.Materialize().CountMDBitMap()
+}
+
+// Materialize 求值生成新位图，结果可以修改，不会影响表达式
+func (e *MDExpr) Materialize() *MDBitMap {
+	bitMap := &MDBitMap{lengthList: e.LengthList(), schema: e.schema}
+	bitMap.strideList = getStrideList(bitMap.lengthList)
+	wordList := e.evaluate(make(map[*MDExpr][]uint64))
+	if e.op == mdExprLeaf {
+		//叶子求值结果为叶子位图本身，需要拷贝
+		wordList = append([]uint64{}, wordList...)
+	}
+	bitMap.wordList = wordList
+	return bitMap
+}
+
+//生成 or / and 表达式：展平、去重、常量折叠及吸收
+func (e *MDExpr) combine(op mdExprOp, targetExpr *MDExpr) (*MDExpr, error) {
+	if err := checkSameLengthList(e.lengthList, targetExpr.lengthList); err != nil {
+		return nil, err
+	}
+	//or 中 full 为吸收元、empty 为单位元，and 相反
+	absorbOp, identityOp, dualOp := mdExprFull, mdExprEmpty, mdExprAnd
+	if op == mdExprAnd {
+		absorbOp, identityOp, dualOp = mdExprEmpty, mdExprFull, mdExprOr
+	}
+	operandList := make([]*MDExpr, 0)
+	for _, expr := range []*MDExpr{e, targetExpr} {
+		if expr.op == op {
+			operandList = append(operandList, expr.operandList...)
+		} else {
+			operandList = append(operandList, expr)
+		}
+	}
+	finalOperandList := make([]*MDExpr, 0, len(operandList))
+	for _, operand := range operandList {
+		if operand.op == absorbOp {
+			return operand, nil
+		}
+		if operand.op == identityOp || containsExpr(finalOperandList, operand) {
+			continue
+		}
+		for _, finalOperand := range finalOperandList {
+			if operand.isComplement(finalOperand) {
+				return e.newConstExpr(absorbOp), nil
+			}
+		}
+		finalOperandList = append(finalOperandList, operand)
+	}
+	//吸收律：操作数 x 是另一个对偶运算操作数的操作数时，该对偶运算操作数可以去掉
+	operandList = finalOperandList
+	finalOperandList = make([]*MDExpr, 0, len(operandList))
+	for i, operand := range operandList {
+		absorbed := false
+		if operand.op == dualOp {
+			for j, otherOperand := range operandList {
+				if i != j && containsExpr(operand.operandList, otherOperand) {
+					absorbed = true
+					break
+				}
+			}
+		}
+		if !absorbed {
+			finalOperandList = append(finalOperandList, operand)
+		}
+	}
+	switch len(finalOperandList) {
+	case 0:
+		return e.newConstExpr(identityOp), nil
+	case 1:
+		return finalOperandList[0], nil
+	}
+	return &MDExpr{op: op, lengthList: e.lengthList, schema: e.getSchema(targetExpr), operandList: finalOperandList}, nil
+}
+
+//按平铺偏移量计算单个元素，and / or 短路
+func (e *MDExpr) checkOffset(offset int64) bool {
+	switch e.op {
+	case mdExprLeaf:
+		return e.bitMap.getBit(offset)
+	case mdExprEmpty:
+		return false
+	case mdExprFull:
+		return true
+	case mdExprNot:
+		return !e.operandList[0].checkOffset(offset)
+	case mdExprOr:
+		for _, operand := range e.operandList {
+			if operand.checkOffset(offset) {
+				return true
+			}
+		}
+		return false
+	case mdExprAnd:
+		for _, operand := range e.operandList {
+			if !operand.checkOffset(offset) {
+				return false
+			}
+		}
+		return true
+	}
+	//mdExprXor
+	return e.operandList[0].checkOffset(offset) != e.operandList[1].checkOffset(offset)
+}
+
+//求值为位数组，叶子返回叶子位图本身的位数组，调用方不能修改；memo 记录本次求值中已计算的子表达式
+func (e *MDExpr) evaluate(memo map[*MDExpr][]uint64) []uint64 {
+	if e.op == mdExprLeaf {
+		return e.bitMap.wordList
+	}
+	if wordList, ok := memo[e]; ok {
+		return wordList
+	}
+	wordList := make([]uint64, getWordNum(e.getCellCount()))
+	switch e.op {
+	case mdExprFull:
+		for i := range wordList {
+			wordList[i] = ^uint64(0)
+		}
+	case mdExprNot:
+		for i, word := range e.operandList[0].evaluate(memo) {
+			wordList[i] = ^word
+		}
+	case mdExprOr, mdExprAnd:
+		for i, operand := range e.operandList {
+			//not 操作数直接取反参与运算，不单独求值
+			negative := operand.op == mdExprNot
+			if negative {
+				operand = operand.operandList[0]
+			}
+			operandWordList := operand.evaluate(memo)
+			for j, word := range operandWordList {
+				if negative {
+					word = ^word
+				}
+				switch {
+				case i == 0:
+					wordList[j] = word
+				case e.op == mdExprOr:
+					wordList[j] |= word
+				default:
+					wordList[j] &= word
+				}
+			}
+		}
+	case mdExprXor:
+		leftWordList, rightWordList := e.operandList[0].evaluate(memo), e.operandList[1].evaluate(memo)
+		for i := range wordList {
+			wordList[i] = leftWordList[i] ^ rightWordList[i]
+		}
+	}
+	//取反可能将末尾补位置为 1
+	if tail := uint64(e.getCellCount()) & 63; tail != 0 && len(wordList) > 0 {
+		wordList[len(wordList)-1] &= 1<<tail - 1
+	}
+	memo[e] = wordList
+	return wordList
+}
+
+//是否为同一个表达式
+func (e *MDExpr) isSame(targetExpr *MDExpr) bool {
+	if e == targetExpr {
+		return true
+	}
+	if e.op != targetExpr.op {
+		return false
+	}
+	switch e.op {
+	case mdExprLeaf:
+		return e.bitMap == targetExpr.bitMap
+	case mdExprEmpty, mdExprFull:
+		return true
+	case mdExprNot:
+		return e.operandList[0].isSame(targetExpr.operandList[0])
+	}
+	return false
+}
+
+//是否互为取反
+func (e *MDExpr) isComplement(targetExpr *MDExpr) bool {
+	switch {
+	case e.op == mdExprNot:
+		return e.operandList[0].isSame(targetExpr)
+	case targetExpr.op == mdExprNot:
+		return targetExpr.operandList[0].isSame(e)
+	}
+	return (e.op == mdExprEmpty && targetExpr.op == mdExprFull) || (e.op == mdExprFull && targetExpr.op == mdExprEmpty)
+}
+
+func (e *MDExpr) newConstExpr(op mdExprOp) *MDExpr {
+	return &MDExpr{op: op, lengthList: e.lengthList, schema: e.schema}
+}
+
+func (e *MDExpr) getSchema(targetExpr *MDExpr) *MDSchema {
+	if e.schema != nil {
+		return e.schema
+	}
+	return targetExpr.schema
+}
+
+func (e *MDExpr) getCellCount() int64 {
+	return getCellNum(e.lengthList)
+}
+
+func containsExpr(exprList []*MDExpr, targetExpr *MDExpr) bool {
+	for _, expr := range exprList {
+		if expr.isSame(targetExpr) {
+			return true
+		}
+	}
+	return false
+}
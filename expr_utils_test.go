@@ -0,0 +1,197 @@
+package my_utils
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func newTestMDExpr(t *testing.T, bitMap *MDBitMap) *MDExpr {
+	t.Helper()
+	expr, err := InitMDExpr(bitMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+//构建时化简，结果与化简规则一致
+func TestMDExprSimplify(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lengthList := []int64{3, 5}
+	x := newTestMDExpr(t, newRandomMDBitMap(t, r, lengthList))
+	y := newTestMDExpr(t, newRandomMDBitMap(t, r, lengthList))
+	empty, err := InitConstMDExpr(lengthList, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := InitConstMDExpr(lengthList, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must := func(expr *MDExpr, err error) *MDExpr {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr
+	}
+	xOrY := must(x.Or(y))
+	xAndY := must(x.And(y))
+	caseList := []struct {
+		name string
+		expr *MDExpr
+		want *MDExpr
+	}{
+		{"!!x", x.Not().Not(), x},
+		{"!empty", empty.Not(), full},
+		{"!full", full.Not(), empty},
+		{"x&empty", must(x.And(empty)), empty},
+		{"x|full", must(x.Or(full)), full},
+		{"x&full", must(x.And(full)), x},
+		{"x|empty", must(x.Or(empty)), x},
+		{"x^empty", must(x.Xor(empty)), x},
+		{"x^full", must(x.Xor(full)), x.Not()},
+		{"x&!x", must(x.And(x.Not())), empty},
+		{"!x|x", must(x.Not().Or(x)), full},
+		{"x^x", must(x.Xor(x)), empty},
+		{"x^!x", must(x.Xor(x.Not())), full},
+		{"x|x", must(x.Or(x)), x},
+		{"x&(x|y)", must(x.And(xOrY)), x},
+		{"(x|y)&x", must(xOrY.And(x)), x},
+		{"x|(x&y)", must(x.Or(xAndY)), x},
+		{"(x&y)&!x", must(xAndY.And(x.Not())), empty},
+	}
+	for _, testCase := range caseList {
+		if !testCase.expr.isSame(testCase.want) {
+			t.Errorf("%s not simplified, op %d", testCase.name, testCase.expr.op)
+		}
+	}
+	//展平及去重
+	flatExpr := must(must(xOrY.Or(y)).Or(x))
+	if flatExpr.op != mdExprOr || len(flatExpr.operandList) != 2 {
+		t.Errorf("(x|y)|y|x not flattened, op %d, operand count %d", flatExpr.op, len(flatExpr.operandList))
+	}
+	//全为 false / true 的叶子视为常量
+	constBitMap := &MDBitMap{}
+	if err := constBitMap.InitMDBitMap(lengthList, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expr := newTestMDExpr(t, constBitMap); expr.op != mdExprEmpty {
+		t.Errorf("empty leaf op %d", expr.op)
+	}
+	if expr := newTestMDExpr(t, constBitMap.NotMDBitMap()); expr.op != mdExprFull {
+		t.Errorf("full leaf op %d", expr.op)
+	}
+}
+
+//Check / Count / Materialize 与逐步计算的位图一致
+func TestMDExprEvaluate(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, lengthList := range [][]int64{{7}, {3, 5}, {4, 3, 11}, {2, 64}} {
+		a, b, c := newRandomMDBitMap(t, r, lengthList), newRandomMDBitMap(t, r, lengthList), newRandomMDBitMap(t, r, lengthList)
+		exprA, exprB, exprC := newTestMDExpr(t, a), newTestMDExpr(t, b), newTestMDExpr(t, c)
+		//(a | b) & !c ^ a，not 作为 and 的操作数，a 在同一次求值中被共用
+		orExpr, err := exprA.Or(exprB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		andExpr, err := orExpr.And(exprC.Not())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := andExpr.Xor(exprA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orBitMap, _ := a.OrMDBitMap(b)
+		andBitMap, _ := orBitMap.AndMDBitMap(c.NotMDBitMap())
+		//x ^ y = (x & !y) | (!x & y)
+		leftBitMap, _ := andBitMap.AndMDBitMap(a.NotMDBitMap())
+		rightBitMap, _ := andBitMap.NotMDBitMap().AndMDBitMap(a)
+		wantBitMap, _ := leftBitMap.OrMDBitMap(rightBitMap)
+		for _, testCase := range []struct {
+			expr   *MDExpr
+			bitMap *MDBitMap
+		}{
+			{exprA, a},
+			{exprA.Not(), a.NotMDBitMap()},
+			{orExpr, orBitMap},
+			{andExpr, andBitMap},
+			{expr, wantBitMap},
+		} {
+			bitMap := testCase.expr.Materialize()
+			if !bitMap.EqualMDBitMap(testCase.bitMap) {
+				t.Fatalf("%v: materialize mismatch", lengthList)
+			}
+			if count := testCase.expr.Count(); count != testCase.bitMap.CountMDBitMap() {
+				t.Fatalf("%v: count %d, want %d", lengthList, count, testCase.bitMap.CountMDBitMap())
+			}
+			for cursor := testCase.bitMap.Cursor(); cursor.Next(); {
+				result, err := testCase.expr.Check(cursor.IndexList())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result != testCase.bitMap.getBit(cursor.Offset()) {
+					t.Fatalf("%v: check %v %v", lengthList, cursor.IndexList(), result)
+				}
+			}
+		}
+		//Materialize 的结果可以修改，不影响叶子
+		bitMap := exprA.Materialize()
+		bitMap.wordList[0] = ^bitMap.wordList[0]
+		bitMap.clearPadding()
+		if bitMap.EqualMDBitMap(a) || !exprA.Materialize().EqualMDBitMap(a) {
+			t.Fatalf("%v: materialize shares leaf word list", lengthList)
+		}
+	}
+}
+
+//Check 只计算单个元素，不生成位图
+func TestMDExprCheckWithoutMaterialize(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	lengthList := []int64{64, 64, 64}
+	expr := newTestMDExpr(t, newRandomMDBitMap(t, r, lengthList))
+	for i := 0; i < 8; i++ {
+		operand := newTestMDExpr(t, newRandomMDBitMap(t, r, lengthList))
+		var err error
+		if i%2 == 0 {
+			expr, err = expr.Or(operand.Not())
+		} else {
+			expr, err = expr.And(operand)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexList := []int64{1, 2, 3}
+	//只允许下标转换为偏移量时分配步长列表，位图为 32KB，生成位图时分配远超此数
+	allocNum := testing.AllocsPerRun(10, func() {
+		if _, err := expr.Check(indexList); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocNum > 1 {
+		t.Errorf("check allocs %v", allocNum)
+	}
+	if _, err := expr.Check([]int64{1, 2, 64}); !errors.Is(err, ErrMDBitMapIndexOutOfRange) {
+		t.Errorf("check out of range error %v", err)
+	}
+	if _, err := expr.Check([]int64{1, 2}); !errors.Is(err, ErrInconsistentLength) {
+		t.Errorf("check inconsistent length error %v", err)
+	}
+}
+
+func TestMDExprInconsistentMap(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	x := newTestMDExpr(t, newRandomMDBitMap(t, r, []int64{3, 5}))
+	y := newTestMDExpr(t, newRandomMDBitMap(t, r, []int64{5, 3}))
+	for _, combine := range []func(*MDExpr) (*MDExpr, error){x.Or, x.And, x.Xor} {
+		if _, err := combine(y); !errors.Is(err, ErrInconsistentMap) {
+			t.Errorf("combine error %v", err)
+		}
+	}
+	if _, err := InitMDExpr(nil); !errors.Is(err, ErrNilMDBitMap) {
+		t.Errorf("nil bitmap error %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+package my_utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrFieldExtractorNotFound 维度没有对应的字段提取方法
+	ErrFieldExtractorNotFound = errors.New("field extractor of function not found")
+	// ErrInvalidRecordType 记录类型不支持
+	ErrInvalidRecordType = errors.New("invalid record type")
+)
+
+// DefaultFilterTagName 默认的结构体 tag 名称，如 `mdbitmap:"country"`
+const DefaultFilterTagName = "mdbitmap"
+
+// FieldExtractor 从记录中提取某个维度的取值
+type FieldExtractor func(record interface{}) (interface{}, error)
+
+// MDFilterOption 过滤配置
+type MDFilterOption struct {
+	// 并发数，<=0 时使用 GOMAXPROCS
+	WorkerNum int
+	// 是否返回被拒绝记录的原因
+	WithReason bool
+}
+
+// MDDenyReason 记录被拒绝的原因
+type MDDenyReason struct {
+	// 记录在切片中的下标，流式过滤时为记录到达的序号
+	Index int
+	// 导致拒绝的维度，位图对应元素为 false 时为空
+	Function string
+	Value    interface{}
+	Message  string
+	// 提取字段失败时的错误
+	Err error
+}
+
+// MDFilterResult 切片过滤结果
+type MDFilterResult struct {
+	// 允许的记录，与入参切片类型相同
+	AllowRecordList interface{}
+	// 允许的记录在入参切片中的下标，升序
+	AllowIndexList []int
+	// 被拒绝记录的原因，仅在 WithReason 为 true 时返回，按下标升序
+	DenyReasonList []*MDDenyReason
+}
+
+// MDFilterItem 流式过滤结果
+type MDFilterItem struct {
+	Record  interface{}
+	Allowed bool
+	// 被拒绝的原因，仅在 WithReason 为 true 时返回
+	Reason *MDDenyReason
+}
+
+// MDFilter 基于 MDBitMap 的内存记录过滤器，初始化后只读，可在多个 goroutine 中并发使用
+type MDFilter struct {
+	schema        *MDSchema
+	extractorList []FieldExtractor
+	// 各维度的取值 → 槽位查找表，避免每条记录按维度名称查找 schema
+	lookupList []*mdSlotLookup
+	bitMap     *MDBitMap
+	strideList []int64
+}
+
+//单个维度的取值 → 槽位查找表，与 MDSchema.GetSlotIndex 的转换规则一致
+type mdSlotLookup struct {
+	isRange bool
+	// 离散维度的取值 → 槽位，直接引用 schema，只读
+	valueSlotMap map[interface{}]int64
+	// 其他取值槽位，没有时为 -1
+	otherSlot int64
+	// 范围维度的边界值，升序
+	boundaryList []float64
+}
+
+// InitMDFilter 构造方法
+/**
+ * @Description 根据位图、schema 及各维度字段提取方法初始化过滤器，并预先计算各维度的取值 → 槽位查找表
+ * 位图直接引用，不做拷贝，过滤器使用期间不能修改
+ * @Param bitMap 权限位图， schema 位图结构， extractorMap 维度 → 字段提取方法，需覆盖全部维度
+ * @e.g.
+	type Employee struct {
+		Country string  `mdbitmap:"country"`
+		Salary  float64 `mdbitmap:"salary"`
+	}
+	extractorMap, _ := GetTagFieldExtractorMap(Employee{}, DefaultFilterTagName)
+	filter, _ := InitMDFilter(bitMap, schema, extractorMap)
+	result, _ := filter.FilterSlice(employeeList, &MDFilterOption{WithReason: true})
+ **/
+func InitMDFilter(bitMap *MDBitMap, schema *MDSchema, extractorMap map[string]FieldExtractor) (*MDFilter, error) {
+	if err := schema.checkMDBitMap(bitMap); err != nil {
+		return nil, err
+	}
+	f := &MDFilter{
+		schema:        schema,
+		extractorList: make([]FieldExtractor, len(schema.functionList)),
+	}
+	for i, function := range schema.functionList {
+		extractor, ok := extractorMap[function]
+		if !ok || extractor == nil {
+			return nil, fmt.Errorf("%w: %s", ErrFieldExtractorNotFound, function)
+		}
+		f.extractorList[i] = extractor
+		f.lookupList = append(f.lookupList, schema.getSlotLookup(function))
+	}
+	f.bitMap = bitMap
+	f.strideList = bitMap.Strides()
+	return f, nil
+}
+
+func (s *MDSchema) getSlotLookup(function string) *mdSlotLookup {
+	if s.IsRangeFunction(function) {
+		return &mdSlotLookup{isRange: true, boundaryList: s.boundaryListMap[function]}
+	}
+	lookup := &mdSlotLookup{valueSlotMap: s.valueSlotMap[function], otherSlot: -1}
+	if s.hasOtherSlot(function) {
+		lookup.otherSlot = s.valueSlotMap[function][OtherValue]
+	}
+	return lookup
+}
+
+//取值对应的槽位，不在 schema 中时返回 false
+func (l *mdSlotLookup) getSlot(value interface{}) (int64, bool) {
+	if l.isRange {
+		number, ok := toFloat64(value)
+		if !ok {
+			return 0, false
+		}
+		k := sort.SearchFloat64s(l.boundaryList, number)
+		if k < len(l.boundaryList) && l.boundaryList[k] == number {
+			return int64(2*k + 1), true
+		}
+		return int64(2 * k), true
+	}
+	//不可比较的取值无法作为 map key，不在枚举取值中
+	if !isComparableValue(value) {
+		return 0, false
+	}
+	if slot, ok := l.valueSlotMap[normalizeValue(value)]; ok {
+		return slot, true
+	}
+	if value != nil && l.otherSlot >= 0 {
+		return l.otherSlot, true
+	}
+	return 0, false
+}
+
+// Check 判断单条记录是否允许，拒绝时返回原因；提取字段失败时返回 error
+func (f *MDFilter) Check(record interface{}) (bool, *MDDenyReason, error) {
+	allowed, reason := f.check(record)
+	if reason != nil && reason.Err != nil {
+		return false, reason, reason.Err
+	}
+	return allowed, reason, nil
+}
+
+func (f *MDFilter) check(record interface{}) (bool, *MDDenyReason) {
+	offset := int64(0)
+	valueList := make([]interface{}, len(f.extractorList))
+	for i, extractor := range f.extractorList {
+		function := f.schema.functionList[i]
+		value, err := extractor(record)
+		if err != nil {
+			return false, &MDDenyReason{Function: function, Message: "extract field failed", Err: err}
+		}
+		slot, ok := f.lookupList[i].getSlot(value)
+		if !ok {
+			return false, &MDDenyReason{Function: function, Value: value, Message: fmt.Sprintf("value %v of %s not in schema", value, function)}
+		}
+		valueList[i] = value
+		offset += slot * f.strideList[i]
+	}
+	if f.bitMap.getBit(offset) {
+		return true, nil
+	}
+	labelList := make([]string, len(valueList))
+	for i, value := range valueList {
+		labelList[i] = fmt.Sprintf("%s=%v", f.schema.functionList[i], value)
+	}
+	return false, &MDDenyReason{Message: strings.Join(labelList, ", ") + " not granted"}
+}
+
+// FilterSlice 并发过滤切片，recordSlice 为任意类型的切片
+/**
+ * @Description 按 WorkerNum 将切片分段并发判断，返回允许的记录（与入参切片类型相同）及其下标
+ * 提取字段失败的记录视为拒绝，原因中的 Err 为对应错误
+ **/
+func (f *MDFilter) FilterSlice(recordSlice interface{}, option *MDFilterOption) (*MDFilterResult, error) {
+	sliceValue := reflect.ValueOf(recordSlice)
+	if sliceValue.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%w: %T is not a slice", ErrInvalidRecordType, recordSlice)
+	}
+	if option == nil {
+		option = &MDFilterOption{}
+	}
+	length := sliceValue.Len()
+	allowList := make([]bool, length)
+	reasonList := make([]*MDDenyReason, length)
+	workerNum := getFilterWorkerNum(option)
+	chunkSize := (length + workerNum - 1) / workerNum
+	var wg sync.WaitGroup
+	for start := 0; start < length; start += chunkSize {
+		end := start + chunkSize
+		if end > length {
+			end = length
+		}
+		wg.Add(1)
+		go func(start int, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				allowList[i], reasonList[i] = f.check(sliceValue.Index(i).Interface())
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	result := &MDFilterResult{AllowIndexList: make([]int, 0)}
+	allowRecordList := reflect.MakeSlice(sliceValue.Type(), 0, 0)
+	for i, allowed := range allowList {
+		if allowed {
+			result.AllowIndexList = append(result.AllowIndexList, i)
+			allowRecordList = reflect.Append(allowRecordList, sliceValue.Index(i))
+			continue
+		}
+		if option.WithReason {
+			reasonList[i].Index = i
+			result.DenyReasonList = append(result.DenyReasonList, reasonList[i])
+		}
+	}
+	result.AllowRecordList = allowRecordList.Interface()
+	return result, nil
+}
+
+// FilterStream 并发过滤记录流，recordChan 关闭或 ctx 取消后输出 channel 关闭
+/**
+ * @Description 输出允许的记录；WithReason 为 true 时被拒绝的记录也会输出，Allowed 为 false 并带上原因
+ * 多个 worker 并发处理，输出顺序与输入顺序不保证一致，可通过 Reason.Index 对应输入序号
+ * ctx 取消后在后台丢弃 recordChan 中剩余的记录直到其关闭，生产方不会因取消而阻塞，但仍需关闭 recordChan
+ **/
+func (f *MDFilter) FilterStream(ctx context.Context, recordChan <-chan interface{}, option *MDFilterOption) <-chan *MDFilterItem {
+	if option == nil {
+		option = &MDFilterOption{}
+	}
+	type indexRecord struct {
+		index  int
+		record interface{}
+	}
+	itemChan := make(chan *MDFilterItem)
+	indexChan := make(chan indexRecord)
+	//为记录编号，便于定位被拒绝的记录
+	go func() {
+		defer close(indexChan)
+		index := 0
+		for {
+			select {
+			case <-ctx.Done():
+				go drainRecordChan(recordChan)
+				return
+			case record, ok := <-recordChan:
+				if !ok {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					go drainRecordChan(recordChan)
+					return
+				case indexChan <- indexRecord{index: index, record: record}:
+				}
+				index++
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < getFilterWorkerNum(option); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range indexChan {
+				allowed, reason := f.check(item.record)
+				if !allowed && !option.WithReason {
+					continue
+				}
+				if reason != nil {
+					reason.Index = item.index
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case itemChan <- &MDFilterItem{Record: item.record, Allowed: allowed, Reason: reason}:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(itemChan)
+	}()
+	return itemChan
+}
+
+//丢弃记录直到 recordChan 关闭，避免取消后生产方阻塞
+func drainRecordChan(recordChan <-chan interface{}) {
+	for range recordChan {
+	}
+}
+
+func getFilterWorkerNum(option *MDFilterOption) int {
+	if option.WorkerNum > 0 {
+		return option.WorkerNum
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// GetTagFieldExtractorMap 根据结构体 tag 生成各维度的字段提取方法
+/**
+ * @Description record 为结构体或结构体指针样例，tag 取值为维度名称，如 `mdbitmap:"country"`
+ * 提取时指针字段为 nil 返回 nil，非 nil 返回指向的值；记录本身为 nil 指针时返回 ErrInvalidRecordType
+ **/
+func GetTagFieldExtractorMap(record interface{}, tagName string) (map[string]FieldExtractor, error) {
+	recordType := reflect.TypeOf(record)
+	if recordType != nil && recordType.Kind() == reflect.Ptr {
+		recordType = recordType.Elem()
+	}
+	if recordType == nil || recordType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T is not a struct", ErrInvalidRecordType, record)
+	}
+	extractorMap := make(map[string]FieldExtractor)
+	for i := 0; i < recordType.NumField(); i++ {
+		field := recordType.Field(i)
+		function := field.Tag.Get(tagName)
+		//未导出字段无法通过反射读取
+		if function == "" || function == "-" || field.PkgPath != "" {
+			continue
+		}
+		extractorMap[function] = getFieldExtractor(recordType, field.Index)
+	}
+	return extractorMap, nil
+}
+
+func getFieldExtractor(recordType reflect.Type, fieldIndex []int) FieldExtractor {
+	return func(record interface{}) (interface{}, error) {
+		recordValue := reflect.ValueOf(record)
+		if !recordValue.IsValid() {
+			return nil, fmt.Errorf("%w: nil record", ErrInvalidRecordType)
+		}
+		if recordValue.Kind() == reflect.Ptr {
+			if recordValue.IsNil() {
+				return nil, fmt.Errorf("%w: nil %T", ErrInvalidRecordType, record)
+			}
+			recordValue = recordValue.Elem()
+		}
+		if recordValue.Type() != recordType {
+			return nil, fmt.Errorf("%w: expect %s, got %T", ErrInvalidRecordType, recordType, record)
+		}
+		fieldValue := recordValue.FieldByIndex(fieldIndex)
+		if fieldValue.Kind() == reflect.Ptr || fieldValue.Kind() == reflect.Interface {
+			if fieldValue.IsNil() {
+				return nil, nil
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		return fieldValue.Interface(), nil
+	}
+}
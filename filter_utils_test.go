@@ -0,0 +1,226 @@
+package my_utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMDFilterCheck(t *testing.T) {
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[
+		{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+		{"condition_list":[{"function":"country","operator":"not_in","value_list":["SG","MY","TH"]}]}]`)
+	extractorMap := map[string]FieldExtractor{
+		"country": func(record interface{}) (interface{}, error) { return record.(map[string]interface{})["country"], nil },
+		"salary":  func(record interface{}) (interface{}, error) { return record.(map[string]interface{})["salary"], nil },
+	}
+	filter, err := InitMDFilter(bitMap, schema, extractorMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caseList := []struct {
+		record  map[string]interface{}
+		allowed bool
+	}{
+		{map[string]interface{}{"country": "SG", "salary": 1000}, true},
+		{map[string]interface{}{"country": "SG", "salary": 999.5}, false},
+		{map[string]interface{}{"country": "MY", "salary": 8000}, false},
+		//落入其他取值槽位及 null 槽位
+		{map[string]interface{}{"country": "VN", "salary": 0}, true},
+		{map[string]interface{}{"country": nil, "salary": 0}, true},
+		//不可比较的取值不在 schema 中
+		{map[string]interface{}{"country": []string{"SG"}, "salary": 8000}, false},
+		{map[string]interface{}{"country": "SG", "salary": "high"}, false},
+	}
+	for _, testCase := range caseList {
+		allowed, reason, err := filter.Check(testCase.record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != testCase.allowed {
+			t.Errorf("Check(%v) = %v, want %v, reason %+v", testCase.record, allowed, testCase.allowed, reason)
+		}
+	}
+}
+
+type testFilterEmployee struct {
+	Name    string
+	Country *string `mdbitmap:"country"`
+	Salary  int     `mdbitmap:"salary"`
+}
+
+func newTestEmployeeFilter(t *testing.T) *MDFilter {
+	t.Helper()
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[
+		{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+		{"condition_list":[{"function":"country","value_list":[null]}]}]`)
+	extractorMap, err := GetTagFieldExtractorMap(&testFilterEmployee{}, DefaultFilterTagName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := InitMDFilter(bitMap, schema, extractorMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+//下标 i%4：0 SG 高薪允许，1 SG 低薪拒绝，2 MY 拒绝，3 country 为 nil 允许
+func newTestEmployeeList(n int) []*testFilterEmployee {
+	sg, my := "SG", "MY"
+	employeeList := make([]*testFilterEmployee, n)
+	for i := range employeeList {
+		switch i % 4 {
+		case 0:
+			employeeList[i] = &testFilterEmployee{Country: &sg, Salary: 5000}
+		case 1:
+			employeeList[i] = &testFilterEmployee{Country: &sg, Salary: 999}
+		case 2:
+			employeeList[i] = &testFilterEmployee{Country: &my, Salary: 5000}
+		default:
+			employeeList[i] = &testFilterEmployee{Salary: 0}
+		}
+	}
+	return employeeList
+}
+
+func TestMDFilterSlice(t *testing.T) {
+	filter := newTestEmployeeFilter(t)
+	employeeList := newTestEmployeeList(103)
+	//记录为 nil 指针时提取字段失败
+	employeeList[5] = nil
+	for _, workerNum := range []int{0, 1, 3, 200} {
+		result, err := filter.FilterSlice(employeeList, &MDFilterOption{WorkerNum: workerNum, WithReason: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowRecordList := result.AllowRecordList.([]*testFilterEmployee)
+		if len(allowRecordList) != len(result.AllowIndexList) {
+			t.Fatalf("allow record count %d, index count %d", len(allowRecordList), len(result.AllowIndexList))
+		}
+		//允许的记录及原因均按下标升序
+		for i, index := range result.AllowIndexList {
+			if index%4 != 0 && index%4 != 3 || allowRecordList[i] != employeeList[index] {
+				t.Fatalf("worker %d: allow index %d", workerNum, index)
+			}
+			if i > 0 && index <= result.AllowIndexList[i-1] {
+				t.Fatalf("worker %d: allow index list not sorted %v", workerNum, result.AllowIndexList)
+			}
+		}
+		if len(result.AllowIndexList)+len(result.DenyReasonList) != len(employeeList) {
+			t.Fatalf("worker %d: allow %d, deny %d", workerNum, len(result.AllowIndexList), len(result.DenyReasonList))
+		}
+		for i, reason := range result.DenyReasonList {
+			if i > 0 && reason.Index <= result.DenyReasonList[i-1].Index {
+				t.Fatalf("worker %d: deny reason list not sorted", workerNum)
+			}
+			switch {
+			case reason.Index == 5:
+				if !errors.Is(reason.Err, ErrInvalidRecordType) || reason.Function != "country" {
+					t.Fatalf("nil record reason %+v", reason)
+				}
+			case reason.Index%4 == 1:
+				if reason.Message != "country=SG, salary=999 not granted" || reason.Function != "" {
+					t.Fatalf("reason %+v", reason)
+				}
+			case reason.Index%4 == 2:
+				if reason.Message != "country=MY, salary=5000 not granted" {
+					t.Fatalf("reason %+v", reason)
+				}
+			default:
+				t.Fatalf("unexpected deny reason %+v", reason)
+			}
+		}
+	}
+	result, err := filter.FilterSlice(employeeList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DenyReasonList != nil || len(result.AllowIndexList) != 51 {
+		t.Fatalf("allow %d, deny reason %v", len(result.AllowIndexList), result.DenyReasonList)
+	}
+	if _, err := filter.FilterSlice(employeeList[0], nil); !errors.Is(err, ErrInvalidRecordType) {
+		t.Fatalf("non slice error %v", err)
+	}
+}
+
+func TestMDFilterStream(t *testing.T) {
+	filter := newTestEmployeeFilter(t)
+	employeeList := newTestEmployeeList(101)
+	for _, withReason := range []bool{false, true} {
+		recordChan := make(chan interface{})
+		go func() {
+			defer close(recordChan)
+			for _, employee := range employeeList {
+				recordChan <- employee
+			}
+		}()
+		allowIndexList, denyIndexList := make([]int, 0), make([]int, 0)
+		indexMap := make(map[*testFilterEmployee]int, len(employeeList))
+		for i, employee := range employeeList {
+			indexMap[employee] = i
+		}
+		for item := range filter.FilterStream(context.Background(), recordChan, &MDFilterOption{WorkerNum: 4, WithReason: withReason}) {
+			index := indexMap[item.Record.(*testFilterEmployee)]
+			if item.Allowed {
+				allowIndexList = append(allowIndexList, index)
+				continue
+			}
+			if item.Reason == nil || item.Reason.Index != index {
+				t.Fatalf("deny item %d reason %+v", index, item.Reason)
+			}
+			denyIndexList = append(denyIndexList, index)
+		}
+		sort.Ints(allowIndexList)
+		sort.Ints(denyIndexList)
+		result, err := filter.FilterSlice(employeeList, &MDFilterOption{WithReason: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(allowIndexList, result.AllowIndexList) {
+			t.Fatalf("stream allow index list %v, want %v", allowIndexList, result.AllowIndexList)
+		}
+		if withReason != (len(denyIndexList) == len(result.DenyReasonList)) || !withReason && len(denyIndexList) != 0 {
+			t.Fatalf("with reason %v, deny count %d", withReason, len(denyIndexList))
+		}
+	}
+}
+
+//取消后输出 channel 关闭，生产方不会阻塞在 recordChan 上
+func TestMDFilterStreamCancel(t *testing.T) {
+	filter := newTestEmployeeFilter(t)
+	employeeList := newTestEmployeeList(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	recordChan := make(chan interface{})
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		defer close(recordChan)
+		for _, employee := range employeeList {
+			recordChan <- employee
+		}
+	}()
+	itemChan := filter.FilterStream(ctx, recordChan, &MDFilterOption{WorkerNum: 2})
+	for i := 0; i < 10; i++ {
+		<-itemChan
+	}
+	cancel()
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		for range itemChan {
+		}
+	}()
+	for _, done := range []chan struct{}{outputDone, producerDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("filter stream blocked after cancel")
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/Hzg030/go_util
+
+go 1.18
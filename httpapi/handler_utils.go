@@ -0,0 +1,586 @@
+// Package httpapi 基于 MDBitMap 的 HTTP 数据权限决策服务，只依赖标准库
+/**
+ * 接口（请求及响应均为 json，错误响应为 {"error": "..."}）：
+ *   PUT  /schemas/{name}        注册 schema，请求体为 MDSchema json，返回 SchemaResponse
+ *   GET  /schemas               列出已注册的 schema
+ *   GET  /schemas/{name}        获取 schema
+ *   PUT  /policies/{name}       编译并写入策略，请求体为 PutPolicyRequest，返回 Policy
+ *   GET  /policies              列出所有策略的最新版本
+ *   GET  /policies/{name}       获取策略的最新版本
+ *   POST /evaluate              判断单条记录，请求体为 EvaluateRequest
+ *   POST /evaluate/batch        批量判断记录，请求体为 BatchEvaluateRequest
+ *   POST /filters/sql           生成 SQL WHERE 条件，请求体为 SQLFilterRequest
+ *   POST /filters/es            生成 Elasticsearch 查询，请求体为 ESFilterRequest
+ * 主体（principal）由策略名称列表表示，各策略之间为"或"关系，各策略必须基于同一版本的 schema
+ * 挂载到子路径时使用 http.StripPrefix
+ **/
+package httpapi
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	my_utils "github.com/Hzg030/go_util"
+)
+
+var (
+	// ErrSchemaNotFound schema 未注册
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrInvalidRequest 请求不合法
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrSchemaTooLarge schema 对应位图的元素个数超过 HandlerOption.MaxSchemaCellNum
+	ErrSchemaTooLarge = errors.New("schema too large")
+)
+
+const (
+	// DefaultMaxBodyBytes 默认请求体大小上限
+	DefaultMaxBodyBytes = 1 << 20
+	// DefaultMaxBatchSize 默认批量判断的记录个数上限
+	DefaultMaxBatchSize = 1000
+	// DefaultPrincipalCacheSize 默认缓存的主体个数上限
+	DefaultPrincipalCacheSize = 1000
+	// DefaultMaxCellNum 默认的 schema 元素个数上限及编译限制，位图最多 2MB
+	DefaultMaxCellNum = 1 << 24
+)
+
+// HandlerOption 服务配置
+type HandlerOption struct {
+	// 请求体大小上限，<=0 时使用 DefaultMaxBodyBytes
+	MaxBodyBytes int64
+	// 批量判断的记录个数上限，<=0 时使用 DefaultMaxBatchSize
+	MaxBatchSize int
+	// 维度 → SQL 列名，列名会拼接到 SQL 中，只能由服务端配置
+	SQLColumnMap map[string]string
+	// 维度 → ES 字段名
+	ESFieldMap map[string]string
+	// 编译缓存配置；为 nil 或其 CompileOption 为 nil 时，编译的元素个数及单条规则覆盖的元素个数上限均为 DefaultMaxCellNum
+	CacheOption *my_utils.PolicyCacheOption
+	// 注册 schema 时各维度长度乘积的上限，<=0 时使用 DefaultMaxCellNum；超过时返回 422，防止编译时耗尽内存
+	MaxSchemaCellNum int64
+	// 缓存的主体（策略名称列表）个数上限，<=0 时使用 DefaultPrincipalCacheSize，超过时淘汰最久未使用的主体
+	PrincipalCacheSize int
+}
+
+// SchemaResponse schema 注册结果
+type SchemaResponse struct {
+	Name    string             `json:"name"`
+	Version string             `json:"version"`
+	Schema  *my_utils.MDSchema `json:"schema"`
+}
+
+// PutPolicyRequest 写入策略
+type PutPolicyRequest struct {
+	// 已注册的 schema 名称
+	Schema string `json:"schema"`
+	// 策略的规则列表，见 my_utils.CompileMDBitMap
+	Source []*my_utils.MDRule `json:"source"`
+	// 期望的当前版本号，新策略为 0，见 my_utils.PolicyStore
+	ExpectedRevision int64 `json:"expected_revision"`
+}
+
+// EvaluateRequest 判断单条记录
+type EvaluateRequest struct {
+	PolicyList []string `json:"policy_list"`
+	// 维度 → 取值
+	Record map[string]interface{} `json:"record"`
+}
+
+// EvaluateResponse 单条记录的判断结果
+type EvaluateResponse struct {
+	Allow bool `json:"allow"`
+	// 拒绝原因
+	Reason string `json:"reason,omitempty"`
+}
+
+// BatchEvaluateRequest 批量判断记录
+type BatchEvaluateRequest struct {
+	PolicyList []string                 `json:"policy_list"`
+	RecordList []map[string]interface{} `json:"record_list"`
+}
+
+// BatchEvaluateResponse 批量判断结果，与 RecordList 一一对应
+type BatchEvaluateResponse struct {
+	ResultList []*EvaluateResponse `json:"result_list"`
+}
+
+// SQLFilterRequest 生成 SQL WHERE 条件
+type SQLFilterRequest struct {
+	PolicyList []string `json:"policy_list"`
+	// mysql（默认）或 postgresql
+	Dialect string `json:"dialect"`
+	// PostgreSQL 占位符起始偏移，见 my_utils.SQLOption
+	PlaceholderOffset int `json:"placeholder_offset"`
+}
+
+// SQLFilterResponse SQL WHERE 条件及参数
+type SQLFilterResponse struct {
+	Where   string        `json:"where"`
+	ArgList []interface{} `json:"arg_list"`
+}
+
+// ESFilterRequest 生成 Elasticsearch 查询
+type ESFilterRequest struct {
+	PolicyList []string `json:"policy_list"`
+}
+
+// ESFilterResponse Elasticsearch bool 查询
+type ESFilterResponse struct {
+	Query map[string]interface{} `json:"query"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler 策略决策服务，实现 http.Handler，并发安全
+type Handler struct {
+	store  my_utils.PolicyStore
+	cache  *my_utils.PolicyCache
+	option HandlerOption
+	mutex  sync.RWMutex
+	// schema 名称 → schema，注册后不再修改
+	schemaMap map[string]*my_utils.MDSchema
+	// 主体缓存，key 为各策略名称及版本号，策略写入新版本后 key 随之变化，旧的主体按 LRU 淘汰
+	principalMutex sync.Mutex
+	principalMap   map[string]*list.Element
+	principalList  *list.List
+}
+
+//主体的各策略做或运算后的位图及过滤器，只读
+type principal struct {
+	key    string
+	bitMap *my_utils.MDBitMap
+	filter *my_utils.MDFilter
+}
+
+// InitHandler 构造方法，store 保存策略，option 可为 nil
+func InitHandler(store my_utils.PolicyStore, option *HandlerOption) *Handler {
+	h := &Handler{
+		store:         store,
+		schemaMap:     make(map[string]*my_utils.MDSchema),
+		principalMap:  make(map[string]*list.Element),
+		principalList: list.New(),
+	}
+	if option != nil {
+		h.option = *option
+	}
+	if h.option.MaxBodyBytes <= 0 {
+		h.option.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if h.option.MaxBatchSize <= 0 {
+		h.option.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if h.option.PrincipalCacheSize <= 0 {
+		h.option.PrincipalCacheSize = DefaultPrincipalCacheSize
+	}
+	if h.option.MaxSchemaCellNum <= 0 {
+		h.option.MaxSchemaCellNum = DefaultMaxCellNum
+	}
+	//未配置编译限制时使用默认限制，请求中的规则不可信
+	cacheOption := my_utils.PolicyCacheOption{}
+	if h.option.CacheOption != nil {
+		cacheOption = *h.option.CacheOption
+	}
+	if cacheOption.CompileOption == nil {
+		cacheOption.CompileOption = &my_utils.CompileOption{MaxCellNum: DefaultMaxCellNum, MaxExpansion: DefaultMaxCellNum}
+	}
+	h.option.CacheOption = &cacheOption
+	h.cache = my_utils.InitPolicyCache(h.option.CacheOption)
+	return h
+}
+
+// ServeHTTP 按路径及方法分发请求
+func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	pathList := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	var result interface{}
+	var err error
+	switch {
+	case pathList[0] == "schemas" && len(pathList) == 1:
+		if h.checkMethod(writer, request, http.MethodGet) {
+			result, err = h.listSchema()
+		}
+	case pathList[0] == "schemas" && len(pathList) == 2:
+		switch request.Method {
+		case http.MethodGet:
+			result, err = h.getSchema(pathList[1])
+		case http.MethodPut:
+			result, err = h.putSchema(writer, request, pathList[1])
+		default:
+			h.checkMethod(writer, request, http.MethodGet, http.MethodPut)
+		}
+	case pathList[0] == "policies" && len(pathList) == 1:
+		if h.checkMethod(writer, request, http.MethodGet) {
+			result, err = h.store.List()
+		}
+	case pathList[0] == "policies" && len(pathList) == 2:
+		switch request.Method {
+		case http.MethodGet:
+			result, err = h.store.Get(pathList[1])
+		case http.MethodPut:
+			result, err = h.putPolicy(writer, request, pathList[1])
+		default:
+			h.checkMethod(writer, request, http.MethodGet, http.MethodPut)
+		}
+	case pathList[0] == "evaluate" && len(pathList) == 1:
+		if h.checkMethod(writer, request, http.MethodPost) {
+			result, err = h.evaluate(writer, request)
+		}
+	case pathList[0] == "evaluate" && len(pathList) == 2 && pathList[1] == "batch":
+		if h.checkMethod(writer, request, http.MethodPost) {
+			result, err = h.batchEvaluate(writer, request)
+		}
+	case pathList[0] == "filters" && len(pathList) == 2 && pathList[1] == "sql":
+		if h.checkMethod(writer, request, http.MethodPost) {
+			result, err = h.sqlFilter(writer, request)
+		}
+	case pathList[0] == "filters" && len(pathList) == 2 && pathList[1] == "es":
+		if h.checkMethod(writer, request, http.MethodPost) {
+			result, err = h.esFilter(writer, request)
+		}
+	default:
+		writeJSON(writer, http.StatusNotFound, &errorResponse{Error: "not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(writer, getErrorStatus(err), &errorResponse{Error: err.Error()})
+		return
+	}
+	if result != nil {
+		writeJSON(writer, http.StatusOK, result)
+	}
+}
+
+//方法不在 methodList 中时返回 405
+func (h *Handler) checkMethod(writer http.ResponseWriter, request *http.Request, methodList ...string) bool {
+	for _, method := range methodList {
+		if request.Method == method {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methodList, ", "))
+	writeJSON(writer, http.StatusMethodNotAllowed, &errorResponse{Error: "method not allowed"})
+	return false
+}
+
+func (h *Handler) listSchema() ([]*SchemaResponse, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	resultList := make([]*SchemaResponse, 0, len(h.schemaMap))
+	for name, schema := range h.schemaMap {
+		version, err := schema.Version()
+		if err != nil {
+			return nil, err
+		}
+		resultList = append(resultList, &SchemaResponse{Name: name, Version: version, Schema: schema})
+	}
+	sort.Slice(resultList, func(i, j int) bool { return resultList[i].Name < resultList[j].Name })
+	return resultList, nil
+}
+
+func (h *Handler) getSchema(name string) (*SchemaResponse, error) {
+	h.mutex.RLock()
+	schema, ok := h.schemaMap[name]
+	h.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, name)
+	}
+	version, err := schema.Version()
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaResponse{Name: name, Version: version, Schema: schema}, nil
+}
+
+//注册 schema，同名 schema 直接替换，已写入的策略仍使用编译时的 schema；元素个数超过 MaxSchemaCellNum 时返回 ErrSchemaTooLarge
+func (h *Handler) putSchema(writer http.ResponseWriter, request *http.Request, name string) (*SchemaResponse, error) {
+	schema := &my_utils.MDSchema{}
+	if err := h.decode(writer, request, schema); err != nil {
+		return nil, err
+	}
+	cellNum := int64(1)
+	for _, length := range schema.LengthList() {
+		if cellNum > h.option.MaxSchemaCellNum/length {
+			return nil, fmt.Errorf("%w: length list %v exceeds %d cells", ErrSchemaTooLarge, schema.LengthList(), h.option.MaxSchemaCellNum)
+		}
+		cellNum *= length
+	}
+	version, err := schema.Version()
+	if err != nil {
+		return nil, err
+	}
+	h.mutex.Lock()
+	h.schemaMap[name] = schema
+	h.mutex.Unlock()
+	return &SchemaResponse{Name: name, Version: version, Schema: schema}, nil
+}
+
+func (h *Handler) putPolicy(writer http.ResponseWriter, request *http.Request, name string) (*my_utils.Policy, error) {
+	var body PutPolicyRequest
+	if err := h.decode(writer, request, &body); err != nil {
+		return nil, err
+	}
+	h.mutex.RLock()
+	schema, ok := h.schemaMap[body.Schema]
+	h.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotFound, body.Schema)
+	}
+	for _, rule := range body.Source {
+		if rule == nil {
+			continue
+		}
+		for _, condition := range rule.ConditionList {
+			if condition != nil {
+				normalizeValueList(condition.ValueList)
+			}
+		}
+	}
+	bitMap, err := h.cache.GetOrCompile(schema, body.Source)
+	if err != nil {
+		return nil, err
+	}
+	return h.store.Put(&my_utils.Policy{Name: name, Source: body.Source, BitMap: bitMap}, body.ExpectedRevision)
+}
+
+func (h *Handler) evaluate(writer http.ResponseWriter, request *http.Request) (*EvaluateResponse, error) {
+	var body EvaluateRequest
+	if err := h.decode(writer, request, &body); err != nil {
+		return nil, err
+	}
+	if body.Record == nil {
+		return nil, fmt.Errorf("%w: record is required", ErrInvalidRequest)
+	}
+	principal, err := h.getPrincipal(body.PolicyList)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateRecord(principal.filter, body.Record), nil
+}
+
+func (h *Handler) batchEvaluate(writer http.ResponseWriter, request *http.Request) (*BatchEvaluateResponse, error) {
+	var body BatchEvaluateRequest
+	if err := h.decode(writer, request, &body); err != nil {
+		return nil, err
+	}
+	if len(body.RecordList) > h.option.MaxBatchSize {
+		return nil, fmt.Errorf("%w: %d records exceed limit %d", ErrInvalidRequest, len(body.RecordList), h.option.MaxBatchSize)
+	}
+	principal, err := h.getPrincipal(body.PolicyList)
+	if err != nil {
+		return nil, err
+	}
+	result := &BatchEvaluateResponse{ResultList: make([]*EvaluateResponse, 0, len(body.RecordList))}
+	for _, record := range body.RecordList {
+		result.ResultList = append(result.ResultList, evaluateRecord(principal.filter, record))
+	}
+	return result, nil
+}
+
+func evaluateRecord(filter *my_utils.MDFilter, record map[string]interface{}) *EvaluateResponse {
+	if record == nil {
+		return &EvaluateResponse{Reason: "record is null"}
+	}
+	for function, value := range record {
+		record[function] = normalizeValue(value)
+	}
+	allowed, reason, err := filter.Check(record)
+	if err != nil {
+		return &EvaluateResponse{Reason: err.Error()}
+	}
+	if allowed {
+		return &EvaluateResponse{Allow: true}
+	}
+	return &EvaluateResponse{Reason: reason.Message}
+}
+
+func (h *Handler) sqlFilter(writer http.ResponseWriter, request *http.Request) (*SQLFilterResponse, error) {
+	var body SQLFilterRequest
+	if err := h.decode(writer, request, &body); err != nil {
+		return nil, err
+	}
+	option := &my_utils.SQLOption{ColumnMap: h.option.SQLColumnMap, PlaceholderOffset: body.PlaceholderOffset}
+	switch body.Dialect {
+	case "", "mysql":
+		option.Dialect = my_utils.SQLDialectMySQL
+	case "postgresql":
+		option.Dialect = my_utils.SQLDialectPostgreSQL
+	default:
+		return nil, fmt.Errorf("%w: unknown dialect %q", ErrInvalidRequest, body.Dialect)
+	}
+	if body.PlaceholderOffset < 0 {
+		return nil, fmt.Errorf("%w: negative placeholder offset", ErrInvalidRequest)
+	}
+	principal, err := h.getPrincipal(body.PolicyList)
+	if err != nil {
+		return nil, err
+	}
+	bitMap := principal.bitMap
+	where, argList, err := bitMap.ToSQLWhere(bitMap.Schema(), option)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLFilterResponse{Where: where, ArgList: argList}, nil
+}
+
+func (h *Handler) esFilter(writer http.ResponseWriter, request *http.Request) (*ESFilterResponse, error) {
+	var body ESFilterRequest
+	if err := h.decode(writer, request, &body); err != nil {
+		return nil, err
+	}
+	principal, err := h.getPrincipal(body.PolicyList)
+	if err != nil {
+		return nil, err
+	}
+	bitMap := principal.bitMap
+	query, err := bitMap.ToESQuery(bitMap.Schema(), &my_utils.ESOption{FieldMap: h.option.ESFieldMap})
+	if err != nil {
+		return nil, err
+	}
+	return &ESFilterResponse{Query: query}, nil
+}
+
+//主体的所有策略做或运算后的位图及过滤器，各策略必须基于同一版本的 schema；策略版本不变时使用缓存
+func (h *Handler) getPrincipal(policyNameList []string) (*principal, error) {
+	if len(policyNameList) == 0 {
+		return nil, fmt.Errorf("%w: policy_list is required", ErrInvalidRequest)
+	}
+	policyList := make([]*my_utils.Policy, 0, len(policyNameList))
+	keyList := make([]string, 0, len(policyNameList))
+	for _, name := range policyNameList {
+		policy, err := h.store.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		policyList = append(policyList, policy)
+		keyList = append(keyList, strconv.Quote(name)+"@"+strconv.FormatInt(policy.Revision, 10))
+	}
+	//各策略之间为或关系，与顺序无关
+	sort.Strings(keyList)
+	key := strings.Join(keyList, ",")
+	h.principalMutex.Lock()
+	if element, ok := h.principalMap[key]; ok {
+		h.principalList.MoveToFront(element)
+		h.principalMutex.Unlock()
+		return element.Value.(*principal), nil
+	}
+	h.principalMutex.Unlock()
+
+	result, err := newPrincipal(key, policyList)
+	if err != nil {
+		return nil, err
+	}
+	h.principalMutex.Lock()
+	defer h.principalMutex.Unlock()
+	//并发请求可能已经加入缓存
+	if element, ok := h.principalMap[key]; ok {
+		h.principalList.MoveToFront(element)
+		return element.Value.(*principal), nil
+	}
+	h.principalMap[key] = h.principalList.PushFront(result)
+	for h.principalList.Len() > h.option.PrincipalCacheSize {
+		delete(h.principalMap, h.principalList.Remove(h.principalList.Back()).(*principal).key)
+	}
+	return result, nil
+}
+
+//策略做或运算并生成过滤器，记录为 维度 → 取值 的 map
+func newPrincipal(key string, policyList []*my_utils.Policy) (*principal, error) {
+	var bitMap *my_utils.MDBitMap
+	var schemaVersion string
+	for _, policy := range policyList {
+		if policy.BitMap.Schema() == nil {
+			return nil, fmt.Errorf("%w: policy %s has no schema", ErrInvalidRequest, policy.Name)
+		}
+		if bitMap == nil {
+			bitMap, schemaVersion = policy.BitMap, policy.SchemaVersion
+			continue
+		}
+		if policy.SchemaVersion != schemaVersion {
+			return nil, fmt.Errorf("%w: policy %s uses a different schema version", ErrInvalidRequest, policy.Name)
+		}
+		var err error
+		if bitMap, err = bitMap.OrMDBitMap(policy.BitMap); err != nil {
+			return nil, err
+		}
+	}
+	schema := bitMap.Schema()
+	extractorMap := make(map[string]my_utils.FieldExtractor)
+	for _, function := range schema.FunctionList() {
+		function := function
+		extractorMap[function] = func(record interface{}) (interface{}, error) {
+			return record.(map[string]interface{})[function], nil
+		}
+	}
+	filter, err := my_utils.InitMDFilter(bitMap, schema, extractorMap)
+	if err != nil {
+		return nil, err
+	}
+	return &principal{key: key, bitMap: bitMap, filter: filter}, nil
+}
+
+//请求体按 json.Number 解析数值，转换为 int64 或 float64，避免大整数经 float64 解析丢失精度
+func normalizeValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if intValue, err := number.Int64(); err == nil {
+		return intValue
+	}
+	floatValue, _ := number.Float64()
+	return floatValue
+}
+
+func normalizeValueList(valueList []interface{}) {
+	for i, value := range valueList {
+		valueList[i] = normalizeValue(value)
+	}
+}
+
+//解析请求体，限制大小且不允许未知字段，数值解析为 json.Number，由调用方转换
+func (h *Handler) decode(writer http.ResponseWriter, request *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, h.option.MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: unexpected data after json body", ErrInvalidRequest)
+	}
+	return nil
+}
+
+//错误对应的 http 状态码
+func getErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, my_utils.ErrPolicyNotFound), errors.Is(err, ErrSchemaNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, my_utils.ErrRevisionConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, my_utils.ErrInvalidPolicy),
+		errors.Is(err, my_utils.ErrInvalidSchema), errors.Is(err, my_utils.ErrInvalidCondition),
+		errors.Is(err, my_utils.ErrFunctionNotFound), errors.Is(err, my_utils.ErrValueNotFound),
+		errors.Is(err, my_utils.ErrInvalidInterval):
+		return http.StatusBadRequest
+	case errors.Is(err, my_utils.ErrSQLInListTooLarge), errors.Is(err, my_utils.ErrESTermsTooLarge),
+		errors.Is(err, my_utils.ErrSQLColumnNotFound), errors.Is(err, my_utils.ErrESFieldNotFound),
+		errors.Is(err, my_utils.ErrCompileLimitExceeded), errors.Is(err, ErrSchemaTooLarge):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
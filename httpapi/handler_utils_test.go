@@ -0,0 +1,239 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	my_utils "github.com/Hzg030/go_util"
+)
+
+const testSchemaBody = `{"function_list":[
+	{"function":"country","type":"discrete","value_list":["SG","MY"]},
+	{"function":"employee_id","type":"discrete","value_list":[9007199254740993,2]},
+	{"function":"salary","type":"range","boundary_list":[5000]}]}`
+
+//发送请求，返回状态码，响应体解析到 result（可为 nil）
+func doRequest(t *testing.T, h http.Handler, method string, path string, body string, result interface{}) int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if result != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+			t.Fatalf("%s %s: %v, body %s", method, path, err, recorder.Body.String())
+		}
+	}
+	return recorder.Code
+}
+
+//注册 schema 及策略 sg（country=SG）、rich（salary>5000）
+func initTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	h := InitHandler(my_utils.InitMemoryPolicyStore(), &HandlerOption{MaxBatchSize: 3})
+	requestList := []struct {
+		path string
+		body string
+	}{
+		{"/schemas/hr", testSchemaBody},
+		{"/policies/sg", `{"schema":"hr","source":[{"condition_list":[{"function":"country","value_list":["SG"]}]}]}`},
+		{"/policies/rich", `{"schema":"hr","source":[{"condition_list":[{"function":"salary","operator":"gt","value_list":[5000]}]}]}`},
+	}
+	for _, request := range requestList {
+		if code := doRequest(t, h, http.MethodPut, request.path, request.body, nil); code != http.StatusOK {
+			t.Fatalf("PUT %s status %d", request.path, code)
+		}
+	}
+	return h
+}
+
+func TestHandlerEvaluate(t *testing.T) {
+	h := initTestHandler(t)
+	caseList := []struct {
+		body  string
+		allow bool
+	}{
+		{`{"policy_list":["sg","rich"],"record":{"country":"SG","employee_id":2,"salary":1000}}`, true},
+		{`{"policy_list":["sg","rich"],"record":{"country":"MY","employee_id":2,"salary":6000}}`, true},
+		{`{"policy_list":["sg"],"record":{"country":"MY","employee_id":2,"salary":6000}}`, false},
+		//大整数按 json.Number 解析
+		{`{"policy_list":["rich"],"record":{"country":"MY","employee_id":9007199254740993,"salary":5000.5}}`, true},
+		{`{"policy_list":["sg"],"record":{"country":"TH","employee_id":2,"salary":1}}`, false},
+	}
+	for _, testCase := range caseList {
+		var result EvaluateResponse
+		if code := doRequest(t, h, http.MethodPost, "/evaluate", testCase.body, &result); code != http.StatusOK {
+			t.Fatalf("evaluate %s status %d", testCase.body, code)
+		}
+		if result.Allow != testCase.allow || (!result.Allow && result.Reason == "") {
+			t.Errorf("evaluate %s = %+v, want allow %v", testCase.body, result, testCase.allow)
+		}
+	}
+}
+
+//大整数取值精确比较，9007199254740992 与 9007199254740993 转换为 float64 后相同，但不能命中同一个槽位
+func TestHandlerEvaluateExactInteger(t *testing.T) {
+	h := initTestHandler(t)
+	body := `{"schema":"hr","source":[{"condition_list":[{"function":"employee_id","value_list":[9007199254740993]}]}]}`
+	if code := doRequest(t, h, http.MethodPut, "/policies/big", body, nil); code != http.StatusOK {
+		t.Fatalf("PUT /policies/big status %d", code)
+	}
+	caseList := []struct {
+		employeeID string
+		allow      bool
+	}{
+		{"9007199254740993", true},
+		{"9007199254740992", false},
+		{"2", false},
+	}
+	for _, testCase := range caseList {
+		var result EvaluateResponse
+		body := `{"policy_list":["big"],"record":{"country":"SG","employee_id":` + testCase.employeeID + `,"salary":1}}`
+		if code := doRequest(t, h, http.MethodPost, "/evaluate", body, &result); code != http.StatusOK {
+			t.Fatalf("evaluate %s status %d", body, code)
+		}
+		if result.Allow != testCase.allow {
+			t.Errorf("evaluate employee_id %s = %+v, want allow %v", testCase.employeeID, result, testCase.allow)
+		}
+	}
+}
+
+func TestHandlerBatchEvaluate(t *testing.T) {
+	h := initTestHandler(t)
+	var result BatchEvaluateResponse
+	body := `{"policy_list":["rich","sg"],"record_list":[
+		{"country":"MY","employee_id":2,"salary":6000},
+		{"country":"MY","employee_id":2,"salary":5000},
+		null]}`
+	if code := doRequest(t, h, http.MethodPost, "/evaluate/batch", body, &result); code != http.StatusOK {
+		t.Fatalf("batch evaluate status %d", code)
+	}
+	allowList := make([]bool, 0, len(result.ResultList))
+	for _, evaluateResult := range result.ResultList {
+		allowList = append(allowList, evaluateResult.Allow)
+	}
+	if !reflect.DeepEqual(allowList, []bool{true, false, false}) {
+		t.Fatalf("batch evaluate allow list %v", allowList)
+	}
+	body = `{"policy_list":["sg"],"record_list":[{},{},{},{}]}`
+	if code := doRequest(t, h, http.MethodPost, "/evaluate/batch", body, nil); code != http.StatusBadRequest {
+		t.Fatalf("oversized batch status %d, want 400", code)
+	}
+}
+
+func TestHandlerClientError(t *testing.T) {
+	h := initTestHandler(t)
+	caseList := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{http.MethodPost, "/evaluate", `{"policy_list":["sg"],"record":{},"bogus":1}`, http.StatusBadRequest},
+		{http.MethodPost, "/evaluate", `{"policy_list":["sg"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/evaluate", `{"policy_list":[],"record":{}}`, http.StatusBadRequest},
+		{http.MethodPost, "/evaluate", `{"policy_list":["nobody"],"record":{}}`, http.StatusNotFound},
+		{http.MethodPost, "/evaluate", `{"policy_list":["sg"],"record":{}} {}`, http.StatusBadRequest},
+		{http.MethodGet, "/evaluate", ``, http.StatusMethodNotAllowed},
+		{http.MethodPut, "/policies/sg", `{"schema":"hr","source":[],"expected_revision":0}`, http.StatusConflict},
+		{http.MethodPut, "/policies/x", `{"schema":"nothing","source":[]}`, http.StatusNotFound},
+		{http.MethodPut, "/policies/x", `{"schema":"hr","source":[{"condition_list":[{"function":"level","value_list":[1]}]}]}`, http.StatusBadRequest},
+		{http.MethodPost, "/filters/sql", `{"policy_list":["sg"],"dialect":"oracle"}`, http.StatusBadRequest},
+		{http.MethodGet, "/nothing", ``, http.StatusNotFound},
+	}
+	for _, testCase := range caseList {
+		var result errorResponse
+		code := doRequest(t, h, testCase.method, testCase.path, testCase.body, &result)
+		if code != testCase.code || result.Error == "" {
+			t.Errorf("%s %s %s status %d %+v, want %d", testCase.method, testCase.path, testCase.body, code, result, testCase.code)
+		}
+	}
+}
+
+//策略版本不变时复用主体缓存，写入新版本后重新生成
+func TestHandlerPrincipalCache(t *testing.T) {
+	h := initTestHandler(t)
+	first, err := h.getPrincipal([]string{"sg", "rich"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.getPrincipal([]string{"rich", "sg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("principal should be cached regardless of policy order")
+	}
+	body := `{"schema":"hr","source":[{"condition_list":[{"function":"country","value_list":["MY"]}]}],"expected_revision":1}`
+	if code := doRequest(t, h, http.MethodPut, "/policies/sg", body, nil); code != http.StatusOK {
+		t.Fatalf("PUT /policies/sg status %d", code)
+	}
+	third, err := h.getPrincipal([]string{"sg", "rich"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Fatal("principal should be rebuilt after policy update")
+	}
+	var result EvaluateResponse
+	evaluateBody := `{"policy_list":["sg","rich"],"record":{"country":"MY","employee_id":2,"salary":1}}`
+	if doRequest(t, h, http.MethodPost, "/evaluate", evaluateBody, &result); !result.Allow {
+		t.Fatalf("evaluate after update = %+v", result)
+	}
+	//超过上限时淘汰最久未使用的主体
+	h.option.PrincipalCacheSize = 2
+	for _, policyNameList := range [][]string{{"sg"}, {"rich"}, {"rich", "sg"}} {
+		if _, err := h.getPrincipal(policyNameList); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h.principalList.Len() != 2 || len(h.principalMap) != 2 {
+		t.Fatalf("principal cache size %d, want 2", h.principalList.Len())
+	}
+}
+
+//4 个离散维度、每个维度 2000 个取值的 schema
+func getLargeSchemaBody() string {
+	functionList := make([]string, 0, 4)
+	for i := 0; i < 4; i++ {
+		valueList := make([]string, 0, 2000)
+		for j := 0; j < 2000; j++ {
+			valueList = append(valueList, strconv.Itoa(j))
+		}
+		functionList = append(functionList, fmt.Sprintf(`{"function":"f%d","type":"discrete","value_list":[%s]}`, i, strings.Join(valueList, ",")))
+	}
+	return `{"function_list":[` + strings.Join(functionList, ",") + `]}`
+}
+
+//schema 或编译结果过大时返回 422，不能申请位图内存
+func TestHandlerLimit(t *testing.T) {
+	h := InitHandler(my_utils.InitMemoryPolicyStore(), nil)
+	var result errorResponse
+	if code := doRequest(t, h, http.MethodPut, "/schemas/large", getLargeSchemaBody(), &result); code != http.StatusUnprocessableEntity {
+		t.Fatalf("PUT large schema status %d, error %s", code, result.Error)
+	}
+	//schema 上限放开后，编译仍受默认编译限制
+	h = InitHandler(my_utils.InitMemoryPolicyStore(), &HandlerOption{MaxSchemaCellNum: math.MaxInt64, MaxBodyBytes: 1 << 22})
+	if code := doRequest(t, h, http.MethodPut, "/schemas/large", getLargeSchemaBody(), nil); code != http.StatusOK {
+		t.Fatalf("PUT large schema status %d", code)
+	}
+	body := `{"schema":"large","source":[{"condition_list":[{"function":"f0","value_list":[1]}]}]}`
+	if code := doRequest(t, h, http.MethodPut, "/policies/large", body, &result); code != http.StatusUnprocessableEntity {
+		t.Fatalf("PUT policy on large schema status %d, error %s", code, result.Error)
+	}
+	//配置的编译限制同样生效
+	h = InitHandler(my_utils.InitMemoryPolicyStore(), &HandlerOption{
+		CacheOption: &my_utils.PolicyCacheOption{CompileOption: &my_utils.CompileOption{MaxExpansion: 2}}})
+	if code := doRequest(t, h, http.MethodPut, "/schemas/hr", testSchemaBody, nil); code != http.StatusOK {
+		t.Fatalf("PUT schema status %d", code)
+	}
+	body = `{"schema":"hr","source":[{"condition_list":[{"function":"country","value_list":["SG"]}]}]}`
+	if code := doRequest(t, h, http.MethodPut, "/policies/sg", body, nil); code != http.StatusUnprocessableEntity {
+		t.Fatalf("PUT policy over expansion limit status %d", code)
+	}
+}
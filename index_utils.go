@@ -0,0 +1,144 @@
+package my_utils
+
+// Strides 返回 MDBitMap 各维度步长，即下标在该维度加 1 时平铺偏移量的增量
+/**
+ * @Description 按下标顺序平铺，最后一个维度变化最快
+ * @e.g.
+	lengthList: [3,4,5]
+	返回：[20,5,1]
+ **/
+func (m *MDBitMap) Strides() []int64 {
+	strideList := make([]int64, len(m.strideList))
+	copy(strideList, m.strideList)
+	return strideList
+}
+
+// Flatten 下标转换为平铺偏移量
+/**
+ * @Description 偏移量 = Σ indexList[i] * strides[i]，取值范围 [0, 元素总数)
+ * @e.g.
+	lengthList: [3,4], indexList: [2,1]
+	返回：9
+ **/
+func (m *MDBitMap) Flatten(indexList []int64) (int64, error) {
+	if err := checkIndexList(m.lengthList, indexList); err != nil {
+		return 0, err
+	}
+	return m.flatten(indexList), nil
+}
+
+// Unflatten 平铺偏移量转换为下标，Flatten 的逆运算
+/**
+ * @Description 偏移量越界时返回 *IndexOutOfRangeError，Dimension 为 -1
+ * @e.g.
+	lengthList: [3,4], offset: 9
+	返回：[2,1]
+ **/
+func (m *MDBitMap) Unflatten(offset int64) ([]int64, error) {
+	if offset < 0 || offset >= m.getCellCount() {
+		return nil, &IndexOutOfRangeError{Dimension: -1, Index: offset, Length: m.getCellCount()}
+	}
+	indexList := make([]int64, len(m.strideList))
+	for i, stride := range m.strideList {
+		indexList[i] = offset / stride
+		offset %= stride
+	}
+	return indexList, nil
+}
+
+// Cursor 按下标顺序遍历位图全部元素的游标
+func (m *MDBitMap) Cursor() *MDIndexCursor {
+	return InitMDIndexCursor(m.lengthList, nil)
+}
+
+//调用方需保证下标合法
+func (m *MDBitMap) flatten(indexList []int64) int64 {
+	offset := int64(0)
+	for i, index := range indexList {
+		offset += index * m.strideList[i]
+	}
+	return offset
+}
+
+// MDIndexCursor 多维下标游标，原地递增下标，遍历时不会为每个元素分配下标数组
+/**
+ * @Description 下标前缀固定，其余维度按下标顺序（最后一个维度变化最快）递增，同时维护平铺偏移量
+ * @e.g.
+	cursor := InitMDIndexCursor([]int64{3, 4}, []int64{1})
+	for cursor.Next() {
+		cursor.IndexList() 依次为 [1,0],[1,1],[1,2],[1,3]
+		cursor.Offset()    依次为 4,5,6,7
+	}
+ **/
+type MDIndexCursor struct {
+	lengthList []int64
+	indexList  []int64
+	offset     int64
+	// 固定前缀的维度个数
+	fixedNum int
+	started  bool
+	end      bool
+}
+
+// InitMDIndexCursor 构造方法，prefixIndexList 为固定的下标前缀，可以为空；调用方需保证前缀合法
+func InitMDIndexCursor(lengthList []int64, prefixIndexList []int64) *MDIndexCursor {
+	cursor := &MDIndexCursor{
+		lengthList: lengthList,
+		indexList:  make([]int64, len(lengthList)),
+		fixedNum:   len(prefixIndexList),
+	}
+	copy(cursor.indexList, prefixIndexList)
+	strideList := getStrideList(lengthList)
+	for i, index := range prefixIndexList {
+		cursor.offset += index * strideList[i]
+	}
+	return cursor
+}
+
+// Next 移动到下一个下标，已遍历完时返回 false；首次调用移动到第一个下标
+func (c *MDIndexCursor) Next() bool {
+	if c.end {
+		return false
+	}
+	if !c.started {
+		c.started = true
+		return true
+	}
+	c.offset++
+	//从最后一个维度开始进位
+	for i := len(c.indexList) - 1; i >= c.fixedNum; i-- {
+		c.indexList[i]++
+		if c.indexList[i] < c.lengthList[i] {
+			return true
+		}
+		c.indexList[i] = 0
+	}
+	c.end = true
+	return false
+}
+
+// IndexList 当前下标，游标原地修改该数组，如需保存请自行拷贝
+func (c *MDIndexCursor) IndexList() []int64 {
+	return c.indexList
+}
+
+// Offset 当前下标的平铺偏移量
+func (c *MDIndexCursor) Offset() int64 {
+	return c.offset
+}
+
+//各维度步长
+func getStrideList(lengthList []int64) []int64 {
+	strideList := make([]int64, len(lengthList))
+	stride := int64(1)
+	for i := len(lengthList) - 1; i >= 0; i-- {
+		strideList[i] = stride
+		stride *= lengthList[i]
+	}
+	return strideList
+}
+
+//存放 cellCount 个位需要的 uint64 个数
+func getWordNum(cellCount int64) int64 {
+	return cellCount/64 + (cellCount%64+63)/64
+}
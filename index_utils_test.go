@@ -0,0 +1,59 @@
+package my_utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFlattenUnflatten(t *testing.T) {
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{3, 4, 5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strideList := bitMap.Strides(); !equalInt64List(strideList, []int64{20, 5, 1}) {
+		t.Fatalf("Strides() = %v", strideList)
+	}
+	cursor := bitMap.Cursor()
+	for expectOffset := int64(0); cursor.Next(); expectOffset++ {
+		offset, err := bitMap.Flatten(cursor.IndexList())
+		if err != nil || offset != expectOffset || cursor.Offset() != expectOffset {
+			t.Fatalf("Flatten(%v) = %d, %v, cursor offset %d, want %d", cursor.IndexList(), offset, err, cursor.Offset(), expectOffset)
+		}
+		indexList, err := bitMap.Unflatten(offset)
+		if err != nil || !equalInt64List(indexList, cursor.IndexList()) {
+			t.Fatalf("Unflatten(%d) = %v, %v, want %v", offset, indexList, err, cursor.IndexList())
+		}
+	}
+	for _, offset := range []int64{-1, 60} {
+		_, err := bitMap.Unflatten(offset)
+		var rangeError *IndexOutOfRangeError
+		if !errors.As(err, &rangeError) || rangeError.Dimension != -1 || rangeError.Index != offset || rangeError.Length != 60 {
+			t.Errorf("Unflatten(%d) error %#v", offset, err)
+		}
+		if !errors.Is(err, ErrMDBitMapIndexOutOfRange) {
+			t.Errorf("Unflatten(%d) error %v should wrap ErrMDBitMapIndexOutOfRange", offset, err)
+		}
+	}
+	var rangeError *IndexOutOfRangeError
+	if _, err := bitMap.Flatten([]int64{1, 4, 0}); !errors.As(err, &rangeError) || rangeError.Dimension != 1 {
+		t.Errorf("Flatten out of range error %v", err)
+	}
+	var lengthError *InconsistentLengthError
+	if _, err := bitMap.Flatten([]int64{1, 1}); !errors.As(err, &lengthError) {
+		t.Errorf("Flatten inconsistent length error %v", err)
+	}
+}
+
+func TestMDIndexCursorPrefix(t *testing.T) {
+	cursor := InitMDIndexCursor([]int64{3, 4}, []int64{1})
+	offsetList := make([]int64, 0)
+	for cursor.Next() {
+		if cursor.IndexList()[0] != 1 {
+			t.Fatalf("prefix changed: %v", cursor.IndexList())
+		}
+		offsetList = append(offsetList, cursor.Offset())
+	}
+	if !equalInt64List(offsetList, []int64{4, 5, 6, 7}) {
+		t.Fatalf("offset list %v", offsetList)
+	}
+}
@@ -1,5 +1,16 @@
 package my_utils
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidInterval 区间字符串格式不合法
+var ErrInvalidInterval = errors.New("invalid interval")
+
 type Interval struct {
 	leftEqual     bool
 	leftBoundary  *float64
@@ -15,13 +26,15 @@ func InitInterval(leftBoundary *float64, leftEqual bool, rightBoundary *float64,
 	if rightBoundary == nil {
 		rightEqual = false
 	}
-	if *leftBoundary > *rightBoundary {
-		//	TODO raise err?
-		return nil
-	}
-	if *leftBoundary == *rightBoundary {
-		leftEqual = true
-		rightEqual = true
+	if leftBoundary != nil && rightBoundary != nil {
+		if *leftBoundary > *rightBoundary {
+			//	TODO raise err?
+			return nil
+		}
+		if *leftBoundary == *rightBoundary {
+			leftEqual = true
+			rightEqual = true
+		}
 	}
 	return &Interval{
 		leftEqual:     leftEqual,
@@ -183,3 +196,91 @@ func (i *Interval) Overlap(otherInterval *Interval) bool {
 	}
 	return true
 }
+
+// isPoint 判断区间是否为单点，如 [5000,5000]
+func (i *Interval) isPoint() bool {
+	return i.leftBoundary != nil && i.rightBoundary != nil && *i.leftBoundary == *i.rightBoundary
+}
+
+// String 区间字符串表示，如 (5000,+inf)、[1000,5000)，无穷端点为 -inf / +inf
+func (i *Interval) String() string {
+	left := "(-inf"
+	if i.leftBoundary != nil {
+		left = "(" + strconv.FormatFloat(*i.leftBoundary, 'f', -1, 64)
+		if i.leftEqual {
+			left = "[" + left[1:]
+		}
+	}
+	right := "+inf)"
+	if i.rightBoundary != nil {
+		right = strconv.FormatFloat(*i.rightBoundary, 'f', -1, 64) + ")"
+		if i.rightEqual {
+			right = right[:len(right)-1] + "]"
+		}
+	}
+	return left + "," + right
+}
+
+// ParseInterval 解析 String 生成的区间字符串，如 (5000,+inf)、[1000,5000)
+func ParseInterval(value string) (*Interval, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	boundaryList := strings.Split(value[1:len(value)-1], ",")
+	if len(boundaryList) != 2 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	var left, right *float64
+	leftEqual := value[0] == '['
+	rightEqual := value[len(value)-1] == ']'
+	if (!leftEqual && value[0] != '(') || (!rightEqual && value[len(value)-1] != ')') {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	if leftValue := strings.TrimSpace(boundaryList[0]); leftValue != "-inf" {
+		number, err := strconv.ParseFloat(leftValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+		}
+		left = &number
+	} else if leftEqual {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	if rightValue := strings.TrimSpace(boundaryList[1]); rightValue != "+inf" {
+		number, err := strconv.ParseFloat(rightValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+		}
+		right = &number
+	} else if rightEqual {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	//单点区间必须两端闭合，如 [5000,5000]
+	if left != nil && right != nil && *left == *right && (!leftEqual || !rightEqual) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	interval := InitInterval(left, leftEqual, right, rightEqual)
+	if interval == nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, value)
+	}
+	return interval, nil
+}
+
+// MarshalJSON 序列化为区间字符串
+func (i *Interval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON 从区间字符串反序列化
+func (i *Interval) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	interval, err := ParseInterval(value)
+	if err != nil {
+		return err
+	}
+	*i = *interval
+	return nil
+}
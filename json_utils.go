@@ -0,0 +1,267 @@
+package my_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidJSON json 数据格式不合法或超过大小限制
+var ErrInvalidJSON = errors.New("invalid md bitmap json")
+
+// JSONMode MDBitMap json 格式
+type JSONMode int
+
+const (
+	// JSONModeAuto 元素个数不超过 DenseJSONMaxCellCount 时使用 dense，否则使用 sparse
+	JSONModeAuto JSONMode = iota
+	// JSONModeDense 按维度嵌套的 bool 数组
+	JSONModeDense
+	// JSONModeSparse 只列出取值为 true 的元素，附加 schema 时为带标签的元素，否则为下标
+	JSONModeSparse
+)
+
+const (
+	jsonFormatDense  = "dense"
+	jsonFormatSparse = "sparse"
+)
+
+// DenseJSONMaxCellCount JSONModeAuto 下使用 dense 格式的最大元素个数
+var DenseJSONMaxCellCount int64 = 1024
+
+// MaxJSONCellCount 反序列化时允许的最大元素个数，防止恶意数据申请过大内存
+var MaxJSONCellCount int64 = 1 << 24
+
+// mdBitMapJSON MDBitMap 的 json 结构
+/**
+ * dense：  {"format":"dense","length_list":[2,3],"value":[[false,true,false],[false,false,true]]}
+ * sparse： {"format":"sparse","length_list":[2,3],"index_list":[[0,1],[1,2]]}
+ * 附加 schema 的 sparse：
+ *   {"format":"sparse","length_list":[2,3],"schema":{...},"cell_list":[{"country":"SG","salary":"[5000,5000]"}]}
+ *   cell_list 中离散维度为取值，范围维度为槽位区间字符串
+ **/
+type mdBitMapJSON struct {
+	Format     string                   `json:"format"`
+	LengthList []int64                  `json:"length_list"`
+	Schema     *MDSchema                `json:"schema,omitempty"`
+	Value      json.RawMessage          `json:"value,omitempty"`
+	IndexList  [][]int64                `json:"index_list,omitempty"`
+	CellList   []map[string]interface{} `json:"cell_list,omitempty"`
+}
+
+// MarshalJSON 序列化为 json，使用 JSONModeAuto
+func (m *MDBitMap) MarshalJSON() ([]byte, error) {
+	return m.MarshalJSONWithMode(JSONModeAuto)
+}
+
+// MarshalJSONWithMode 按指定格式序列化为 json，零值位图返回 ErrLengthListEmpty
+func (m *MDBitMap) MarshalJSONWithMode(mode JSONMode) ([]byte, error) {
+	if len(m.lengthList) == 0 {
+		return nil, ErrLengthListEmpty
+	}
+	result := mdBitMapJSON{LengthList: m.lengthList, Schema: m.schema}
+	if mode == JSONModeAuto {
+		mode = JSONModeSparse
+		if m.getCellCount() <= DenseJSONMaxCellCount {
+			mode = JSONModeDense
+		}
+	}
+	switch mode {
+	case JSONModeDense:
+		value, err := json.Marshal(m.getDenseValue(0, 0))
+		if err != nil {
+			return nil, err
+		}
+		result.Format = jsonFormatDense
+		result.Value = value
+	case JSONModeSparse:
+		result.Format = jsonFormatSparse
+		if m.schema == nil {
+			result.IndexList = make([][]int64, 0)
+		} else {
+			result.CellList = make([]map[string]interface{}, 0)
+		}
+		m.rangeSubIndexList(nil, func(indexList []int64, offset int64) bool {
+			if !m.getBit(offset) {
+				return true
+			}
+			if m.schema == nil {
+				result.IndexList = append(result.IndexList, append([]int64{}, indexList...))
+				return true
+			}
+			cell := make(map[string]interface{}, len(indexList))
+			for i, slot := range indexList {
+				function := m.schema.functionList[i]
+				cell[function] = m.schema.getSlotLabel(function, slot)
+			}
+			result.CellList = append(result.CellList, cell)
+			return true
+		})
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %d", ErrInvalidJSON, mode)
+	}
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON 从 json 反序列化，支持 MarshalJSONWithMode 生成的全部格式
+/**
+ * @Description 元素个数超过 MaxJSONCellCount、嵌套数组结构与 length_list 不一致、下标越界、
+ * 标签在 schema 中不存在时返回错误且不修改当前位图
+ **/
+func (m *MDBitMap) UnmarshalJSON(data []byte) error {
+	var result mdBitMapJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	cellCount := int64(1)
+	for _, length := range result.LengthList {
+		if length <= 0 || cellCount > MaxJSONCellCount/length {
+			return fmt.Errorf("%w: cell count exceeds %d", ErrInvalidJSON, MaxJSONCellCount)
+		}
+		cellCount *= length
+	}
+	finalMDBitMap := MDBitMap{}
+	if err := finalMDBitMap.InitMDBitMap(result.LengthList, nil); err != nil {
+		return err
+	}
+	if result.Schema != nil {
+		if err := finalMDBitMap.SetSchema(result.Schema); err != nil {
+			return err
+		}
+	}
+	switch result.Format {
+	case jsonFormatDense:
+		var value interface{}
+		if err := json.Unmarshal(result.Value, &value); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+		}
+		if err := finalMDBitMap.setDenseValue(value, make([]int64, 0, len(result.LengthList))); err != nil {
+			return err
+		}
+	case jsonFormatSparse:
+		if int64(len(result.IndexList)) > cellCount || int64(len(result.CellList)) > cellCount {
+			return fmt.Errorf("%w: more entries than cells", ErrInvalidJSON)
+		}
+		if err := finalMDBitMap.initMDBitMapByIndexList(result.IndexList); err != nil {
+			return err
+		}
+		if len(result.CellList) > 0 && result.Schema == nil {
+			return fmt.Errorf("%w: cell_list requires schema", ErrInvalidJSON)
+		}
+		for _, cell := range result.CellList {
+			indexList, err := result.Schema.getIndexListByLabel(cell)
+			if err != nil {
+				return err
+			}
+			finalMDBitMap.setValue(indexList, true)
+		}
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidJSON, result.Format)
+	}
+	*m = finalMDBitMap
+	return nil
+}
+
+//按 dense 格式的嵌套数组填充位图，校验每层长度与 lengthList 一致
+func (m *MDBitMap) setDenseValue(value interface{}, prefixIndexList []int64) error {
+	depth := len(prefixIndexList)
+	valueList, ok := value.([]interface{})
+	if !ok || int64(len(valueList)) != m.lengthList[depth] {
+		return fmt.Errorf("%w: dense value at %v does not match length list", ErrInvalidJSON, prefixIndexList)
+	}
+	for i, subValue := range valueList {
+		indexList := append(prefixIndexList, int64(i))
+		if depth < len(m.lengthList)-1 {
+			if err := m.setDenseValue(subValue, indexList); err != nil {
+				return err
+			}
+			continue
+		}
+		bit, ok := subValue.(bool)
+		if !ok {
+			return fmt.Errorf("%w: dense value at %v is not bool", ErrInvalidJSON, indexList)
+		}
+		m.setValue(indexList, bit)
+	}
+	return nil
+}
+
+//按维度嵌套的 dense 数组，depth 为当前维度，offset 为当前前缀的平铺偏移量
+func (m *MDBitMap) getDenseValue(depth int, offset int64) []interface{} {
+	valueList := make([]interface{}, m.lengthList[depth])
+	for i := range valueList {
+		subOffset := offset + int64(i)*m.strideList[depth]
+		if depth < len(m.lengthList)-1 {
+			valueList[i] = m.getDenseValue(depth+1, subOffset)
+			continue
+		}
+		valueList[i] = m.getBit(subOffset)
+	}
+	return valueList
+}
+
+//将带标签的元素转换为下标，离散维度为取值，其他取值槽位为 "<other>"，范围维度为槽位区间字符串
+//标签必须与槽位一一对应，不在枚举取值中的标签返回错误，不落入其他取值槽位
+func (s *MDSchema) getIndexListByLabel(cell map[string]interface{}) ([]int64, error) {
+	if len(cell) != len(s.functionList) {
+		return nil, fmt.Errorf("%w: cell %v should have %d functions", ErrInvalidJSON, cell, len(s.functionList))
+	}
+	indexList := make([]int64, len(s.functionList))
+	for i, function := range s.functionList {
+		label, ok := cell[function]
+		if !ok {
+			return nil, fmt.Errorf("%w: cell %v misses function %s", ErrInvalidJSON, cell, function)
+		}
+		if !s.IsRangeFunction(function) {
+			if !isComparableValue(label) {
+				return nil, fmt.Errorf("%w: label %v of function %s is not comparable", ErrInvalidJSON, label, function)
+			}
+			slot, err := s.getLabelSlot(function, normalizeJSONValue(label))
+			if err != nil {
+				return nil, err
+			}
+			indexList[i] = slot
+			continue
+		}
+		slot, err := s.getRangeSlotByLabel(function, label)
+		if err != nil {
+			return nil, err
+		}
+		indexList[i] = slot
+	}
+	return indexList, nil
+}
+
+//根据区间字符串查找范围维度槽位，区间必须与槽位完全一致
+func (s *MDSchema) getRangeSlotByLabel(function string, label interface{}) (int64, error) {
+	labelString, ok := label.(string)
+	if !ok {
+		return 0, fmt.Errorf("%w: label %v of function %s is not an interval", ErrInvalidJSON, label, function)
+	}
+	interval, err := ParseInterval(labelString)
+	if err != nil {
+		return 0, err
+	}
+	//由左边界在边界值中的下标直接确定槽位，再比较槽位区间与标签是否一致
+	slot := int64(0)
+	if interval.leftBoundary != nil {
+		boundaryList := s.boundaryListMap[function]
+		k := sort.SearchFloat64s(boundaryList, *interval.leftBoundary)
+		if k == len(boundaryList) || boundaryList[k] != *interval.leftBoundary {
+			return 0, fmt.Errorf("%w: %s is not a slot of function %s", ErrValueNotFound, labelString, function)
+		}
+		//左闭为边界值本身对应的槽位，左开为其后的开区间
+		slot = int64(2*k + 1)
+		if !interval.leftEqual {
+			slot++
+		}
+	}
+	if s.getSlotInterval(function, slot).String() != interval.String() {
+		return 0, fmt.Errorf("%w: %s is not a slot of function %s", ErrValueNotFound, labelString, function)
+	}
+	return slot, nil
+}
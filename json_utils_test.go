@@ -0,0 +1,164 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMDSchemaJSONRoundTrip(t *testing.T) {
+	schema := newTestSchema(t)
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &MDSchema{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatal(err)
+	}
+	resultData, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resultData) != string(data) {
+		t.Fatalf("schema round trip mismatch\ngot:  %s\nwant: %s", resultData, data)
+	}
+	for _, valueMap := range []map[string]interface{}{
+		{"country": "SG", "salary": 1000},
+		{"country": nil, "salary": 3000},
+		{"country": "VN", "salary": 9000},
+	} {
+		indexList, err := schema.GetIndexList(valueMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resultIndexList, err := result.GetIndexList(valueMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalInt64List(indexList, resultIndexList) {
+			t.Errorf("GetIndexList(%v) = %v, want %v", valueMap, resultIndexList, indexList)
+		}
+	}
+}
+
+func TestMDBitMapJSONRoundTrip(t *testing.T) {
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[
+		{"condition_list":[{"function":"country","value_list":["SG",null]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+		{"condition_list":[{"function":"country","operator":"not_in","value_list":["SG","MY","TH"]},{"function":"salary","value_list":[5000]}]}]`)
+	noSchemaBitMap := bitMap.CopyMDBitMap()
+	if err := noSchemaBitMap.SetSchema(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, testBitMap := range []*MDBitMap{bitMap, noSchemaBitMap} {
+		for _, mode := range []JSONMode{JSONModeAuto, JSONModeDense, JSONModeSparse} {
+			data, err := testBitMap.MarshalJSONWithMode(mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := &MDBitMap{}
+			if err := json.Unmarshal(data, result); err != nil {
+				t.Fatalf("mode %d: %v\n%s", mode, err, data)
+			}
+			if !result.EqualMDBitMap(testBitMap) {
+				t.Errorf("mode %d round trip mismatch: %s", mode, data)
+			}
+		}
+	}
+}
+
+//边界值间隔很小或超过 2^53 时，带标签的元素仍能还原为对应槽位
+func TestMDBitMapJSONRangeLabel(t *testing.T) {
+	schema := &MDSchema{}
+	err := json.Unmarshal([]byte(`{"function_list":[
+		{"function":"ratio","type":"range","boundary_list":[0.1,0.2,0.25]},
+		{"function":"amount","type":"range","boundary_list":[1e18,2e18]}]}`), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap(schema.LengthList(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bitMap.SetSchema(schema); err != nil {
+		t.Fatal(err)
+	}
+	lengthList := schema.LengthList()
+	for i := int64(0); i < lengthList[0]; i++ {
+		for j := int64(0); j < lengthList[1]; j++ {
+			if (i+j)%2 == 0 {
+				bitMap.setBit(bitMap.flatten([]int64{i, j}))
+			}
+		}
+	}
+	data, err := bitMap.MarshalJSONWithMode(JSONModeSparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &MDBitMap{}
+	if err := json.Unmarshal(data, result); err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	if !result.EqualMDBitMap(bitMap) {
+		t.Fatalf("round trip mismatch: %s", data)
+	}
+}
+
+func equalInt64List(aList []int64, bList []int64) bool {
+	if len(aList) != len(bList) {
+		return false
+	}
+	for i := range aList {
+		if aList[i] != bList[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMarshalJSONZeroValue(t *testing.T) {
+	if _, err := json.Marshal(&MDBitMap{}); !errors.Is(err, ErrLengthListEmpty) {
+		t.Fatalf("Marshal zero value error %v", err)
+	}
+	if _, err := (&MDBitMap{}).MarshalJSONWithMode(JSONModeSparse); !errors.Is(err, ErrLengthListEmpty) {
+		t.Fatalf("MarshalJSONWithMode zero value error %v", err)
+	}
+}
+
+//其他取值槽位的标签 "<other>" 不能与枚举取值混淆
+func TestOtherLabel(t *testing.T) {
+	schema := &MDSchema{}
+	err := json.Unmarshal([]byte(`{"function_list":[{"function":"country","type":"discrete","value_list":["SG","<other>"],"other_slot":true}]}`), schema)
+	if !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("schema with value <other> and other slot error %v", err)
+	}
+	//没有其他取值槽位时 "<other>" 是普通取值
+	if err := json.Unmarshal([]byte(`{"function_list":[{"function":"country","type":"discrete","value_list":["SG","<other>"]}]}`), schema); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := schema.GetSlotIndex("country", "<other>"); err != nil || slot != 1 {
+		t.Fatalf("GetSlotIndex(<other>) = %d, %v", slot, err)
+	}
+
+	schema = newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["<other>"]},{"function":"salary","value_list":[1000]}]}]`)
+	if ok, _ := bitMap.CheckMDBitMap([]int64{4, 1}); !ok || bitMap.CountMDBitMap() != 1 {
+		t.Fatalf("condition <other> should cover only the other slot, count %d", bitMap.CountMDBitMap())
+	}
+	data, err := bitMap.MarshalJSONWithMode(JSONModeSparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &MDBitMap{}
+	if err := json.Unmarshal(data, result); err != nil || !result.EqualMDBitMap(bitMap) {
+		t.Fatalf("round trip %s: %v", data, err)
+	}
+	//不在枚举取值中的标签不能落入其他取值槽位
+	label, _ := json.Marshal(OtherValue)
+	invalidData := strings.Replace(string(data), string(label), `"VN"`, 1)
+	if err := json.Unmarshal([]byte(invalidData), result); !errors.Is(err, ErrValueNotFound) {
+		t.Fatalf("Unmarshal %s error %v", invalidData, err)
+	}
+}
@@ -1,23 +1,32 @@
 package my_utils
 
 import (
+	"math/bits"
 	"reflect"
-
-	"git.garena.com/people/core-base/hris-field-management/model/errorcode"
 )
 
+// MDBitMap 多维位图，按下标顺序（最后一个维度变化最快）将全部元素平铺存储为位数组，
+// 下标与平铺偏移量的转换见 Flatten / Unflatten
 type MDBitMap struct {
 	lengthList []int64
-	mapValue   []interface{}
+	// 各维度步长，见 Strides
+	strideList []int64
+	// 平铺后的位数组，偏移量 i 对应 wordList[i/64] 的第 i%64 位，末尾补位恒为 0
+	wordList []uint64
+	// 可选的位图结构描述，不参与相等判断
+	schema *MDSchema
 }
 
+// maxCellNum 位图元素个数上限，位数组最多 2^44 个 uint64，防止元素个数溢出或申请位数组时 panic
+const maxCellNum = 1 << 50
+
 // InitMDBitMap 构造方法
 /**
  * @Author zenggui.huang
  * @Description 初始化 MDBitMap 多维位图
  * @Date 6:06 下午 2022/8/25
  * @Param lengthList MDBitMap 各维度长度， indexList 设置为true的下标数组
- * @return
+ * @return 各维度长度的乘积超过 maxCellNum 时返回 *CellNumError
  * @e.g.
 	输入：length: [3,4], indexList : [[0,1], [2,3]]
 	返回一个 3*4 的二维位图，并将 [0,1], [2,3] 下标元素初始化为true:
@@ -26,14 +35,11 @@ type MDBitMap struct {
 	0 0 0 1
  **/
 func (m *MDBitMap) InitMDBitMap(lengthList []int64, indexList [][]int64) error {
-	if len(lengthList) == 0 {
-		return errorcode.LengthListEmpty
+	if err := checkLengthList(lengthList); err != nil {
+		return err
 	}
-	//任一维度的 长度不能<=0
-	for _, length := range lengthList {
-		if length <= 0 {
-			return errorcode.DimensionLengthTooSmall
-		}
+	if err := checkCellNum(lengthList); err != nil {
+		return err
 	}
 	m.lengthList = lengthList
 	m.createEmptyMDBitmap()
@@ -48,195 +54,207 @@ func (m *MDBitMap) InitMDBitMap(lengthList []int64, indexList [][]int64) error {
 
 //初始化空多维位图
 //示例输入：lengthList = {3,4,5,6}
-//则输出一个 [3][4][5][6]bool 多维位图，其中所有取值都是false
+//则步长为 {120,30,6,1}，位数组共 360 位，其中所有取值都是false
 func (m *MDBitMap) createEmptyMDBitmap() {
-	var mDBitMap []interface{}
-	//从内往外 创建 []interface{} ， 并一层层封装
-	for i := len(m.lengthList) - 1; i >= 0; i-- {
-		if mDBitMap == nil {
-			mDBitMap = make([]interface{}, m.lengthList[i])
-			for j := 0; j < int(m.lengthList[i]); j++ {
-				mDBitMap[j] = false
-			}
-			continue
-		}
-		tempBit := make([]interface{}, m.lengthList[i])
-		for j := 0; j < int(m.lengthList[i]); j++ {
-			copyBit := deepCopy(mDBitMap)
-			tempBit[j] = copyBit
-		}
-		mDBitMap = tempBit
-	}
-	m.mapValue = mDBitMap
+	m.strideList = getStrideList(m.lengthList)
+	m.wordList = make([]uint64, getWordNum(m.getCellCount()))
 }
 
 //根据上送的 下标列表 indexList；将对应下标元素设置为true
 func (m *MDBitMap) initMDBitMapByIndexList(indexList [][]int64) error {
 	for _, subIndexList := range indexList {
-		//subIndexList 长度必须与lengthList长度一致，否则无法填充
-		if len(subIndexList) != len(m.lengthList) {
-			return errorcode.InconsistentLength
+		//subIndexList 长度必须与lengthList长度一致，且 index 下标范围必须在 lengthList[i] 中，否则无法填充
+		if err := checkIndexList(m.lengthList, subIndexList); err != nil {
+			return err
 		}
-		var tempBit []interface{}
-		for i, index := range subIndexList {
-			//index 下标范围必须在 lengthList[i] 中
-			if index < 0 || index >= m.lengthList[i] {
-				return errorcode.MDBitMapIndexOutOfRange
-			}
-			if i == len(subIndexList)-1 {
-				break
-			}
-			if tempBit == nil {
-				tempBit = m.mapValue[index].([]interface{})
-				continue
-			}
-			tempBit = tempBit[index].([]interface{})
+		m.setBit(m.flatten(subIndexList))
+	}
+	return nil
+}
+
+// SetSchema 为位图附加 schema，schema 的维度长度必须与位图一致；传入 nil 表示移除
+func (m *MDBitMap) SetSchema(schema *MDSchema) error {
+	if schema != nil {
+		if err := schema.checkMDBitMap(m); err != nil {
+			return err
 		}
-		tempBit[subIndexList[len(subIndexList)-1]] = true
 	}
+	m.schema = schema
 	return nil
 }
 
+// Schema 返回位图附加的 schema，未附加时返回 nil
+func (m *MDBitMap) Schema() *MDSchema {
+	return m.schema
+}
+
+// LengthList 返回 MDBitMap 各维度长度
+func (m *MDBitMap) LengthList() []int64 {
+	lengthList := make([]int64, len(m.lengthList))
+	copy(lengthList, m.lengthList)
+	return lengthList
+}
+
+// CheckMDBitMap 判断下标 indexList 对应元素是否为 true，零值位图返回 ErrLengthListEmpty
+func (m *MDBitMap) CheckMDBitMap(indexList []int64) (bool, error) {
+	if len(m.lengthList) == 0 {
+		return false, ErrLengthListEmpty
+	}
+	if err := checkIndexList(m.lengthList, indexList); err != nil {
+		return false, err
+	}
+	return m.getBit(m.flatten(indexList)), nil
+}
+
+// CountMDBitMap 统计取值为 true 的元素个数
+func (m *MDBitMap) CountMDBitMap() int64 {
+	count := 0
+	for _, word := range m.wordList {
+		count += bits.OnesCount64(word)
+	}
+	return int64(count)
+}
+
+// CopyMDBitMap 深拷贝位图，schema 为只读结构，与原位图共用
+func (m *MDBitMap) CopyMDBitMap() *MDBitMap {
+	return &MDBitMap{
+		lengthList: m.LengthList(),
+		strideList: m.Strides(),
+		wordList:   append([]uint64{}, m.wordList...),
+		schema:     m.schema,
+	}
+}
+
+//获取下标 indexList 对应元素的取值，调用方需保证下标合法
+func (m *MDBitMap) getValue(indexList []int64) bool {
+	return m.getBit(m.flatten(indexList))
+}
+
+//设置下标 indexList 对应元素的取值，调用方需保证下标合法
+func (m *MDBitMap) setValue(indexList []int64, value bool) {
+	if value {
+		m.setBit(m.flatten(indexList))
+	} else {
+		m.clearBit(m.flatten(indexList))
+	}
+}
+
+//平铺偏移量 offset 对应元素的取值
+func (m *MDBitMap) getBit(offset int64) bool {
+	return m.wordList[offset>>6]&(1<<(uint64(offset)&63)) != 0
+}
+
+func (m *MDBitMap) setBit(offset int64) {
+	m.wordList[offset>>6] |= 1 << (uint64(offset) & 63)
+}
+
+func (m *MDBitMap) clearBit(offset int64) {
+	m.wordList[offset>>6] &^= 1 << (uint64(offset) & 63)
+}
+
 /*
-获取当前 MDBitMap 所有下标列表
-假设当前 MDBitMap 的lengthList = [3,4]
-则返回 allIndexList = [
-		[0,0],[0,1],[0,2],[0,3],
-		[1,0],[1,1],[1,2],[1,3],
-		[2,0],[2,1],[2,2],[2,3],
-	  ]
+按下标顺序遍历以 prefixIndexList 为前缀的所有下标，不会预先生成全部下标列表
+假设 lengthList = [3,4]，prefixIndexList = [1]
+则依次回调 [1,0],[1,1],[1,2],[1,3]，及其平铺偏移量 4,5,6,7
+回调中的 indexList 会被复用，如需保存请自行拷贝；回调返回 false 时停止遍历
 */
-func (m *MDBitMap) getAllIndexList() [][]int64 {
-	allIndexList := make([][]int64, 0)
-	for i := len(m.lengthList) - 1; i >= 0; i-- {
-		subIndexList := make([][]int64, 0)
-		if len(allIndexList) == 0 {
-			for j := 0; j < int(m.lengthList[i]); j++ {
-				temp := make([]int64, len(m.lengthList))
-				temp[i] = int64(j)
-				subIndexList = append(subIndexList, temp)
-			}
-			allIndexList = subIndexList
-			continue
+func (m *MDBitMap) rangeSubIndexList(prefixIndexList []int64, fn func(indexList []int64, offset int64) bool) bool {
+	cursor := InitMDIndexCursor(m.lengthList, prefixIndexList)
+	for cursor.Next() {
+		if !fn(cursor.indexList, cursor.offset) {
+			return false
 		}
-		for j := 0; j < len(allIndexList); j++ {
-			for k := 0; k < int(m.lengthList[i]); k++ {
-				copyList := make([]int64, len(m.lengthList))
-				copy(copyList, allIndexList[j])
-				copyList[i] = int64(k)
-				subIndexList = append(subIndexList, copyList)
-			}
-		}
-		allIndexList = subIndexList
 	}
-	return allIndexList
+	return true
 }
 
 // 	OrMDBitMap 或运算， 与targetMDBitMap 位图做或运算并返回新的 bitMap
 func (m *MDBitMap) OrMDBitMap(targetBitMap *MDBitMap) (*MDBitMap, error) {
 	// 若结构不一致，抛出异常
-	if !reflect.DeepEqual(m.lengthList, targetBitMap.lengthList) {
-		return nil, errorcode.InconsistentMap
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
+		return nil, err
 	}
-	finalMDBitMap := MDBitMap{}
-	finalMDBitMap.InitMDBitMap(m.lengthList, nil)
-	//获取所有下标 allIndexList 以进行逐个遍历运算
-	allIndexList := m.getAllIndexList()
-	for _, indexList := range allIndexList {
-		var source []interface{}
-		var target []interface{}
-		var final []interface{}
-		for i, index := range indexList {
-			if i == len(indexList)-1 {
-				break
-			}
-			if i == 0 {
-				source = m.mapValue[index].([]interface{})
-				target = targetBitMap.mapValue[index].([]interface{})
-				final = finalMDBitMap.mapValue[index].([]interface{})
-			} else {
-				source = source[index].([]interface{})
-				target = target[index].([]interface{})
-				final = final[index].([]interface{})
-			}
-		}
-		final[indexList[len(indexList)-1]] = source[indexList[len(indexList)-1]].(bool) || target[indexList[len(indexList)-1]].(bool)
+	finalMDBitMap := m.newEmptyMDBitMap()
+	for i, word := range m.wordList {
+		finalMDBitMap.wordList[i] = word | targetBitMap.wordList[i]
 	}
-	return &finalMDBitMap, nil
+	return finalMDBitMap, nil
 }
 
 // 	AndMDBitMap 与运算， 与targetMDBitMap 位图做与运算并返回新的 bitMap
 func (m *MDBitMap) AndMDBitMap(targetBitMap *MDBitMap) (*MDBitMap, error) {
 	// 若结构不一致，抛出异常
-	if !reflect.DeepEqual(m.lengthList, targetBitMap.lengthList) {
-		return nil, errorcode.InconsistentMap
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
+		return nil, err
 	}
-	finalMDBitMap := MDBitMap{}
-	finalMDBitMap.InitMDBitMap(m.lengthList, nil)
-	//获取所有下标 allIndexList 以进行逐个遍历运算
-	allIndexList := m.getAllIndexList()
-	for _, indexList := range allIndexList {
-		var source []interface{}
-		var target []interface{}
-		var final []interface{}
-		for i, index := range indexList {
-			if i == len(indexList)-1 {
-				break
-			}
-			if i == 0 {
-				source = m.mapValue[index].([]interface{})
-				target = targetBitMap.mapValue[index].([]interface{})
-				final = finalMDBitMap.mapValue[index].([]interface{})
-			} else {
-				source = source[index].([]interface{})
-				target = target[index].([]interface{})
-				final = final[index].([]interface{})
-			}
-		}
-		final[indexList[len(indexList)-1]] = source[indexList[len(indexList)-1]].(bool) && target[indexList[len(indexList)-1]].(bool)
+	finalMDBitMap := m.newEmptyMDBitMap()
+	for i, word := range m.wordList {
+		finalMDBitMap.wordList[i] = word & targetBitMap.wordList[i]
 	}
-	return &finalMDBitMap, nil
+	return finalMDBitMap, nil
 }
 
 // 	NotMDBitMap 取反运算， 将当前位图做取反运算并返回新的 bitMap
 func (m *MDBitMap) NotMDBitMap() *MDBitMap {
-	finalMDBitMap := MDBitMap{}
-	finalMDBitMap.InitMDBitMap(m.lengthList, nil)
-	//获取所有下标 allIndexList 以进行逐个遍历运算
-	allIndexList := m.getAllIndexList()
-	for _, indexList := range allIndexList {
-		var source []interface{}
-		var final []interface{}
-		for i, index := range indexList {
-			if i == len(indexList)-1 {
-				break
-			}
-			if i == 0 {
-				source = m.mapValue[index].([]interface{})
-				final = finalMDBitMap.mapValue[index].([]interface{})
-			} else {
-				source = source[index].([]interface{})
-				final = final[index].([]interface{})
-			}
-		}
-		final[indexList[len(indexList)-1]] = !source[indexList[len(indexList)-1]].(bool)
+	finalMDBitMap := m.newEmptyMDBitMap()
+	for i, word := range m.wordList {
+		finalMDBitMap.wordList[i] = ^word
 	}
-	return &finalMDBitMap
+	finalMDBitMap.clearPadding()
+	return finalMDBitMap
 }
 
-// EqualMDBitMap 判断与另一个 MDBitMap 是否相等
+//结构及 schema 与当前位图相同、取值全为 false 的新位图，lengthList / strideList 只读，共用
+func (m *MDBitMap) newEmptyMDBitMap() *MDBitMap {
+	return &MDBitMap{
+		lengthList: m.lengthList,
+		strideList: m.strideList,
+		wordList:   make([]uint64, len(m.wordList)),
+		schema:     m.schema,
+	}
+}
+
+//元素总个数，零值位图为 0
+func (m *MDBitMap) getCellCount() int64 {
+	return getCellNum(m.lengthList)
+}
+
+//各维度长度的乘积，维度为空时为 0；调用方需保证不溢出
+func getCellNum(lengthList []int64) int64 {
+	if len(lengthList) == 0 {
+		return 0
+	}
+	cellNum := int64(1)
+	for _, length := range lengthList {
+		cellNum *= length
+	}
+	return cellNum
+}
+
+//末尾补位清零，零值位图没有位数组，不做处理
+func (m *MDBitMap) clearPadding() {
+	if tail := uint64(m.getCellCount()) & 63; tail != 0 && len(m.wordList) > 0 {
+		m.wordList[len(m.wordList)-1] &= 1<<tail - 1
+	}
+}
+
+// EqualMDBitMap 判断与另一个 MDBitMap 是否相等，只比较结构及取值，不比较 schema
 func (m *MDBitMap) EqualMDBitMap(targetBitMap *MDBitMap) bool {
-	return reflect.DeepEqual(m, targetBitMap)
+	return reflect.DeepEqual(m.lengthList, targetBitMap.lengthList) && reflect.DeepEqual(m.wordList, targetBitMap.wordList)
 }
 
 //	ContainsMDBitMap 判断是否包含另一个 MDBitMap
-//	若 A&B = B ，说明 A 包含 B
+//	若 A&B = B ，说明 A 包含 B，即 B 中为 true 的元素在 A 中均为 true
 func (m *MDBitMap) ContainsMDBitMap(targetBitMap *MDBitMap) (bool, error) {
-	temp, err := m.AndMDBitMap(targetBitMap)
-	if err != nil {
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
 		return false, err
 	}
-	return targetBitMap.EqualMDBitMap(temp), nil
+	for i, word := range targetBitMap.wordList {
+		if word&^m.wordList[i] != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 //构建初始化下标数组
@@ -251,6 +269,7 @@ A2  0  1  1  0
 A3  0  1  1  0
 则该方法输出为 设置为true的下标数组列表
 示例： [[1,0], [1,1], [1,2], [1,3]]
+下标个数为其余维度长度的乘积，维度较多时请使用 SetBox 直接填充，如 SetBox([[1], nil])
 */
 func getBitMapIndexList(function string, dataScopeList []interface{}, functionValueIndexMap map[string]map[interface{}]int64, rangeFunctionValueIndexMap map[string]map[interface{}]int64, functionIndexMap map[string]int64) [][]int64 {
 	finalBitMapIndexList := make([][]int64, 0)
@@ -557,20 +576,3 @@ func getBitMapLengthList(functionValueIndexMap map[string]map[interface{}]int64,
 	}
 	return lengthList
 }
-
-func deepCopy(value interface{}) interface{} {
-	if valueMap, ok := value.(map[string]interface{}); ok {
-		newMap := make(map[string]interface{})
-		for k, v := range valueMap {
-			newMap[k] = deepCopy(v)
-		}
-		return newMap
-	} else if valueSlice, ok := value.([]interface{}); ok {
-		newSlice := make([]interface{}, len(valueSlice))
-		for k, v := range valueSlice {
-			newSlice[k] = deepCopy(v)
-		}
-		return newSlice
-	}
-	return value
-}
@@ -0,0 +1,187 @@
+package my_utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+//基准测试使用的 4~6 维位图结构，元素个数分别为 64K、512K、1M
+var benchmarkLengthListList = [][]int64{
+	{16, 16, 16, 16},
+	{8, 16, 16, 16, 16},
+	{4, 8, 8, 16, 16, 16},
+}
+
+//随机位图，约一半元素为 true
+func newRandomMDBitMap(tb testing.TB, r *rand.Rand, lengthList []int64) *MDBitMap {
+	tb.Helper()
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap(lengthList, nil); err != nil {
+		tb.Fatal(err)
+	}
+	for i := range bitMap.wordList {
+		bitMap.wordList[i] = r.Uint64()
+	}
+	bitMap.clearPadding()
+	return bitMap
+}
+
+func getBenchmarkName(lengthList []int64) string {
+	return fmt.Sprintf("%dd_%d", len(lengthList), getSaturatedCellNum(lengthList))
+}
+
+func TestInitMDBitMapCellNumTooLarge(t *testing.T) {
+	caseList := []struct {
+		lengthList []int64
+		cellNum    int64
+	}{
+		//乘积恰好溢出为 0
+		{[]int64{1 << 32, 1 << 32}, math.MaxInt64},
+		{[]int64{3, 1 << 62}, math.MaxInt64},
+		{[]int64{1 << 62}, 1 << 62},
+		{[]int64{1 << 25, 1 << 26}, 1 << 51},
+	}
+	for _, testCase := range caseList {
+		bitMap := &MDBitMap{}
+		err := bitMap.InitMDBitMap(testCase.lengthList, nil)
+		var cellNumError *CellNumError
+		if !errors.Is(err, ErrCellNumTooLarge) || !errors.As(err, &cellNumError) || cellNumError.CellNum != testCase.cellNum {
+			t.Errorf("InitMDBitMap(%v) error %v, want cell count %d", testCase.lengthList, err, testCase.cellNum)
+		}
+		if _, err := InitConstMDExpr(testCase.lengthList, true); !errors.Is(err, ErrCellNumTooLarge) {
+			t.Errorf("InitConstMDExpr(%v) error %v", testCase.lengthList, err)
+		}
+	}
+}
+
+//零值位图视为没有元素的位图，运算不能 panic
+func TestZeroValueMDBitMap(t *testing.T) {
+	bitMap := &MDBitMap{}
+	if count := bitMap.NotMDBitMap().CountMDBitMap(); count != 0 {
+		t.Fatalf("NotMDBitMap().CountMDBitMap() = %d", count)
+	}
+	if _, err := bitMap.CheckMDBitMap(nil); !errors.Is(err, ErrLengthListEmpty) {
+		t.Fatalf("CheckMDBitMap(nil) error %v", err)
+	}
+	expr, err := InitMDExpr(bitMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := expr.Not().Materialize(); result.CountMDBitMap() != 0 || len(result.wordList) != 0 {
+		t.Fatalf("Materialize() = %v", result.wordList)
+	}
+}
+
+func TestMDBitMapWordOperation(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lengthList := []int64{3, 5, 7}
+	bitMap, targetBitMap := newRandomMDBitMap(t, r, lengthList), newRandomMDBitMap(t, r, lengthList)
+	orBitMap, err := bitMap.OrMDBitMap(targetBitMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	andBitMap, err := bitMap.AndMDBitMap(targetBitMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBitMap := bitMap.NotMDBitMap()
+	count := int64(0)
+	for offset := int64(0); offset < bitMap.getCellCount(); offset++ {
+		value, targetValue := bitMap.getBit(offset), targetBitMap.getBit(offset)
+		if orBitMap.getBit(offset) != (value || targetValue) || andBitMap.getBit(offset) != (value && targetValue) ||
+			notBitMap.getBit(offset) == value {
+			t.Fatalf("offset %d: or %v and %v not %v", offset, orBitMap.getBit(offset), andBitMap.getBit(offset), notBitMap.getBit(offset))
+		}
+		if value {
+			count++
+		}
+	}
+	if bitMap.CountMDBitMap() != count || notBitMap.CountMDBitMap() != bitMap.getCellCount()-count {
+		t.Fatalf("count %d, not count %d, want %d", bitMap.CountMDBitMap(), notBitMap.CountMDBitMap(), count)
+	}
+	if contains, err := orBitMap.ContainsMDBitMap(andBitMap); err != nil || !contains || !bitMap.CopyMDBitMap().EqualMDBitMap(bitMap) {
+		t.Fatal("contains / copy mismatch")
+	}
+}
+
+func BenchmarkOrMDBitMap(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range benchmarkLengthListList {
+		bitMap, targetBitMap := newRandomMDBitMap(b, r, lengthList), newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bitMap.OrMDBitMap(targetBitMap); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNotMDBitMap(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range benchmarkLengthListList {
+		bitMap := newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bitMap.NotMDBitMap()
+			}
+		})
+	}
+}
+
+func BenchmarkCountMDBitMap(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range benchmarkLengthListList {
+		bitMap := newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bitMap.CountMDBitMap()
+			}
+		})
+	}
+}
+
+func BenchmarkCheckMDBitMap(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range benchmarkLengthListList {
+		bitMap := newRandomMDBitMap(b, r, lengthList)
+		indexList := make([]int64, len(lengthList))
+		for i, length := range lengthList {
+			indexList[i] = length - 1
+		}
+		b.Run(getBenchmarkName(lengthList), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bitMap.CheckMDBitMap(indexList); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMDIndexCursor(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range benchmarkLengthListList {
+		bitMap := newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				count := 0
+				cursor := bitMap.Cursor()
+				for cursor.Next() {
+					if bitMap.getBit(cursor.Offset()) {
+						count++
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package my_utils
+
+import "encoding/binary"
+
+// MDD 多值决策图（reduced ordered MDD），MDBitMap 的另一种表示，适用于维度多、取值多但规则结构简单的策略
+/**
+ * @Description 稠密位图的内存为各维度长度的乘积，如 8 个维度、每个维度 100 个取值时无法存储；
+ * MDD 按维度顺序逐层判断，第 i 层节点按第 i 个维度的槽位选择子节点，到达 true / false 终结节点：
+ *   有序：子节点的维度一定在父节点之后
+ *   约简：所有子节点相同的节点省略，即跳过的维度不做限制；相同维度、相同子节点的节点只保存一份
+ * 相同结构的 MDD 表示唯一，节点个数取决于策略的结构而不是元素个数，如一条规则只需要每个受限维度一个节点
+ * 与 MDBitMap 使用相同的维度、槽位及 schema，可通过 ToMDD / ToMDBitMap 互相转换，按策略规模选择表示
+ * MDD 构建后不可修改，运算返回新的 MDD，可并发读取
+ * Count 使用 int64，元素总数超过 int64 范围时结果溢出
+ * @e.g.
+	lengthList: [3,4]，规则 {A in [A0, A2]}：
+	root(A): A0 → true, A1 → false, A2 → true
+	B 维度不做限制，不生成节点
+ **/
+type MDD struct {
+	lengthList []int64
+	schema     *MDSchema
+	// 下标 0、1 为 false、true 终结节点，子节点下标一定小于父节点下标
+	nodeList []mddNode
+	root     int32
+}
+
+type mddNode struct {
+	// 节点判断的维度，终结节点为维度个数
+	level     int
+	childList []int32
+}
+
+const (
+	mddFalse int32 = 0
+	mddTrue  int32 = 1
+)
+
+// InitMDD 构造方法，生成全为 value 的 MDD
+func InitMDD(lengthList []int64, value bool) (*MDD, error) {
+	if err := checkLengthList(lengthList); err != nil {
+		return nil, err
+	}
+	builder := newMDDBuilder(lengthList, nil)
+	builder.mdd.root = mddFalse
+	if value {
+		builder.mdd.root = mddTrue
+	}
+	return builder.mdd, nil
+}
+
+// CompileMDD 将规则列表编译为 MDD，规则格式与 CompileMDBitMap 一致，编译过程不生成稠密位图
+func CompileMDD(schema *MDSchema, ruleList []*MDRule) (*MDD, error) {
+	lengthList := schema.LengthList()
+	finalMDD := newMDDBuilder(lengthList, schema).mdd
+	for _, rule := range ruleList {
+		box, err := schema.getRuleBox(rule)
+		if err != nil {
+			return nil, err
+		}
+		if box == nil {
+			continue
+		}
+		//每条规则为一个盒子，逐条求或
+		boxBuilder := newMDDBuilder(lengthList, schema)
+		boxBuilder.mdd.root = boxBuilder.makeBox(box)
+		if finalMDD, err = finalMDD.applyMDD(mddOr, boxBuilder.mdd); err != nil {
+			return nil, err
+		}
+	}
+	return finalMDD, nil
+}
+
+// ToMDD 转换为 MDD，附加的 schema 与位图共用
+func (m *MDBitMap) ToMDD() *MDD {
+	builder := newMDDBuilder(m.lengthList, m.schema)
+	builder.mdd.root = builder.makeFromBitMap(m, 0, 0)
+	return builder.mdd
+}
+
+// ToMDBitMap 转换为稠密位图，元素个数过大时会申请大量内存，调用方需自行判断
+func (d *MDD) ToMDBitMap() (*MDBitMap, error) {
+	finalMDBitMap := MDBitMap{}
+	if err := finalMDBitMap.InitMDBitMap(d.LengthList(), nil); err != nil {
+		return nil, err
+	}
+	finalMDBitMap.schema = d.schema
+	d.fillBitMap(&finalMDBitMap, d.root, 0, 0)
+	return &finalMDBitMap, nil
+}
+
+// LengthList 返回 MDD 各维度长度
+func (d *MDD) LengthList() []int64 {
+	lengthList := make([]int64, len(d.lengthList))
+	copy(lengthList, d.lengthList)
+	return lengthList
+}
+
+// Schema 返回 MDD 附加的 schema，未附加时返回 nil
+func (d *MDD) Schema() *MDSchema {
+	return d.schema
+}
+
+// NodeNum 返回非终结节点个数，用于估算内存及选择表示
+func (d *MDD) NodeNum() int {
+	return len(d.nodeList) - 2
+}
+
+// And 与运算，结构不一致时返回 ErrInconsistentMap
+func (d *MDD) And(targetMDD *MDD) (*MDD, error) {
+	return d.applyMDD(mddAnd, targetMDD)
+}
+
+// Or 或运算，结构不一致时返回 ErrInconsistentMap
+func (d *MDD) Or(targetMDD *MDD) (*MDD, error) {
+	return d.applyMDD(mddOr, targetMDD)
+}
+
+// Not 取反
+func (d *MDD) Not() *MDD {
+	builder := newMDDBuilder(d.lengthList, d.schema)
+	builder.mdd.root = builder.not(d, d.root, make(map[int32]int32))
+	return builder.mdd
+}
+
+// Contains 判断是否包含另一个 MDD，即 targetMDD 中为 true 的元素在当前 MDD 中均为 true
+func (d *MDD) Contains(targetMDD *MDD) (bool, error) {
+	resultMDD, err := targetMDD.applyMDD(mddAndNot, d)
+	if err != nil {
+		return false, err
+	}
+	return resultMDD.root == mddFalse, nil
+}
+
+// Count 统计取值为 true 的元素个数
+func (d *MDD) Count() int64 {
+	suffixCountList := d.getSuffixCountList()
+	countList := make([]int64, len(d.nodeList))
+	countList[mddTrue] = 1
+	//子节点下标小于父节点，按下标顺序计算即可
+	for id := int32(2); id < int32(len(d.nodeList)); id++ {
+		node := d.nodeList[id]
+		for _, child := range node.childList {
+			childLevel := d.nodeList[child].level
+			countList[id] += countList[child] * (suffixCountList[node.level+1] / suffixCountList[childLevel])
+		}
+	}
+	return countList[d.root] * (suffixCountList[0] / suffixCountList[d.nodeList[d.root].level])
+}
+
+// Check 判断下标 indexList 对应元素是否为 true
+func (d *MDD) Check(indexList []int64) (bool, error) {
+	if err := checkIndexList(d.lengthList, indexList); err != nil {
+		return false, err
+	}
+	id := d.root
+	for id > mddTrue {
+		node := d.nodeList[id]
+		id = node.childList[indexList[node.level]]
+	}
+	return id == mddTrue, nil
+}
+
+//按维度顺序，suffixCountList[i] 为第 i 个维度及之后维度的元素个数
+func (d *MDD) getSuffixCountList() []int64 {
+	suffixCountList := make([]int64, len(d.lengthList)+1)
+	suffixCountList[len(d.lengthList)] = 1
+	for i := len(d.lengthList) - 1; i >= 0; i-- {
+		suffixCountList[i] = suffixCountList[i+1] * d.lengthList[i]
+	}
+	return suffixCountList
+}
+
+//将节点 id 覆盖的元素写入位图，level 为当前维度，offset 为当前前缀的平铺偏移量
+func (d *MDD) fillBitMap(bitMap *MDBitMap, id int32, level int, offset int64) {
+	if id == mddFalse {
+		return
+	}
+	if id == mddTrue {
+		//之后的维度均不做限制，为一段连续的位
+		blockLength := bitMap.getCellCount()
+		if level > 0 {
+			blockLength = bitMap.strideList[level-1]
+		}
+		bitMap.fillBitRange(offset, offset+blockLength, true)
+		return
+	}
+	node := d.nodeList[id]
+	for slot := int64(0); slot < d.lengthList[level]; slot++ {
+		child := id
+		if node.level == level {
+			child = node.childList[slot]
+		}
+		d.fillBitMap(bitMap, child, level+1, offset+slot*bitMap.strideList[level])
+	}
+}
+
+func (d *MDD) applyMDD(op mddOp, targetMDD *MDD) (*MDD, error) {
+	if err := checkSameLengthList(d.lengthList, targetMDD.lengthList); err != nil {
+		return nil, err
+	}
+	schema := d.schema
+	if schema == nil {
+		schema = targetMDD.schema
+	}
+	builder := newMDDBuilder(d.lengthList, schema)
+	builder.mdd.root = builder.apply(op, d, d.root, targetMDD, targetMDD.root, make(map[[2]int32]int32))
+	return builder.mdd, nil
+}
+
+type mddOp int
+
+const (
+	mddAnd mddOp = iota
+	mddOr
+	// left & !right
+	mddAndNot
+)
+
+//构建约简的 MDD，uniqueMap 保证相同维度、相同子节点的节点只保存一份
+type mddBuilder struct {
+	mdd       *MDD
+	uniqueMap map[string]int32
+}
+
+func newMDDBuilder(lengthList []int64, schema *MDSchema) *mddBuilder {
+	terminalNode := mddNode{level: len(lengthList)}
+	return &mddBuilder{
+		mdd: &MDD{
+			lengthList: lengthList,
+			schema:     schema,
+			nodeList:   []mddNode{terminalNode, terminalNode},
+		},
+		uniqueMap: make(map[string]int32),
+	}
+}
+
+//获取维度 level、子节点为 childList 的节点，所有子节点相同时直接返回子节点
+func (b *mddBuilder) makeNode(level int, childList []int32) int32 {
+	allSame := true
+	for _, child := range childList {
+		if child != childList[0] {
+			allSame = false
+			break
+		}
+	}
+	if allSame {
+		return childList[0]
+	}
+	keyData := make([]byte, 4*(len(childList)+1))
+	binary.LittleEndian.PutUint32(keyData, uint32(level))
+	for i, child := range childList {
+		binary.LittleEndian.PutUint32(keyData[4*(i+1):], uint32(child))
+	}
+	key := string(keyData)
+	if id, ok := b.uniqueMap[key]; ok {
+		return id
+	}
+	id := int32(len(b.mdd.nodeList))
+	b.mdd.nodeList = append(b.mdd.nodeList, mddNode{level: level, childList: childList})
+	b.uniqueMap[key] = id
+	return id
+}
+
+//盒子转换为节点，nil 维度不生成节点
+func (b *mddBuilder) makeBox(box [][]int64) int32 {
+	id := mddTrue
+	for level := len(box) - 1; level >= 0; level-- {
+		if box[level] == nil {
+			continue
+		}
+		childList := make([]int32, b.mdd.lengthList[level])
+		for _, slot := range box[level] {
+			childList[slot] = id
+		}
+		id = b.makeNode(level, childList)
+	}
+	return id
+}
+
+//位图中以 offset 为前缀偏移量、从维度 level 开始的子位图转换为节点
+func (b *mddBuilder) makeFromBitMap(bitMap *MDBitMap, level int, offset int64) int32 {
+	if level == len(bitMap.lengthList) {
+		if bitMap.getBit(offset) {
+			return mddTrue
+		}
+		return mddFalse
+	}
+	childList := make([]int32, bitMap.lengthList[level])
+	for slot := range childList {
+		childList[slot] = b.makeFromBitMap(bitMap, level+1, offset+int64(slot)*bitMap.strideList[level])
+	}
+	return b.makeNode(level, childList)
+}
+
+//对 left 中的节点 leftID、right 中的节点 rightID 做运算，结果节点写入当前 builder；memo 记录已计算的节点对
+func (b *mddBuilder) apply(op mddOp, left *MDD, leftID int32, right *MDD, rightID int32, memo map[[2]int32]int32) int32 {
+	switch op {
+	case mddAnd:
+		if leftID == mddFalse || rightID == mddFalse {
+			return mddFalse
+		}
+	case mddOr:
+		if leftID == mddTrue || rightID == mddTrue {
+			return mddTrue
+		}
+	case mddAndNot:
+		if leftID == mddFalse || rightID == mddTrue {
+			return mddFalse
+		}
+	}
+	if leftID <= mddTrue && rightID <= mddTrue {
+		leftValue, rightValue := leftID == mddTrue, rightID == mddTrue
+		value := false
+		switch op {
+		case mddAnd:
+			value = leftValue && rightValue
+		case mddOr:
+			value = leftValue || rightValue
+		case mddAndNot:
+			value = leftValue && !rightValue
+		}
+		if value {
+			return mddTrue
+		}
+		return mddFalse
+	}
+	key := [2]int32{leftID, rightID}
+	if id, ok := memo[key]; ok {
+		return id
+	}
+	leftNode, rightNode := left.nodeList[leftID], right.nodeList[rightID]
+	level := leftNode.level
+	if rightNode.level < level {
+		level = rightNode.level
+	}
+	childList := make([]int32, b.mdd.lengthList[level])
+	for slot := range childList {
+		leftChild, rightChild := leftID, rightID
+		if leftNode.level == level {
+			leftChild = leftNode.childList[slot]
+		}
+		if rightNode.level == level {
+			rightChild = rightNode.childList[slot]
+		}
+		childList[slot] = b.apply(op, left, leftChild, right, rightChild, memo)
+	}
+	id := b.makeNode(level, childList)
+	memo[key] = id
+	return id
+}
+
+func (b *mddBuilder) not(source *MDD, sourceID int32, memo map[int32]int32) int32 {
+	switch sourceID {
+	case mddFalse:
+		return mddTrue
+	case mddTrue:
+		return mddFalse
+	}
+	if id, ok := memo[sourceID]; ok {
+		return id
+	}
+	node := source.nodeList[sourceID]
+	childList := make([]int32, len(node.childList))
+	for slot, child := range node.childList {
+		childList[slot] = b.not(source, child, memo)
+	}
+	id := b.makeNode(node.level, childList)
+	memo[sourceID] = id
+	return id
+}
@@ -0,0 +1,155 @@
+package my_utils
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+//CompileMDD 与 CompileMDBitMap 结果一致，ToMDD / ToMDBitMap 互相转换不变
+func TestMDDRoundTrip(t *testing.T) {
+	schema := newTestSchema(t)
+	for _, ruleJSON := range []string{
+		`[]`,
+		`[{"condition_list":[]}]`,
+		`[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gte","value_list":[1000]}]}]`,
+		`[{"condition_list":[{"function":"country","value_list":["SG",null]}]},
+			{"condition_list":[{"function":"country","value_list":["<other>"]},{"function":"salary","operator":"lt","value_list":[5000]}]}]`,
+	} {
+		bitMap := compileTestRuleList(t, schema, ruleJSON)
+		mdd, err := CompileMDD(schema, getTestRuleList(t, ruleJSON))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mddBitMap, err := mdd.ToMDBitMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mddBitMap.EqualMDBitMap(bitMap) || mddBitMap.Schema() != schema {
+			t.Errorf("%s: compiled mdd mismatch", ruleJSON)
+		}
+		//相同结构的 MDD 表示唯一
+		if convertedMDD := bitMap.ToMDD(); convertedMDD.NodeNum() != mdd.NodeNum() || convertedMDD.Count() != mdd.Count() {
+			t.Errorf("%s: node count %d, want %d", ruleJSON, convertedMDD.NodeNum(), mdd.NodeNum())
+		}
+		if count := mdd.Count(); count != bitMap.CountMDBitMap() {
+			t.Errorf("%s: count %d, want %d", ruleJSON, count, bitMap.CountMDBitMap())
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, lengthList := range [][]int64{{7}, {3, 5}, {2, 3, 4}, {3, 1, 65}} {
+		bitMap := newRandomMDBitMap(t, r, lengthList)
+		mddBitMap, err := bitMap.ToMDD().ToMDBitMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mddBitMap.EqualMDBitMap(bitMap) {
+			t.Errorf("%v: round trip mismatch", lengthList)
+		}
+	}
+}
+
+//And / Or / Not / Contains / Count / Check 与 MDBitMap 一致
+func TestMDDOperation(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, lengthList := range [][]int64{{7}, {3, 5}, {2, 3, 4}} {
+		a, b := newRandomMDBitMap(t, r, lengthList), newRandomMDBitMap(t, r, lengthList)
+		mddA, mddB := a.ToMDD(), b.ToMDD()
+		andMDD, err := mddA.And(mddB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orMDD, err := mddA.Or(mddB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		andBitMap, _ := a.AndMDBitMap(b)
+		orBitMap, _ := a.OrMDBitMap(b)
+		for _, testCase := range []struct {
+			name   string
+			mdd    *MDD
+			bitMap *MDBitMap
+		}{
+			{"and", andMDD, andBitMap},
+			{"or", orMDD, orBitMap},
+			{"not", mddA.Not(), a.NotMDBitMap()},
+			{"not not", mddA.Not().Not(), a},
+		} {
+			bitMap, err := testCase.mdd.ToMDBitMap()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bitMap.EqualMDBitMap(testCase.bitMap) {
+				t.Errorf("%v %s: mismatch", lengthList, testCase.name)
+			}
+			if count := testCase.mdd.Count(); count != testCase.bitMap.CountMDBitMap() {
+				t.Errorf("%v %s: count %d, want %d", lengthList, testCase.name, count, testCase.bitMap.CountMDBitMap())
+			}
+			for cursor := testCase.bitMap.Cursor(); cursor.Next(); {
+				result, err := testCase.mdd.Check(cursor.IndexList())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result != testCase.bitMap.getBit(cursor.Offset()) {
+					t.Fatalf("%v %s: check %v %v", lengthList, testCase.name, cursor.IndexList(), result)
+				}
+			}
+		}
+		for _, testCase := range []struct {
+			mdd, targetMDD       *MDD
+			bitMap, targetBitMap *MDBitMap
+		}{
+			{orMDD, mddA, orBitMap, a},
+			{mddA, andMDD, a, andBitMap},
+			{mddA, mddB, a, b},
+			{andMDD, orMDD, andBitMap, orBitMap},
+		} {
+			contains, err := testCase.mdd.Contains(testCase.targetMDD)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := testCase.bitMap.ContainsMDBitMap(testCase.targetBitMap)
+			if contains != want {
+				t.Errorf("%v: contains %v, want %v", lengthList, contains, want)
+			}
+		}
+	}
+	mdd, err := InitMDD([]int64{3, 5}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdd.And(newRandomMDBitMap(t, r, []int64{5, 3}).ToMDD()); !errors.Is(err, ErrInconsistentMap) {
+		t.Errorf("and error %v", err)
+	}
+	if _, err := mdd.Check([]int64{3, 0}); !errors.Is(err, ErrMDBitMapIndexOutOfRange) {
+		t.Errorf("check error %v", err)
+	}
+}
+
+//节点个数取决于规则结构：每个受限维度一个节点，相同子图共用
+func TestMDDNodeNum(t *testing.T) {
+	schema := newTestSchema(t)
+	caseList := []struct {
+		ruleJSON string
+		nodeNum  int
+	}{
+		{`[]`, 0},
+		{`[{"condition_list":[]}]`, 0},
+		{`[{"condition_list":[{"function":"salary","operator":"gte","value_list":[1000]}]}]`, 1},
+		{`[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gte","value_list":[1000]}]}]`, 2},
+		//两条规则的 salary 条件相同，country 节点的子节点共用一个 salary 节点
+		{`[{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+			{"condition_list":[{"function":"country","value_list":["MY"]},{"function":"salary","operator":"gte","value_list":[1000]}]}]`, 2},
+		{`[{"condition_list":[{"function":"country","value_list":["SG"]},{"function":"salary","operator":"gte","value_list":[1000]}]},
+			{"condition_list":[{"function":"country","value_list":["MY"]},{"function":"salary","operator":"lt","value_list":[5000]}]}]`, 3},
+	}
+	for _, testCase := range caseList {
+		mdd, err := CompileMDD(schema, getTestRuleList(t, testCase.ruleJSON))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mdd.NodeNum() != testCase.nodeNum {
+			t.Errorf("%s: node count %d, want %d", testCase.ruleJSON, mdd.NodeNum(), testCase.nodeNum)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package my_utils
+
+import (
+	"context"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultParallelChunkWordNum 并行运算中每个分片默认包含的 uint64 个数（64 万个元素）
+const DefaultParallelChunkWordNum = 10000
+
+// ParallelOption 并行运算选项
+type ParallelOption struct {
+	// 最大并发 goroutine 数，<=0 时为 runtime.GOMAXPROCS(0)
+	WorkerNum int
+	// 每个分片包含的 uint64 个数，<=0 时为 DefaultParallelChunkWordNum；分片过小时调度开销大于收益
+	ChunkWordNum int
+}
+
+// OrMDBitMapParallel 并行或运算，结果与 OrMDBitMap 一致
+/**
+ * @Description 按平铺位数组切分为若干分片，由最多 WorkerNum 个 goroutine 依次领取分片计算；
+ * 每个分片计算前检查 ctx，ctx 取消或超时时尽快返回 ctx.Err()，已计算的部分结果丢弃；
+ * 全部分片已计算完时 ctx 才被取消，仍返回完整结果
+ * 位图只有一个分片时直接在当前 goroutine 中计算；option 为 nil 时使用默认选项
+ **/
+func (m *MDBitMap) OrMDBitMapParallel(ctx context.Context, targetBitMap *MDBitMap, option *ParallelOption) (*MDBitMap, error) {
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
+		return nil, err
+	}
+	finalMDBitMap := m.newEmptyMDBitMap()
+	err := runParallel(ctx, len(m.wordList), option, func(start int, end int) {
+		for i := start; i < end; i++ {
+			finalMDBitMap.wordList[i] = m.wordList[i] | targetBitMap.wordList[i]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return finalMDBitMap, nil
+}
+
+// AndMDBitMapParallel 并行与运算，结果与 AndMDBitMap 一致，分片及取消方式见 OrMDBitMapParallel
+func (m *MDBitMap) AndMDBitMapParallel(ctx context.Context, targetBitMap *MDBitMap, option *ParallelOption) (*MDBitMap, error) {
+	if err := checkSameLengthList(m.lengthList, targetBitMap.lengthList); err != nil {
+		return nil, err
+	}
+	finalMDBitMap := m.newEmptyMDBitMap()
+	err := runParallel(ctx, len(m.wordList), option, func(start int, end int) {
+		for i := start; i < end; i++ {
+			finalMDBitMap.wordList[i] = m.wordList[i] & targetBitMap.wordList[i]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return finalMDBitMap, nil
+}
+
+// NotMDBitMapParallel 并行取反运算，结果与 NotMDBitMap 一致，分片及取消方式见 OrMDBitMapParallel
+func (m *MDBitMap) NotMDBitMapParallel(ctx context.Context, option *ParallelOption) (*MDBitMap, error) {
+	finalMDBitMap := m.newEmptyMDBitMap()
+	err := runParallel(ctx, len(m.wordList), option, func(start int, end int) {
+		for i := start; i < end; i++ {
+			finalMDBitMap.wordList[i] = ^m.wordList[i]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	finalMDBitMap.clearPadding()
+	return finalMDBitMap, nil
+}
+
+// CountMDBitMapParallel 并行统计取值为 true 的元素个数，结果与 CountMDBitMap 一致，分片及取消方式见 OrMDBitMapParallel
+func (m *MDBitMap) CountMDBitMapParallel(ctx context.Context, option *ParallelOption) (int64, error) {
+	count := int64(0)
+	err := runParallel(ctx, len(m.wordList), option, func(start int, end int) {
+		chunkCount := 0
+		for _, word := range m.wordList[start:end] {
+			chunkCount += bits.OnesCount64(word)
+		}
+		atomic.AddInt64(&count, int64(chunkCount))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+//将 [0, wordNum) 切分为分片并行执行 fn，各分片互不重叠；ctx 取消时不再领取新分片，有分片未执行时返回 ctx.Err()
+func runParallel(ctx context.Context, wordNum int, option *ParallelOption, fn func(start int, end int)) error {
+	if option == nil {
+		option = &ParallelOption{}
+	}
+	workerNum, chunkWordNum := option.WorkerNum, option.ChunkWordNum
+	if workerNum <= 0 {
+		workerNum = runtime.GOMAXPROCS(0)
+	}
+	if chunkWordNum <= 0 {
+		chunkWordNum = DefaultParallelChunkWordNum
+	}
+	chunkNum := (wordNum + chunkWordNum - 1) / chunkWordNum
+	if workerNum > chunkNum {
+		workerNum = chunkNum
+	}
+	//下一个待领取的分片及已执行完的分片个数
+	nextChunk, doneChunkNum := int64(0), int64(0)
+	work := func() {
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			chunk := int(atomic.AddInt64(&nextChunk, 1) - 1)
+			if chunk >= chunkNum {
+				return
+			}
+			start := chunk * chunkWordNum
+			end := start + chunkWordNum
+			if end > wordNum {
+				end = wordNum
+			}
+			fn(start, end)
+			atomic.AddInt64(&doneChunkNum, 1)
+		}
+	}
+	//全部分片执行完时，即使 ctx 随后被取消，结果也是完整的
+	getErr := func() error {
+		if int(atomic.LoadInt64(&doneChunkNum)) == chunkNum {
+			return nil
+		}
+		return ctx.Err()
+	}
+	if workerNum <= 1 {
+		work()
+		return getErr()
+	}
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(workerNum)
+	for i := 0; i < workerNum; i++ {
+		go func() {
+			defer waitGroup.Done()
+			work()
+		}()
+	}
+	waitGroup.Wait()
+	return getErr()
+}
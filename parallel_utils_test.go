@@ -0,0 +1,121 @@
+package my_utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+//多百万元素的基准测试位图结构，元素个数分别为 16M、64M
+var parallelBenchmarkLengthListList = [][]int64{
+	{4000, 4000},
+	{1000, 1000, 64},
+}
+
+func TestMDBitMapParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lengthList := []int64{100, 200, 301}
+	bitMap, targetBitMap := newRandomMDBitMap(t, r, lengthList), newRandomMDBitMap(t, r, lengthList)
+	ctx := context.Background()
+	for _, option := range []*ParallelOption{nil, {WorkerNum: 1}, {WorkerNum: 4, ChunkWordNum: 37}, {WorkerNum: 64, ChunkWordNum: 1}} {
+		orBitMap, err := bitMap.OrMDBitMapParallel(ctx, targetBitMap, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		andBitMap, err := bitMap.AndMDBitMapParallel(ctx, targetBitMap, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notBitMap, err := bitMap.NotMDBitMapParallel(ctx, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := bitMap.CountMDBitMapParallel(ctx, option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectOrBitMap, _ := bitMap.OrMDBitMap(targetBitMap)
+		expectAndBitMap, _ := bitMap.AndMDBitMap(targetBitMap)
+		if !orBitMap.EqualMDBitMap(expectOrBitMap) || !andBitMap.EqualMDBitMap(expectAndBitMap) ||
+			!notBitMap.EqualMDBitMap(bitMap.NotMDBitMap()) || count != bitMap.CountMDBitMap() {
+			t.Fatalf("option %+v result mismatch", option)
+		}
+	}
+}
+
+func TestMDBitMapParallelCancel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bitMap := newRandomMDBitMap(t, r, []int64{64, 64, 64})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := bitMap.NotMDBitMapParallel(ctx, &ParallelOption{WorkerNum: 4, ChunkWordNum: 8}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled before start error %v", err)
+	}
+	//最后一个分片执行时取消，全部分片已完成，不返回错误
+	for _, workerNum := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		doneNum := int64(0)
+		err := runParallel(ctx, 100, &ParallelOption{WorkerNum: workerNum, ChunkWordNum: 100}, func(start int, end int) {
+			doneNum += int64(end - start)
+			cancel()
+		})
+		if err != nil || doneNum != 100 {
+			t.Fatalf("worker %d: err %v, done %d", workerNum, err, doneNum)
+		}
+	}
+	//执行中取消，剩余分片被跳过时返回错误
+	ctx, cancel = context.WithCancel(context.Background())
+	err := runParallel(ctx, 100, &ParallelOption{WorkerNum: 1, ChunkWordNum: 10}, func(start int, end int) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled while running error %v", err)
+	}
+}
+
+func BenchmarkOrMDBitMapParallel(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+	for _, lengthList := range parallelBenchmarkLengthListList {
+		bitMap, targetBitMap := newRandomMDBitMap(b, r, lengthList), newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList)+"/serial", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bitMap.OrMDBitMap(targetBitMap); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(getBenchmarkName(lengthList)+"/parallel", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bitMap.OrMDBitMapParallel(ctx, targetBitMap, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCountMDBitMapParallel(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+	for _, lengthList := range parallelBenchmarkLengthListList {
+		bitMap := newRandomMDBitMap(b, r, lengthList)
+		b.Run(getBenchmarkName(lengthList)+"/serial", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bitMap.CountMDBitMap()
+			}
+		})
+		b.Run(getBenchmarkName(lengthList)+"/parallel", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bitMap.CountMDBitMapParallel(ctx, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package my_utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidRenderOption 输出配置不合法
+var ErrInvalidRenderOption = errors.New("invalid render option")
+
+// RenderFormat 位图输出格式
+type RenderFormat int
+
+const (
+	// RenderFormatText 按列对齐的纯文本，与代码注释中的位图示意一致
+	RenderFormatText RenderFormat = iota
+	// RenderFormatMarkdown Markdown 表格
+	RenderFormatMarkdown
+	// RenderFormatCSV 单张 CSV 表，其余维度作为前置列
+	RenderFormatCSV
+)
+
+// RenderOption 位图输出配置
+type RenderOption struct {
+	// 作为行、列的维度，默认分别为倒数第二个、最后一个维度；一维位图只有列
+	Row    string
+	Column string
+	Format RenderFormat
+	// 行、列为范围维度时，将取值完全相同的相邻槽位合并为一个区间；CSV 格式只合并行
+	CollapseRange bool
+	// 元素取值的标签，默认为 1 / 0
+	TrueLabel  string
+	FalseLabel string
+}
+
+// renderSlice 一张二维切片：其余维度取固定槽位时，行维度 × 列维度的取值
+type renderSlice struct {
+	// 其余维度的 维度=标签
+	titleList []string
+	// 其余维度的标签，CSV 前置列使用
+	otherLabelList  []string
+	rowLabelList    []string
+	columnLabelList []string
+	cellList        [][]bool
+}
+
+// Render 将位图按二维切片输出，其余维度的每种取值组合输出一张表
+/**
+ * @Description 行、列及切片标题使用 schema 中的取值标签，范围维度为区间，如 (-inf,5000)、[5000,5000]；
+ * schema 为 nil 时使用位图附加的 schema，仍为 nil 时维度名称为 d0、d1 ...，标签为槽位下标
+ * @e.g.
+	country 取值 [SG, MY]，level 取值 [L1, L2]，salary 边界值 [5000]，Row: country，Column: salary，CollapseRange: true
+	level=L1
+	country/salary  (-inf,5000]  (5000,+inf)
+	SG              0            1
+	MY              0            1
+	...
+ **/
+func (m *MDBitMap) Render(writer io.Writer, schema *MDSchema, option *RenderOption) error {
+	if option == nil {
+		option = &RenderOption{}
+	}
+	if schema == nil {
+		schema = m.schema
+	}
+	if schema != nil {
+		if err := schema.checkMDBitMap(m); err != nil {
+			return err
+		}
+	}
+	r := &bitMapRenderer{bitMap: m, schema: schema, option: option}
+	if err := r.init(); err != nil {
+		return err
+	}
+	sliceList := r.getSliceList()
+	switch option.Format {
+	case RenderFormatText:
+		return r.writeText(writer, sliceList, false)
+	case RenderFormatMarkdown:
+		return r.writeText(writer, sliceList, true)
+	case RenderFormatCSV:
+		return r.writeCSV(writer, sliceList)
+	default:
+		return fmt.Errorf("%w: unknown format %d", ErrInvalidRenderOption, option.Format)
+	}
+}
+
+// RenderString 将位图按二维切片输出为字符串，见 Render
+func (m *MDBitMap) RenderString(schema *MDSchema, option *RenderOption) (string, error) {
+	var builder strings.Builder
+	if err := m.Render(&builder, schema, option); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+type bitMapRenderer struct {
+	bitMap *MDBitMap
+	schema *MDSchema
+	option *RenderOption
+	// 行维度下标，一维位图为 -1
+	rowIndex       int
+	columnIndex    int
+	otherIndexList []int
+}
+
+//确定行、列维度
+func (r *bitMapRenderer) init() error {
+	dimensionNum := len(r.bitMap.lengthList)
+	r.columnIndex, r.rowIndex = dimensionNum-1, dimensionNum-2
+	if r.option.Column != "" {
+		index, err := r.getFunctionIndex(r.option.Column)
+		if err != nil {
+			return err
+		}
+		r.columnIndex = index
+	}
+	if r.option.Row != "" {
+		index, err := r.getFunctionIndex(r.option.Row)
+		if err != nil {
+			return err
+		}
+		r.rowIndex = index
+	} else if r.rowIndex == r.columnIndex {
+		//列为倒数第二个维度时，行取最后一个维度
+		r.rowIndex = dimensionNum - 1
+	}
+	if r.rowIndex == r.columnIndex {
+		return fmt.Errorf("%w: row and column are the same function %s", ErrInvalidRenderOption, r.getFunction(r.rowIndex))
+	}
+	for i := 0; i < dimensionNum; i++ {
+		if i != r.rowIndex && i != r.columnIndex {
+			r.otherIndexList = append(r.otherIndexList, i)
+		}
+	}
+	return nil
+}
+
+func (r *bitMapRenderer) getFunctionIndex(function string) (int, error) {
+	if r.schema != nil {
+		if index, ok := r.schema.functionIndexMap[function]; ok {
+			return int(index), nil
+		}
+	} else if strings.HasPrefix(function, "d") {
+		index, err := strconv.Atoi(function[1:])
+		if err == nil && index >= 0 && index < len(r.bitMap.lengthList) {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrFunctionNotFound, function)
+}
+
+func (r *bitMapRenderer) getFunction(index int) string {
+	if r.schema != nil {
+		return r.schema.functionList[index]
+	}
+	return "d" + strconv.Itoa(index)
+}
+
+//连续槽位 [startSlot, endSlot] 的标签，离散维度只会有单个槽位
+func (r *bitMapRenderer) getLabel(index int, startSlot int64, endSlot int64) string {
+	if r.schema == nil {
+		return strconv.FormatInt(startSlot, 10)
+	}
+	function := r.schema.functionList[index]
+	if !r.schema.IsRangeFunction(function) {
+		return fmt.Sprint(r.schema.valueListMap[function][startSlot])
+	}
+	//与 getSlotLabel 及 json 格式一致，单点区间为 [5000,5000]
+	return r.schema.getSlotRangeInterval(function, startSlot, endSlot).String()
+}
+
+//是否合并该维度相邻的相同槽位
+func (r *bitMapRenderer) isCollapsible(index int) bool {
+	return index >= 0 && r.option.CollapseRange && r.schema != nil && r.schema.IsRangeFunction(r.schema.functionList[index])
+}
+
+//生成所有二维切片，按其余维度的下标顺序排列
+func (r *bitMapRenderer) getSliceList() []*renderSlice {
+	lengthList := r.bitMap.lengthList
+	sliceList := make([]*renderSlice, 0)
+	indexList := make([]int64, len(lengthList))
+	var walk func(depth int)
+	walk = func(depth int) {
+		if depth < len(r.otherIndexList) {
+			for slot := int64(0); slot < lengthList[r.otherIndexList[depth]]; slot++ {
+				indexList[r.otherIndexList[depth]] = slot
+				walk(depth + 1)
+			}
+			return
+		}
+		sliceList = append(sliceList, r.getSlice(indexList))
+	}
+	walk(0)
+	return sliceList
+}
+
+//生成其余维度取 indexList 中槽位时的切片，并按配置合并行、列
+func (r *bitMapRenderer) getSlice(indexList []int64) *renderSlice {
+	lengthList := r.bitMap.lengthList
+	slice := &renderSlice{}
+	for _, index := range r.otherIndexList {
+		label := r.getLabel(index, indexList[index], indexList[index])
+		slice.titleList = append(slice.titleList, r.getFunction(index)+"="+label)
+		slice.otherLabelList = append(slice.otherLabelList, label)
+	}
+	rowLength := int64(1)
+	if r.rowIndex >= 0 {
+		rowLength = lengthList[r.rowIndex]
+	}
+	rowList := make([][]bool, rowLength)
+	for rowSlot := range rowList {
+		if r.rowIndex >= 0 {
+			indexList[r.rowIndex] = int64(rowSlot)
+		}
+		rowList[rowSlot] = make([]bool, lengthList[r.columnIndex])
+		for columnSlot := range rowList[rowSlot] {
+			indexList[r.columnIndex] = int64(columnSlot)
+			rowList[rowSlot][columnSlot] = r.bitMap.getValue(indexList)
+		}
+	}
+	//合并行：相邻两行完全相同时合并
+	rowGroupList := getRenderGroupList(len(rowList), r.isCollapsible(r.rowIndex), func(i int, j int) bool {
+		return equalBoolList(rowList[i], rowList[j])
+	})
+	//合并列：相邻两列在所有行中都相同时合并，CSV 各切片共用表头，不合并列
+	collapseColumn := r.isCollapsible(r.columnIndex) && r.option.Format != RenderFormatCSV
+	columnGroupList := getRenderGroupList(int(lengthList[r.columnIndex]), collapseColumn, func(i int, j int) bool {
+		for _, row := range rowList {
+			if row[i] != row[j] {
+				return false
+			}
+		}
+		return true
+	})
+	for _, columnGroup := range columnGroupList {
+		slice.columnLabelList = append(slice.columnLabelList, r.getLabel(r.columnIndex, int64(columnGroup[0]), int64(columnGroup[1])))
+	}
+	for _, rowGroup := range rowGroupList {
+		if r.rowIndex >= 0 {
+			slice.rowLabelList = append(slice.rowLabelList, r.getLabel(r.rowIndex, int64(rowGroup[0]), int64(rowGroup[1])))
+		}
+		row := make([]bool, 0, len(columnGroupList))
+		for _, columnGroup := range columnGroupList {
+			row = append(row, rowList[rowGroup[0]][columnGroup[0]])
+		}
+		slice.cellList = append(slice.cellList, row)
+	}
+	return slice
+}
+
+//将 [0, length) 分组为连续区间 [start, end]，collapse 为 true 时相邻且 equal 的槽位合并为一组
+func getRenderGroupList(length int, collapse bool, equal func(i int, j int) bool) [][2]int {
+	groupList := make([][2]int, 0, length)
+	for i := 0; i < length; i++ {
+		if collapse && len(groupList) > 0 && equal(groupList[len(groupList)-1][1], i) {
+			groupList[len(groupList)-1][1] = i
+			continue
+		}
+		groupList = append(groupList, [2]int{i, i})
+	}
+	return groupList
+}
+
+func equalBoolList(left []bool, right []bool) bool {
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *bitMapRenderer) getCellLabel(value bool) string {
+	if value {
+		if r.option.TrueLabel != "" {
+			return r.option.TrueLabel
+		}
+		return "1"
+	}
+	if r.option.FalseLabel != "" {
+		return r.option.FalseLabel
+	}
+	return "0"
+}
+
+//表头第一格，如 country/salary
+func (r *bitMapRenderer) getCornerLabel() string {
+	if r.rowIndex < 0 {
+		return r.getFunction(r.columnIndex)
+	}
+	return r.getFunction(r.rowIndex) + "/" + r.getFunction(r.columnIndex)
+}
+
+//输出纯文本或 Markdown，切片之间空一行
+func (r *bitMapRenderer) writeText(writer io.Writer, sliceList []*renderSlice, markdown bool) error {
+	for i, slice := range sliceList {
+		if i > 0 {
+			if _, err := fmt.Fprintln(writer); err != nil {
+				return err
+			}
+		}
+		tableList := make([][]string, 0, len(slice.cellList)+1)
+		tableList = append(tableList, append([]string{r.getCornerLabel()}, slice.columnLabelList...))
+		for j, row := range slice.cellList {
+			line := []string{""}
+			if r.rowIndex >= 0 {
+				line[0] = slice.rowLabelList[j]
+			}
+			for _, value := range row {
+				line = append(line, r.getCellLabel(value))
+			}
+			tableList = append(tableList, line)
+		}
+		var err error
+		if markdown {
+			err = writeMarkdownTable(writer, strings.Join(slice.titleList, ", "), tableList)
+		} else {
+			err = writeAlignedTable(writer, strings.Join(slice.titleList, ", "), tableList)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//按列对齐输出表格，列宽按终端显示宽度计算，列之间两个空格
+func writeAlignedTable(writer io.Writer, title string, tableList [][]string) error {
+	var builder strings.Builder
+	if title != "" {
+		builder.WriteString(title + "\n")
+	}
+	widthList := getColumnWidthList(tableList)
+	for _, line := range tableList {
+		for i, cell := range line {
+			builder.WriteString(cell)
+			if i < len(line)-1 {
+				builder.WriteString(strings.Repeat(" ", widthList[i]-getDisplayWidth(cell)+2))
+			}
+		}
+		builder.WriteString("\n")
+	}
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+//输出 Markdown 表格，标题加粗，单元格中的 | 转义
+func writeMarkdownTable(writer io.Writer, title string, tableList [][]string) error {
+	var builder strings.Builder
+	if title != "" {
+		builder.WriteString("**" + title + "**\n\n")
+	}
+	for i, line := range tableList {
+		escapeLine := make([]string, 0, len(line))
+		for _, cell := range line {
+			escapeLine = append(escapeLine, strings.ReplaceAll(cell, "|", "\\|"))
+		}
+		builder.WriteString("| " + strings.Join(escapeLine, " | ") + " |\n")
+		if i == 0 {
+			builder.WriteString("|" + strings.Repeat(" --- |", len(line)) + "\n")
+		}
+	}
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+func getColumnWidthList(tableList [][]string) []int {
+	widthList := make([]int, len(tableList[0]))
+	for _, line := range tableList {
+		for i, cell := range line {
+			if width := getDisplayWidth(cell); width > widthList[i] {
+				widthList[i] = width
+			}
+		}
+	}
+	return widthList
+}
+
+//终端显示宽度：中日韩文字及全角字符占 2 列，组合字符占 0 列，其余占 1 列
+func getDisplayWidth(text string) int {
+	width := 0
+	for _, char := range text {
+		switch {
+		case unicode.Is(unicode.Mn, char):
+		case isWideRune(char):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+func isWideRune(char rune) bool {
+	return (char >= 0x1100 && char <= 0x115F) || //谚文字母
+		(char >= 0x2E80 && char <= 0xA4CF && char != 0x303F) || //中日韩部首、标点、假名、汉字、彝文
+		(char >= 0xAC00 && char <= 0xD7A3) || //谚文音节
+		(char >= 0xF900 && char <= 0xFAFF) || //中日韩兼容汉字
+		(char >= 0xFE30 && char <= 0xFE4F) || //中日韩兼容形式
+		(char >= 0xFF00 && char <= 0xFF60) || //全角字符
+		(char >= 0xFFE0 && char <= 0xFFE6) ||
+		(char >= 0x20000 && char <= 0x3FFFD) //扩展汉字
+}
+
+//输出单张 CSV 表：其余维度、行维度、列维度各槽位，每个切片的每一行为一条记录
+func (r *bitMapRenderer) writeCSV(writer io.Writer, sliceList []*renderSlice) error {
+	csvWriter := csv.NewWriter(writer)
+	header := make([]string, 0)
+	for _, index := range r.otherIndexList {
+		header = append(header, r.getFunction(index))
+	}
+	header = append(header, r.getCornerLabel())
+	header = append(header, sliceList[0].columnLabelList...)
+	if err := csvWriter.Write(header); err != nil {
+		return err
+	}
+	for _, slice := range sliceList {
+		for i, row := range slice.cellList {
+			record := append([]string{}, slice.otherLabelList...)
+			if r.rowIndex >= 0 {
+				record = append(record, slice.rowLabelList[i])
+			} else {
+				record = append(record, "")
+			}
+			for _, value := range row {
+				record = append(record, r.getCellLabel(value))
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
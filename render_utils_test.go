@@ -0,0 +1,176 @@
+package my_utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//渲染的范围维度标签与 getSlotLabel 一致，单点区间为 [a,a]
+func TestRenderRangeLabel(t *testing.T) {
+	schema := newTestSchema(t)
+	bitMap := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"salary","value_list":[5000]}]}]`)
+	var buffer bytes.Buffer
+	if err := bitMap.Render(&buffer, nil, &RenderOption{Row: "country", Column: "salary"}); err != nil {
+		t.Fatal(err)
+	}
+	header := strings.SplitN(buffer.String(), "\n", 2)[0]
+	for slot := int64(0); slot < schema.LengthList()[1]; slot++ {
+		label := fmt.Sprint(schema.getSlotLabel("salary", slot))
+		if !strings.Contains(header, label) {
+			t.Errorf("header %q misses label %s", header, label)
+		}
+	}
+	if !strings.Contains(header, "[5000,5000]") {
+		t.Errorf("header %q misses point label [5000,5000]", header)
+	}
+}
+
+//level 取值 [L1, L2]，国家 取值 [新加坡, MY]，salary 边界值 [1000, 5000]
+func newTestRenderBitMap(t *testing.T) *MDBitMap {
+	t.Helper()
+	schema := &MDSchema{}
+	if err := json.Unmarshal([]byte(`{"function_list":[
+		{"function":"level","type":"discrete","value_list":["L1","L2"]},
+		{"function":"国家","type":"discrete","value_list":["新加坡","MY"]},
+		{"function":"salary","type":"range","boundary_list":[1000,5000]}]}`), schema); err != nil {
+		t.Fatal(err)
+	}
+	return compileTestRuleList(t, schema, `[
+		{"condition_list":[{"function":"level","value_list":["L1"]},{"function":"salary","operator":"gt","value_list":[1000]}]},
+		{"condition_list":[{"function":"国家","value_list":["MY"]}]}]`)
+}
+
+func TestRender(t *testing.T) {
+	bitMap := newTestRenderBitMap(t)
+	caseList := []struct {
+		option *RenderOption
+		result string
+	}{
+		//默认行、列为倒数第二个、最后一个维度，中文标签按显示宽度对齐
+		{nil, `level=L1
+国家/salary  (-inf,1000)  [1000,1000]  (1000,5000)  [5000,5000]  (5000,+inf)
+新加坡       0            0            1            1            1
+MY           1            1            1            1            1
+
+level=L2
+国家/salary  (-inf,1000)  [1000,1000]  (1000,5000)  [5000,5000]  (5000,+inf)
+新加坡       0            0            0            0            0
+MY           1            1            1            1            1
+`},
+		{&RenderOption{CollapseRange: true, TrueLabel: "Y", FalseLabel: "."}, `level=L1
+国家/salary  (-inf,1000]  (1000,+inf)
+新加坡       .            Y
+MY           Y            Y
+
+level=L2
+国家/salary  (-inf,+inf)
+新加坡       .
+MY           Y
+`},
+		{&RenderOption{Format: RenderFormatMarkdown, CollapseRange: true}, `**level=L1**
+
+| 国家/salary | (-inf,1000] | (1000,+inf) |
+| --- | --- | --- |
+| 新加坡 | 0 | 1 |
+| MY | 1 | 1 |
+
+**level=L2**
+
+| 国家/salary | (-inf,+inf) |
+| --- | --- |
+| 新加坡 | 0 |
+| MY | 1 |
+`},
+		//CSV 只合并行，各切片共用表头
+		{&RenderOption{Format: RenderFormatCSV, CollapseRange: true, Row: "salary", Column: "国家"}, `level,salary/国家,新加坡,MY
+L1,"(-inf,1000]",0,1
+L1,"(1000,+inf)",1,1
+L2,"(-inf,+inf)",0,1
+`},
+		{&RenderOption{Format: RenderFormatCSV, Row: "level", Column: "国家"}, `salary,level/国家,新加坡,MY
+"(-inf,1000)",L1,0,1
+"(-inf,1000)",L2,0,1
+"[1000,1000]",L1,0,1
+"[1000,1000]",L2,0,1
+"(1000,5000)",L1,1,1
+"(1000,5000)",L2,0,1
+"[5000,5000]",L1,1,1
+"[5000,5000]",L2,0,1
+"(5000,+inf)",L1,1,1
+"(5000,+inf)",L2,0,1
+`},
+		//只指定列为倒数第二个维度时，行取最后一个维度
+		{&RenderOption{Column: "国家", CollapseRange: true}, `level=L1
+salary/国家  新加坡  MY
+(-inf,1000]  0       1
+(1000,+inf)  1       1
+
+level=L2
+salary/国家  新加坡  MY
+(-inf,+inf)  0       1
+`},
+	}
+	for _, testCase := range caseList {
+		result, err := bitMap.RenderString(nil, testCase.option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != testCase.result {
+			t.Errorf("option %+v:\n%s\nwant:\n%s", testCase.option, result, testCase.result)
+		}
+	}
+}
+
+//没有 schema 的一维位图只有列，维度名称为 d0，标签为槽位下标
+func TestRenderOneDimension(t *testing.T) {
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{5}, [][]int64{{1}, {3}}); err != nil {
+		t.Fatal(err)
+	}
+	caseList := []struct {
+		option *RenderOption
+		result string
+	}{
+		{nil, "d0  0  1  2  3  4\n    0  1  0  1  0\n"},
+		{&RenderOption{Format: RenderFormatMarkdown, Column: "d0"}, "| d0 | 0 | 1 | 2 | 3 | 4 |\n| --- | --- | --- | --- | --- | --- |\n|  | 0 | 1 | 0 | 1 | 0 |\n"},
+		{&RenderOption{Format: RenderFormatCSV}, "d0,0,1,2,3,4\n,0,1,0,1,0\n"},
+	}
+	for _, testCase := range caseList {
+		result, err := bitMap.RenderString(nil, testCase.option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != testCase.result {
+			t.Errorf("option %+v: %q, want %q", testCase.option, result, testCase.result)
+		}
+	}
+	for _, option := range []*RenderOption{{Row: "d0"}, {Column: "d1"}, {Format: RenderFormat(9)}} {
+		if _, err := bitMap.RenderString(nil, option); !errors.Is(err, ErrInvalidRenderOption) && !errors.Is(err, ErrFunctionNotFound) {
+			t.Errorf("option %+v error %v", option, err)
+		}
+	}
+}
+
+func TestGetDisplayWidth(t *testing.T) {
+	caseList := []struct {
+		text  string
+		width int
+	}{
+		{"", 0},
+		{"SG", 2},
+		{"新加坡", 6},
+		{"HR-人事", 7},
+		{"ＡＢ", 4},
+		{"한국", 4},
+		{"e\u0301", 1},
+	}
+	for _, testCase := range caseList {
+		if width := getDisplayWidth(testCase.text); width != testCase.width {
+			t.Errorf("getDisplayWidth(%q) = %d, want %d", testCase.text, width, testCase.width)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package my_utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MDCondition 单维度条件
+// 离散维度：取值在 ValueList 中；范围维度：取值落在 IntervalList 任一区间中
+// Operator 为空时与 OperatorIn 相同，其余运算符见 CompileMDBitMap
+type MDCondition struct {
+	Function     string        `json:"function"`
+	Operator     string        `json:"operator,omitempty"`
+	ValueList    []interface{} `json:"value_list,omitempty"`
+	IntervalList []*Interval   `json:"interval_list,omitempty"`
+	// 条件覆盖的槽位下标，升序
+	slotList []int64
+}
+
+// MDRule 规则，各维度条件之间为"与"关系，未出现的维度表示不做限制
+type MDRule struct {
+	ConditionList []*MDCondition `json:"condition_list"`
+}
+
+// String 条件字符串表示
+//示例：country=MY、country in [MY, SG]、salary=5000、salary in (5000,+inf)、salary in (-inf,1000) or [5000,+inf)
+func (c *MDCondition) String() string {
+	if c.Operator != "" && c.Operator != OperatorIn {
+		valueList := make([]string, 0, len(c.ValueList))
+		for _, value := range c.ValueList {
+			valueList = append(valueList, fmt.Sprint(value))
+		}
+		for _, interval := range c.IntervalList {
+			valueList = append(valueList, interval.String())
+		}
+		return c.Function + " " + c.Operator + " [" + strings.Join(valueList, ", ") + "]"
+	}
+	if len(c.IntervalList) == 1 && c.IntervalList[0].isPoint() {
+		return c.Function + "=" + strconv.FormatFloat(*c.IntervalList[0].leftBoundary, 'f', -1, 64)
+	}
+	if len(c.IntervalList) > 0 {
+		intervalList := make([]string, 0, len(c.IntervalList))
+		for _, interval := range c.IntervalList {
+			intervalList = append(intervalList, interval.String())
+		}
+		return c.Function + " in " + strings.Join(intervalList, " or ")
+	}
+	if len(c.ValueList) == 1 {
+		return fmt.Sprintf("%s=%v", c.Function, c.ValueList[0])
+	}
+	valueList := make([]string, 0, len(c.ValueList))
+	for _, value := range c.ValueList {
+		valueList = append(valueList, fmt.Sprint(value))
+	}
+	return c.Function + " in [" + strings.Join(valueList, ", ") + "]"
+}
+
+// String 规则字符串表示，条件之间用逗号分隔，不限制任何维度时返回 *
+//示例：country=MY, salary in (5000,+inf)
+func (r *MDRule) String() string {
+	if len(r.ConditionList) == 0 {
+		return "*"
+	}
+	conditionList := make([]string, 0, len(r.ConditionList))
+	for _, condition := range r.ConditionList {
+		conditionList = append(conditionList, condition.String())
+	}
+	return strings.Join(conditionList, ", ")
+}
+
+// ToMinimalRuleList 将 MDBitMap 反编译为最简规则列表，规则之间为"或"关系
+/**
+ * @Description 从第一个维度开始，将子位图完全相同的槽位合并为同一条件，再对子位图递归处理
+ * 生成的规则互不相交且完整覆盖位图中所有为 true 的元素；覆盖某维度全部槽位的条件会被省略
+ * @e.g.
+	schema: A 取值 [A0,A1,A2]，B 取值 [B0,B1,B2,B3]
+	A/B B0 B1 B2 B3
+	A0  0  1  1  0
+	A1  0  1  1  0
+	A2  1  1  1  1
+	返回：[{A in [A0,A1], B in [B1,B2]}, {A in [A2]}]
+ **/
+func (m *MDBitMap) ToMinimalRuleList(schema *MDSchema) ([]*MDRule, error) {
+	if err := schema.checkMDBitMap(m); err != nil {
+		return nil, err
+	}
+	boxList := m.getMinimalBoxList(make([]int64, 0, len(m.lengthList)))
+	ruleList := make([]*MDRule, 0, len(boxList))
+	for _, box := range boxList {
+		ruleList = append(ruleList, schema.boxToRule(box))
+	}
+	return ruleList, nil
+}
+
+/*
+获取以 prefixIndexList 为前缀的子位图的最简"盒子"列表
+盒子为各维度槽位下标列表，nil 表示该维度不做限制
+示例：lengthList = [3,4]，prefixIndexList = []
+A/B B0 B1 B2 B3
+A0  0  1  1  0
+A1  0  1  1  0
+A2  1  1  1  1
+A0、A1 子位图相同，合并为 [[0,1], [1,2]]；A2 子位图全为 true，为 [[2], nil]
+*/
+func (m *MDBitMap) getMinimalBoxList(prefixIndexList []int64) [][][]int64 {
+	depth := len(prefixIndexList)
+	length := m.lengthList[depth]
+	indexList := append(prefixIndexList, 0)
+	//最后一个维度，直接收集为 true 的槽位
+	if depth == len(m.lengthList)-1 {
+		slotList := make([]int64, 0)
+		for i := int64(0); i < length; i++ {
+			indexList[depth] = i
+			if m.getValue(indexList) {
+				slotList = append(slotList, i)
+			}
+		}
+		if len(slotList) == 0 {
+			return nil
+		}
+		box := make([][]int64, len(m.lengthList))
+		if int64(len(slotList)) < length {
+			box[depth] = slotList
+		}
+		return [][][]int64{box}
+	}
+	//按子位图内容分组，跳过全为 false 的子位图
+	groupKeyList := make([]string, 0)
+	groupSlotMap := make(map[string][]int64)
+	for i := int64(0); i < length; i++ {
+		indexList[depth] = i
+		key, empty := m.getSubBitMapKey(indexList)
+		if empty {
+			continue
+		}
+		if _, ok := groupSlotMap[key]; !ok {
+			groupKeyList = append(groupKeyList, key)
+		}
+		groupSlotMap[key] = append(groupSlotMap[key], i)
+	}
+	boxList := make([][][]int64, 0)
+	for _, key := range groupKeyList {
+		slotList := groupSlotMap[key]
+		indexList[depth] = slotList[0]
+		for _, box := range m.getMinimalBoxList(indexList) {
+			if int64(len(slotList)) < length {
+				box[depth] = slotList
+			}
+			boxList = append(boxList, box)
+		}
+	}
+	return boxList
+}
+
+//计算盒子包含的元素个数
+func (m *MDBitMap) getBoxCellCount(box [][]int64) int64 {
+	count := int64(1)
+	for i, slotList := range box {
+		if slotList == nil {
+			count *= m.lengthList[i]
+			continue
+		}
+		count *= int64(len(slotList))
+	}
+	return count
+}
+
+//获取以 prefixIndexList 为前缀的子位图内容，用于判断子位图是否相同；empty 表示子位图全为 false
+func (m *MDBitMap) getSubBitMapKey(prefixIndexList []int64) (key string, empty bool) {
+	var builder strings.Builder
+	empty = true
+	m.rangeSubIndexList(prefixIndexList, func(indexList []int64, offset int64) bool {
+		if m.getBit(offset) {
+			builder.WriteByte('1')
+			empty = false
+		} else {
+			builder.WriteByte('0')
+		}
+		return true
+	})
+	return builder.String(), empty
+}
+
+//将盒子转换为规则，范围维度的连续槽位合并为区间
+func (s *MDSchema) boxToRule(box [][]int64) *MDRule {
+	rule := &MDRule{ConditionList: make([]*MDCondition, 0)}
+	for i, slotList := range box {
+		if slotList == nil {
+			continue
+		}
+		rule.ConditionList = append(rule.ConditionList, s.slotListToCondition(s.functionList[i], slotList))
+	}
+	return rule
+}
+
+//将某维度的槽位下标列表转换为条件
+func (s *MDSchema) slotListToCondition(function string, slotList []int64) *MDCondition {
+	condition := &MDCondition{Function: function, slotList: slotList}
+	if s.IsTreeFunction(function) {
+		condition.ValueList = s.collapseTreeSlotList(function, slotList)
+		return condition
+	}
+	if !s.IsRangeFunction(function) {
+		for _, slot := range slotList {
+			condition.ValueList = append(condition.ValueList, s.valueListMap[function][slot])
+		}
+		return condition
+	}
+	start := 0
+	for i := 1; i <= len(slotList); i++ {
+		if i < len(slotList) && slotList[i] == slotList[i-1]+1 {
+			continue
+		}
+		condition.IntervalList = append(condition.IntervalList, s.getSlotRangeInterval(function, slotList[start], slotList[i-1]))
+		start = i
+	}
+	return condition
+}
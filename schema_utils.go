@@ -0,0 +1,1112 @@
+package my_utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	// ErrInvalidSchema schema 定义不合法
+	ErrInvalidSchema = errors.New("invalid md schema")
+	// ErrInconsistentSchema schema 与位图结构不一致
+	ErrInconsistentSchema = errors.New("md schema is inconsistent with md bitmap")
+	// ErrFunctionNotFound 维度不存在
+	ErrFunctionNotFound = errors.New("function not found in md schema")
+	// ErrValueNotFound 取值没有对应的槽位
+	ErrValueNotFound = errors.New("value not found in md schema")
+)
+
+// MDSchema 多维位图结构描述，记录各维度(function)名称、顺序以及取值与槽位下标的对应关系
+/**
+ * 维度分为两类：
+ *   离散维度：functionValueIndexMap[function][value] = 槽位下标，下标取值 [0, len)
+ *   范围维度：rangeFunctionValueIndexMap[function][boundary] = 2k+1，k 为该边界值升序排列后的下标
+ * 范围维度的 n 个边界值 b0 < b1 < ... < bn-1 将数轴切分为 2n+1 个槽位：
+ *   (-∞,b0) [b0] (b0,b1) [b1] ... [bn-1] (bn-1,+∞)
+ *      0     1     2     3        2n-1     2n
+ * 与 getGTBitMapIndexList / getLTBitMapIndexList 的下标约定一致
+ **/
+type MDSchema struct {
+	functionIndexMap           map[string]int64
+	functionValueIndexMap      map[string]map[interface{}]int64
+	rangeFunctionValueIndexMap map[string]map[interface{}]int64
+	// 按维度下标排列的维度名称
+	functionList []string
+	// 离散维度：槽位下标 → 取值
+	valueListMap map[string][]interface{}
+	// 离散维度：归一化取值 → 槽位下标，见 normalizeValue，避免 int 与 int64 等类型不一致查不到
+	valueSlotMap map[string]map[interface{}]int64
+	// 范围维度：升序边界值（原始类型及 float64）
+	rangeValueListMap map[string][]interface{}
+	boundaryListMap   map[string][]float64
+	// 树形维度，见 SetFunctionTree
+	treeMap map[string]*functionTree
+	// 离散维度的保留槽位，见 SetReservedSlot
+	reservedSlotMap map[string]*reservedSlot
+	// 版本号缓存，schema 修改时重置，见 Version
+	version *schemaVersion
+}
+
+// schemaVersion 延迟计算的 schema 版本号
+type schemaVersion struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+// reservedSlot 离散维度的保留槽位，依次追加在枚举取值之后：NULL 槽位、其他取值槽位
+type reservedSlot struct {
+	nullSlot  bool
+	otherSlot bool
+}
+
+// otherValue 其他取值槽位对应的取值
+type otherValue struct{}
+
+// String 其他取值槽位的标签
+func (otherValue) String() string {
+	return "<other>"
+}
+
+// MarshalJSON 序列化为标签字符串
+func (otherValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(otherValue{}.String())
+}
+
+// OtherValue 离散维度"其他取值"槽位对应的取值，可用于条件中，如 country in [SG, OtherValue]
+//json 中为其标签 "<other>"，有其他取值槽位的维度不能再有同名的枚举取值，见 SetReservedSlot
+var OtherValue interface{} = otherValue{}
+
+// functionTree 树形维度，节点取值均为归一化后的取值
+type functionTree struct {
+	// 子节点 → 父节点（原始取值），用于序列化
+	parentMap map[interface{}]interface{}
+	// 归一化取值 → 原始取值
+	nodeMap map[interface{}]interface{}
+	// 节点 → 子节点列表，按包含的最小槽位排序
+	childListMap map[interface{}][]interface{}
+	// 根节点列表，按包含的最小槽位排序
+	rootList []interface{}
+	// 节点 → 所有后代叶子槽位（叶子节点为其自身槽位），升序
+	nodeSlotMap map[interface{}][]int64
+}
+
+// InitMDSchema 构造方法
+/**
+ * @Description 根据维度下标及各维度取值下标初始化 MDSchema，入参与 getBitMapIndexList 等方法一致
+ * @Param functionIndexMap 维度 → 维度下标， functionValueIndexMap 离散维度取值下标， rangeFunctionValueIndexMap 范围维度边界值下标
+ * @e.g.
+	输入：functionIndexMap = {country: 0, salary: 1}
+		 functionValueIndexMap = {country: {SG: 0, MY: 1}}
+		 rangeFunctionValueIndexMap = {salary: {5000: 1}}
+	返回 lengthList 为 [2,3] 的 schema，salary 槽位依次为 (-∞,5000) [5000] (5000,+∞)
+ **/
+func InitMDSchema(functionIndexMap map[string]int64, functionValueIndexMap map[string]map[interface{}]int64,
+	rangeFunctionValueIndexMap map[string]map[interface{}]int64) (*MDSchema, error) {
+	if len(functionIndexMap) == 0 {
+		return nil, fmt.Errorf("%w: function index map is empty", ErrInvalidSchema)
+	}
+	s := &MDSchema{
+		functionIndexMap:           make(map[string]int64, len(functionIndexMap)),
+		functionValueIndexMap:      make(map[string]map[interface{}]int64),
+		rangeFunctionValueIndexMap: make(map[string]map[interface{}]int64),
+		functionList:               make([]string, len(functionIndexMap)),
+		valueListMap:               make(map[string][]interface{}),
+		valueSlotMap:               make(map[string]map[interface{}]int64),
+		rangeValueListMap:          make(map[string][]interface{}),
+		boundaryListMap:            make(map[string][]float64),
+		treeMap:                    make(map[string]*functionTree),
+		reservedSlotMap:            make(map[string]*reservedSlot),
+		version:                    &schemaVersion{},
+	}
+	//维度下标必须为 [0, len) 且不重复
+	for function, index := range functionIndexMap {
+		if index < 0 || index >= int64(len(functionIndexMap)) || s.functionList[index] != "" {
+			return nil, fmt.Errorf("%w: invalid index %d of function %s", ErrInvalidSchema, index, function)
+		}
+		s.functionIndexMap[function] = index
+		s.functionList[index] = function
+	}
+	for function, valueIndexMap := range functionValueIndexMap {
+		if _, ok := functionIndexMap[function]; !ok {
+			return nil, fmt.Errorf("%w: function %s has no index", ErrInvalidSchema, function)
+		}
+		if len(valueIndexMap) == 0 {
+			return nil, fmt.Errorf("%w: function %s has no value", ErrInvalidSchema, function)
+		}
+		valueList := make([]interface{}, len(valueIndexMap))
+		filled := make([]bool, len(valueIndexMap))
+		copyMap := make(map[interface{}]int64, len(valueIndexMap))
+		slotMap := make(map[interface{}]int64, len(valueIndexMap))
+		for value, index := range valueIndexMap {
+			if index < 0 || index >= int64(len(valueIndexMap)) || filled[index] {
+				return nil, fmt.Errorf("%w: invalid index %d of value %v in function %s", ErrInvalidSchema, index, value, function)
+			}
+			if _, ok := slotMap[normalizeValue(value)]; ok {
+				return nil, fmt.Errorf("%w: duplicate value %v in function %s", ErrInvalidSchema, value, function)
+			}
+			valueList[index] = value
+			filled[index] = true
+			copyMap[value] = index
+			slotMap[normalizeValue(value)] = index
+		}
+		s.functionValueIndexMap[function] = copyMap
+		s.valueListMap[function] = valueList
+		s.valueSlotMap[function] = slotMap
+	}
+	for function, boundaryIndexMap := range rangeFunctionValueIndexMap {
+		if _, ok := functionIndexMap[function]; !ok {
+			return nil, fmt.Errorf("%w: function %s has no index", ErrInvalidSchema, function)
+		}
+		if _, ok := functionValueIndexMap[function]; ok {
+			return nil, fmt.Errorf("%w: function %s is both discrete and range", ErrInvalidSchema, function)
+		}
+		rangeValueList := make([]interface{}, 0, len(boundaryIndexMap))
+		for value := range boundaryIndexMap {
+			if _, ok := toFloat64(value); !ok {
+				return nil, fmt.Errorf("%w: boundary %v of function %s is not a number", ErrInvalidSchema, value, function)
+			}
+			rangeValueList = append(rangeValueList, value)
+		}
+		sort.Slice(rangeValueList, func(i, j int) bool {
+			left, _ := toFloat64(rangeValueList[i])
+			right, _ := toFloat64(rangeValueList[j])
+			return left < right
+		})
+		//边界值升序后第 k 个的下标必须为 2k+1
+		boundaryList := make([]float64, len(rangeValueList))
+		copyMap := make(map[interface{}]int64, len(boundaryIndexMap))
+		for k, value := range rangeValueList {
+			boundaryList[k], _ = toFloat64(value)
+			if k > 0 && boundaryList[k] == boundaryList[k-1] {
+				return nil, fmt.Errorf("%w: duplicate boundary %v in function %s", ErrInvalidSchema, value, function)
+			}
+			if boundaryIndexMap[value] != int64(2*k+1) {
+				return nil, fmt.Errorf("%w: boundary %v of function %s should have index %d", ErrInvalidSchema, value, function, 2*k+1)
+			}
+			copyMap[value] = int64(2*k + 1)
+		}
+		s.rangeFunctionValueIndexMap[function] = copyMap
+		s.rangeValueListMap[function] = rangeValueList
+		s.boundaryListMap[function] = boundaryList
+	}
+	for _, function := range s.functionList {
+		_, isDiscrete := s.functionValueIndexMap[function]
+		_, isRange := s.rangeFunctionValueIndexMap[function]
+		if !isDiscrete && !isRange {
+			return nil, fmt.Errorf("%w: function %s has no value index map", ErrInvalidSchema, function)
+		}
+	}
+	return s, nil
+}
+
+// SetFunctionTree 将离散维度设置为树形维度，如 公司 → BU → 部门 → 团队
+/**
+ * @Description parentMap 为 子节点 → 父节点，离散维度的取值为叶子节点，其余节点为中间节点；
+ * 编译条件时授予某个节点即授予其所有后代叶子节点，反编译时完全覆盖的子树合并为父节点
+ * 中间节点不能是该维度的取值，每个中间节点至少包含一个叶子节点，且不能有环；传入 nil 表示取消树形维度
+ * 需在 schema 投入使用前调用
+ * @e.g.
+	department 取值 [HR-1, HR-2, IT-1]
+	parentMap = {HR-1: BU-1, IT-1: BU-1, HR-2: BU-2, BU-1: Company, BU-2: Company}
+	条件 department in [BU-1] 编译为 department in [HR-1, IT-1]
+	反编译 department in [HR-1, IT-1, HR-2] 得到 department in [Company]
+ **/
+func (s *MDSchema) SetFunctionTree(function string, parentMap map[interface{}]interface{}) error {
+	if _, ok := s.functionIndexMap[function]; !ok {
+		return fmt.Errorf("%w: %s", ErrFunctionNotFound, function)
+	}
+	if s.IsRangeFunction(function) {
+		return fmt.Errorf("%w: range function %s can not be a tree", ErrInvalidSchema, function)
+	}
+	s.version = &schemaVersion{}
+	if parentMap == nil {
+		delete(s.treeMap, function)
+		return nil
+	}
+	tree := &functionTree{
+		parentMap:    make(map[interface{}]interface{}, len(parentMap)),
+		nodeMap:      make(map[interface{}]interface{}),
+		childListMap: make(map[interface{}][]interface{}),
+		nodeSlotMap:  make(map[interface{}][]int64),
+	}
+	normalizeParentMap := make(map[interface{}]interface{}, len(parentMap))
+	for child, parent := range parentMap {
+		for _, node := range []interface{}{child, parent} {
+			if node != nil && !reflect.TypeOf(node).Comparable() {
+				return fmt.Errorf("%w: tree node %v of function %s is not comparable", ErrInvalidSchema, node, function)
+			}
+		}
+		if _, ok := s.valueSlotMap[function][normalizeValue(parent)]; ok {
+			return fmt.Errorf("%w: tree node %v of function %s is a value and can not have children", ErrInvalidSchema, parent, function)
+		}
+		tree.parentMap[child] = parent
+		tree.nodeMap[normalizeValue(child)] = child
+		tree.nodeMap[normalizeValue(parent)] = parent
+		normalizeParentMap[normalizeValue(child)] = normalizeValue(parent)
+	}
+	for _, value := range s.valueListMap[function] {
+		tree.nodeMap[normalizeValue(value)] = value
+	}
+	//从每个叶子节点向上，将槽位加入所有祖先节点；路径长度超过节点数说明有环
+	for slot, value := range s.valueListMap[function] {
+		node := normalizeValue(value)
+		for depth := 0; ; depth++ {
+			if depth > len(tree.nodeMap) {
+				return fmt.Errorf("%w: tree of function %s has a cycle", ErrInvalidSchema, function)
+			}
+			tree.nodeSlotMap[node] = append(tree.nodeSlotMap[node], int64(slot))
+			parent, ok := normalizeParentMap[node]
+			if !ok {
+				break
+			}
+			node = parent
+		}
+	}
+	for node := range tree.nodeMap {
+		slotList, ok := tree.nodeSlotMap[node]
+		if !ok {
+			return fmt.Errorf("%w: tree node %v of function %s has no value", ErrInvalidSchema, tree.nodeMap[node], function)
+		}
+		sort.Slice(slotList, func(i, j int) bool { return slotList[i] < slotList[j] })
+		if parent, ok := normalizeParentMap[node]; ok {
+			tree.childListMap[parent] = append(tree.childListMap[parent], node)
+		} else {
+			tree.rootList = append(tree.rootList, node)
+		}
+	}
+	sortNode := func(nodeList []interface{}) {
+		sort.Slice(nodeList, func(i, j int) bool {
+			return tree.nodeSlotMap[nodeList[i]][0] < tree.nodeSlotMap[nodeList[j]][0]
+		})
+	}
+	sortNode(tree.rootList)
+	for _, childList := range tree.childListMap {
+		sortNode(childList)
+	}
+	s.treeMap[function] = tree
+	return nil
+}
+
+// SetReservedSlot 为离散维度设置保留槽位，保证取值范围扩大后位图仍能覆盖所有记录
+/**
+ * @Description nullSlot：取值为 nil 或缺失的记录落在 NULL 槽位，对应条件取值 nil；
+ * otherSlot：不在枚举取值中的记录落在其他取值槽位，对应条件取值 OtherValue
+ * 保留槽位依次追加在枚举取值之后，会改变 LengthList，需在 schema 投入使用前调用；重复调用以最后一次为准
+ * 条件语义：
+ *   in [SG]        只覆盖 SG 槽位
+ *   in [nil]       覆盖 NULL 槽位
+ *   in [OtherValue] 覆盖其他取值槽位；条件中不在枚举取值中的取值（如 VN）返回 ErrValueNotFound，不会授予其他取值槽位
+ *   not_in [SG]    覆盖除 SG 以外的所有槽位，包括其他取值槽位及 NULL 槽位
+ *   not_in [SG, nil] 覆盖除 SG 及 NULL 以外的所有槽位
+ * 枚举取值中已有 nil 时不能再设置 NULL 槽位；枚举取值中已有 "<other>" 时不能再设置其他取值槽位，避免与其标签混淆
+ **/
+func (s *MDSchema) SetReservedSlot(function string, nullSlot bool, otherSlot bool) error {
+	if _, ok := s.functionIndexMap[function]; !ok {
+		return fmt.Errorf("%w: %s", ErrFunctionNotFound, function)
+	}
+	if s.IsRangeFunction(function) {
+		return fmt.Errorf("%w: range function %s can not have reserved slot", ErrInvalidSchema, function)
+	}
+	s.version = &schemaVersion{}
+	valueList := s.getEnumValueList(function)
+	for _, value := range valueList {
+		if nullSlot && value == nil {
+			return fmt.Errorf("%w: function %s already has nil value", ErrInvalidSchema, function)
+		}
+		if otherSlot && value == (otherValue{}).String() {
+			return fmt.Errorf("%w: function %s already has value %s", ErrInvalidSchema, function, value)
+		}
+	}
+	reserved := &reservedSlot{nullSlot: nullSlot, otherSlot: otherSlot}
+	if nullSlot {
+		valueList = append(valueList, nil)
+	}
+	if otherSlot {
+		valueList = append(valueList, OtherValue)
+	}
+	valueIndexMap := make(map[interface{}]int64, len(valueList))
+	slotMap := make(map[interface{}]int64, len(valueList))
+	for slot, value := range valueList {
+		valueIndexMap[value] = int64(slot)
+		slotMap[normalizeValue(value)] = int64(slot)
+	}
+	s.functionValueIndexMap[function] = valueIndexMap
+	s.valueListMap[function] = valueList
+	s.valueSlotMap[function] = slotMap
+	if nullSlot || otherSlot {
+		s.reservedSlotMap[function] = reserved
+	} else {
+		delete(s.reservedSlotMap, function)
+	}
+	//槽位发生变化，重新计算树形维度
+	if tree, ok := s.treeMap[function]; ok {
+		return s.SetFunctionTree(function, tree.parentMap)
+	}
+	return nil
+}
+
+// getEnumValueList 获取离散维度的枚举取值，不包括保留槽位
+func (s *MDSchema) getEnumValueList(function string) []interface{} {
+	valueList := s.valueListMap[function]
+	if reserved, ok := s.reservedSlotMap[function]; ok {
+		if reserved.nullSlot {
+			valueList = valueList[:len(valueList)-1]
+		}
+		if reserved.otherSlot {
+			valueList = valueList[:len(valueList)-1]
+		}
+	}
+	return append([]interface{}{}, valueList...)
+}
+
+// hasOtherSlot 判断离散维度是否有其他取值槽位
+func (s *MDSchema) hasOtherSlot(function string) bool {
+	reserved, ok := s.reservedSlotMap[function]
+	return ok && reserved.otherSlot
+}
+
+// hasValue 判断离散维度是否有该取值对应的槽位，不会落入其他取值槽位
+func (s *MDSchema) hasValue(function string, value interface{}) bool {
+	if !isComparableValue(value) {
+		return false
+	}
+	_, ok := s.valueSlotMap[function][normalizeValue(value)]
+	return ok
+}
+
+// IsTreeFunction 判断维度是否为树形维度
+func (s *MDSchema) IsTreeFunction(function string) bool {
+	_, ok := s.treeMap[function]
+	return ok
+}
+
+// getValueSlotList 获取离散维度条件取值对应的槽位列表，树形维度的中间节点返回所有后代叶子槽位
+//条件取值必须是枚举取值、nil（NULL 槽位）或 OtherValue，其余取值返回 ErrValueNotFound，不落入其他取值槽位，
+//否则 in [VN] 会授予所有未枚举的取值
+func (s *MDSchema) getValueSlotList(function string, value interface{}) ([]int64, error) {
+	if !isComparableValue(value) {
+		return nil, fmt.Errorf("%w: function %s value %v is not comparable", ErrValueNotFound, function, value)
+	}
+	if tree, ok := s.treeMap[function]; ok {
+		if slotList, ok := tree.nodeSlotMap[normalizeValue(value)]; ok {
+			return slotList, nil
+		}
+	}
+	slot, err := s.getLabelSlot(function, value)
+	if err != nil {
+		return nil, err
+	}
+	return []int64{slot}, nil
+}
+
+// getLabelSlot 获取离散维度取值或标签对应的槽位，不落入其他取值槽位；有其他取值槽位时标签 "<other>" 即 OtherValue
+func (s *MDSchema) getLabelSlot(function string, label interface{}) (int64, error) {
+	if label == (otherValue{}).String() && s.hasOtherSlot(function) {
+		label = OtherValue
+	}
+	slot, ok := s.valueSlotMap[function][normalizeValue(label)]
+	if !ok {
+		return 0, fmt.Errorf("%w: function %s value %v", ErrValueNotFound, function, label)
+	}
+	return slot, nil
+}
+
+// collapseTreeSlotList 将树形维度的槽位列表转换为取值列表，完全覆盖的子树合并为父节点
+//示例：parentMap = {HR-1: BU-1, IT-1: BU-1, HR-2: BU-2}，槽位 [HR-1, IT-1, HR-2] → [BU-1, HR-2]
+func (s *MDSchema) collapseTreeSlotList(function string, slotList []int64) []interface{} {
+	tree := s.treeMap[function]
+	slotSet := make(map[int64]bool, len(slotList))
+	for _, slot := range slotList {
+		slotSet[slot] = true
+	}
+	valueList := make([]interface{}, 0)
+	var walk func(nodeList []interface{})
+	walk = func(nodeList []interface{}) {
+		for _, node := range nodeList {
+			covered, empty := true, true
+			for _, slot := range tree.nodeSlotMap[node] {
+				covered = covered && slotSet[slot]
+				empty = empty && !slotSet[slot]
+			}
+			if covered {
+				valueList = append(valueList, tree.nodeMap[node])
+			} else if !empty {
+				walk(tree.childListMap[node])
+			}
+		}
+	}
+	walk(tree.rootList)
+	return valueList
+}
+
+// getConditionValueList 获取反编译条件覆盖的取值，树形维度返回叶子节点取值而不是合并后的节点
+func (s *MDSchema) getConditionValueList(condition *MDCondition) []interface{} {
+	if !s.IsTreeFunction(condition.Function) || condition.slotList == nil {
+		return condition.ValueList
+	}
+	valueList := make([]interface{}, 0, len(condition.slotList))
+	for _, slot := range condition.slotList {
+		valueList = append(valueList, s.valueListMap[condition.Function][slot])
+	}
+	return valueList
+}
+
+// getOtherExcludeValueList 条件包含其他取值槽位时，获取条件未覆盖的非 nil 枚举取值，
+// 用于生成 NOT IN 形式的查询条件；条件不包含其他取值槽位时返回 false
+func (s *MDSchema) getOtherExcludeValueList(function string, valueList []interface{}) ([]interface{}, bool) {
+	hasOther := false
+	valueSet := make(map[interface{}]bool, len(valueList))
+	for _, value := range valueList {
+		if value == OtherValue {
+			hasOther = true
+		}
+		valueSet[normalizeValue(value)] = true
+	}
+	if !hasOther {
+		return nil, false
+	}
+	excludeList := make([]interface{}, 0)
+	for _, value := range s.getEnumValueList(function) {
+		if value != nil && !valueSet[normalizeValue(value)] {
+			excludeList = append(excludeList, value)
+		}
+	}
+	return excludeList, true
+}
+
+// Version schema 版本号，即 schema json 的 sha256 十六进制字符串
+/**
+ * @Description 维度、取值、边界值、树形结构、保留槽位及其顺序完全一致时版本号相同，可用于判断位图与 schema 是否匹配及作为缓存 key
+ * 首次调用时计算并缓存，SetFunctionTree、SetReservedSlot 会重置缓存；并发调用安全，但不能与修改 schema 的方法并发调用
+ **/
+func (s *MDSchema) Version() (string, error) {
+	version := s.version
+	if version == nil {
+		return s.getVersion()
+	}
+	version.once.Do(func() {
+		version.value, version.err = s.getVersion()
+	})
+	return version.value, version.err
+}
+
+func (s *MDSchema) getVersion() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// FunctionList 按维度下标顺序返回维度名称
+func (s *MDSchema) FunctionList() []string {
+	functionList := make([]string, len(s.functionList))
+	copy(functionList, s.functionList)
+	return functionList
+}
+
+// LengthList 返回该 schema 对应的 MDBitMap 各维度长度
+func (s *MDSchema) LengthList() []int64 {
+	return getBitMapLengthList(s.functionValueIndexMap, s.rangeFunctionValueIndexMap, s.functionIndexMap)
+}
+
+// IsRangeFunction 判断维度是否为范围维度
+func (s *MDSchema) IsRangeFunction(function string) bool {
+	_, ok := s.rangeFunctionValueIndexMap[function]
+	return ok
+}
+
+// GetSlotIndex 获取记录中维度取值对应的槽位下标
+/**
+ * @Description 离散维度按取值查找槽位，数值类型不区分 int / int64 / float64，不在枚举取值中的非 nil 取值落入其他取值槽位；
+ * 只用于查找记录，编译条件时不在枚举取值中的取值返回 ErrValueNotFound，见 SetReservedSlot
+ * 范围维度按数值落在的区间查找槽位，如边界值为 [5000]，取值 6000 返回槽位 2，即 (5000,+∞)
+ * 离散维度的取值为切片、map 等不可比较类型时返回 ErrValueNotFound
+ **/
+func (s *MDSchema) GetSlotIndex(function string, value interface{}) (int64, error) {
+	if _, ok := s.functionIndexMap[function]; !ok {
+		return 0, fmt.Errorf("%w: %s", ErrFunctionNotFound, function)
+	}
+	if !s.IsRangeFunction(function) {
+		//切片、map 等不可比较的取值不能作为枚举取值，也不落入其他取值槽位
+		if !isComparableValue(value) {
+			return 0, fmt.Errorf("%w: function %s value %v is not comparable", ErrValueNotFound, function, value)
+		}
+		slot, ok := s.valueSlotMap[function][normalizeValue(value)]
+		if !ok {
+			//不在枚举取值中的非 nil 取值落入其他取值槽位
+			if value != nil && s.hasOtherSlot(function) {
+				return s.valueSlotMap[function][OtherValue], nil
+			}
+			return 0, fmt.Errorf("%w: function %s value %v", ErrValueNotFound, function, value)
+		}
+		return slot, nil
+	}
+	number, ok := toFloat64(value)
+	if !ok {
+		return 0, fmt.Errorf("%w: function %s value %v is not a number", ErrValueNotFound, function, value)
+	}
+	boundaryList := s.boundaryListMap[function]
+	k := sort.SearchFloat64s(boundaryList, number)
+	if k < len(boundaryList) && boundaryList[k] == number {
+		return int64(2*k + 1), nil
+	}
+	return int64(2 * k), nil
+}
+
+// GetIndexList 将维度取值转换为 MDBitMap 下标，valueMap 需包含全部维度
+//示例：{country: MY, salary: 6000} → [1, 2]
+func (s *MDSchema) GetIndexList(valueMap map[string]interface{}) ([]int64, error) {
+	indexList := make([]int64, len(s.functionList))
+	for i, function := range s.functionList {
+		value, ok := valueMap[function]
+		if !ok && s.IsRangeFunction(function) {
+			return nil, fmt.Errorf("%w: function %s value is missing", ErrValueNotFound, function)
+		}
+		slot, err := s.GetSlotIndex(function, value)
+		if err != nil {
+			return nil, err
+		}
+		indexList[i] = slot
+	}
+	return indexList, nil
+}
+
+// checkMDBitMap 校验位图结构与 schema 是否一致
+func (s *MDSchema) checkMDBitMap(m *MDBitMap) error {
+	if !reflect.DeepEqual(s.LengthList(), m.lengthList) {
+		return ErrInconsistentSchema
+	}
+	return nil
+}
+
+// getSlotInterval 返回范围维度槽位对应的区间
+func (s *MDSchema) getSlotInterval(function string, slot int64) *Interval {
+	return s.getSlotRangeInterval(function, slot, slot)
+}
+
+// getSlotRangeInterval 返回范围维度连续槽位 [startSlot, endSlot] 合并后的区间
+//示例：边界值为 [1000, 5000]，槽位 [2, 4] 即 (1000,5000) [5000] (5000,+∞) 合并为 (1000,+∞)
+func (s *MDSchema) getSlotRangeInterval(function string, startSlot int64, endSlot int64) *Interval {
+	boundaryList := s.boundaryListMap[function]
+	var left, right *float64
+	var leftEqual, rightEqual bool
+	//奇数槽位为边界值本身，偶数槽位为两个边界值之间的开区间
+	if startSlot%2 == 1 {
+		left = &boundaryList[(startSlot-1)/2]
+		leftEqual = true
+	} else if startSlot > 0 {
+		left = &boundaryList[startSlot/2-1]
+	}
+	if endSlot%2 == 1 {
+		right = &boundaryList[(endSlot-1)/2]
+		rightEqual = true
+	} else if endSlot < int64(2*len(boundaryList)) {
+		right = &boundaryList[endSlot/2]
+	}
+	return InitInterval(left, leftEqual, right, rightEqual)
+}
+
+// getBoundaryValue 返回范围维度边界值的原始取值，用于生成查询参数
+func (s *MDSchema) getBoundaryValue(function string, boundary *float64) interface{} {
+	boundaryList := s.boundaryListMap[function]
+	k := sort.SearchFloat64s(boundaryList, *boundary)
+	if k < len(boundaryList) && boundaryList[k] == *boundary {
+		return s.rangeValueListMap[function][k]
+	}
+	return *boundary
+}
+
+// isComparableValue 判断取值能否作为 map key，nil 可以
+func isComparableValue(value interface{}) bool {
+	return value == nil || reflect.TypeOf(value).Comparable()
+}
+
+// normalizeValue 归一化离散维度的取值，使数值相等的不同数值类型对应同一个 map key
+/**
+ * 有符号整数统一为 int64，无符号整数不超过 math.MaxInt64 时为 int64，否则为 uint64；
+ * 整数值的浮点数转换为对应的整数，其余浮点数为 float64；json.Number 按其数值处理
+ * 整数不经过 float64 转换，超过 2^53 的不同整数不会落入同一个槽位
+ **/
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return normalizeUint64(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normalizeUint64(v)
+	case float32:
+		return normalizeFloat64(float64(v))
+	case float64:
+		return normalizeFloat64(v)
+	case json.Number:
+		return normalizeValue(normalizeJSONValue(v))
+	}
+	return value
+}
+
+func normalizeUint64(value uint64) interface{} {
+	if value <= math.MaxInt64 {
+		return int64(value)
+	}
+	return value
+}
+
+//整数值的浮点数转换为 int64 或 uint64，与同值的整数取值相同；NaN、±Inf 及小数保持 float64
+func normalizeFloat64(value float64) interface{} {
+	if math.IsInf(value, 0) || value != math.Trunc(value) {
+		return value
+	}
+	if value >= -1<<63 && value < 1<<63 {
+		return int64(value)
+	}
+	if value > 0 && value < 1<<64 {
+		return uint64(value)
+	}
+	return value
+}
+
+// toFloat64 将数值类型转换为 float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// GetSlotLabel 返回槽位对应的标签，离散维度为取值本身，范围维度为区间字符串，槽位越界时返回错误
+func (s *MDSchema) GetSlotLabel(function string, slot int64) (interface{}, error) {
+	functionIndex, ok := s.functionIndexMap[function]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, function)
+	}
+	if slot < 0 || slot >= s.LengthList()[functionIndex] {
+		return nil, fmt.Errorf("%w: slot %d of function %s", ErrValueNotFound, slot, function)
+	}
+	return s.getSlotLabel(function, slot), nil
+}
+
+// getSlotLabel 返回槽位对应的标签，离散维度为取值本身，范围维度为区间字符串
+func (s *MDSchema) getSlotLabel(function string, slot int64) interface{} {
+	if s.IsRangeFunction(function) {
+		return s.getSlotInterval(function, slot).String()
+	}
+	return s.valueListMap[function][slot]
+}
+
+// RemapMDBitMap 将基于 fromSchema 的位图转换为基于 toSchema 的位图
+/**
+ * @Description 用于 schema 新增取值后迁移旧位图，toSchema 需包含 fromSchema 的全部维度、离散取值及范围边界值，维度顺序可以不同
+ * 新增的离散取值对应元素为 false，fromSchema 有其他取值槽位时继承其他取值槽位的取值；
+ * fromSchema 的保留槽位在 toSchema 中也必须存在；范围维度新增边界值切分出的槽位继承原槽位的取值
+ * @e.g.
+	fromSchema: country [SG, MY]，salary 边界值 [5000]
+	toSchema:   country [SG, MY, TH]，salary 边界值 [3000, 5000]
+	原 {country=SG, salary in (-inf,5000)} 转换后为 {country=SG, salary in (-inf,5000)}，即 (-inf,3000) [3000] (3000,5000) 三个槽位
+ **/
+func (m *MDBitMap) RemapMDBitMap(fromSchema *MDSchema, toSchema *MDSchema) (*MDBitMap, error) {
+	if err := fromSchema.checkMDBitMap(m); err != nil {
+		return nil, err
+	}
+	if len(fromSchema.functionList) != len(toSchema.functionList) {
+		return nil, fmt.Errorf("%w: function count %d != %d", ErrInconsistentSchema, len(fromSchema.functionList), len(toSchema.functionList))
+	}
+	//slotMapList[toFunctionIndex][toSlot] = fromSlot，-1 表示原 schema 中没有对应槽位
+	fromIndexList := make([]int64, len(toSchema.functionList))
+	slotMapList := make([][]int64, len(toSchema.functionList))
+	toLengthList := toSchema.LengthList()
+	for i, function := range toSchema.functionList {
+		fromIndex, ok := fromSchema.functionIndexMap[function]
+		if !ok || fromSchema.IsRangeFunction(function) != toSchema.IsRangeFunction(function) {
+			return nil, fmt.Errorf("%w: function %s", ErrInconsistentSchema, function)
+		}
+		fromIndexList[i] = fromIndex
+		slotMap, err := getRemapSlotList(fromSchema, toSchema, function, toLengthList[i])
+		if err != nil {
+			return nil, err
+		}
+		slotMapList[i] = slotMap
+	}
+	finalMDBitMap := MDBitMap{}
+	if err := finalMDBitMap.InitMDBitMap(toLengthList, nil); err != nil {
+		return nil, err
+	}
+	fromIndexValueList := make([]int64, len(fromIndexList))
+	finalMDBitMap.rangeSubIndexList(nil, func(indexList []int64, offset int64) bool {
+		for i, slot := range indexList {
+			fromSlot := slotMapList[i][slot]
+			if fromSlot < 0 {
+				return true
+			}
+			fromIndexValueList[fromIndexList[i]] = fromSlot
+		}
+		if m.getValue(fromIndexValueList) {
+			finalMDBitMap.setBit(offset)
+		}
+		return true
+	})
+	return &finalMDBitMap, nil
+}
+
+//计算维度在 toSchema 中每个槽位对应的 fromSchema 槽位
+func getRemapSlotList(fromSchema *MDSchema, toSchema *MDSchema, function string, length int64) ([]int64, error) {
+	slotList := make([]int64, length)
+	if !toSchema.IsRangeFunction(function) {
+		for _, value := range fromSchema.valueListMap[function] {
+			if !toSchema.hasValue(function, value) {
+				return nil, fmt.Errorf("%w: value %v of function %s is removed", ErrInconsistentSchema, value, function)
+			}
+		}
+		//新增的枚举取值原本落在其他取值槽位，继承其他取值槽位的取值
+		for slot, value := range toSchema.valueListMap[function] {
+			fromSlot, err := fromSchema.GetSlotIndex(function, value)
+			if err != nil {
+				fromSlot = -1
+			}
+			slotList[slot] = fromSlot
+		}
+		return slotList, nil
+	}
+	for _, boundary := range fromSchema.boundaryListMap[function] {
+		if slot, _ := toSchema.GetSlotIndex(function, boundary); slot%2 == 0 {
+			return nil, fmt.Errorf("%w: boundary %v of function %s is removed", ErrInconsistentSchema, boundary, function)
+		}
+	}
+	toBoundaryList := toSchema.boundaryListMap[function]
+	for slot := int64(0); slot < length; slot++ {
+		//奇数槽位为边界值，直接查找；偶数槽位为开区间，用左边界查找后取其右侧的开区间
+		if slot%2 == 1 {
+			slotList[slot], _ = fromSchema.GetSlotIndex(function, toBoundaryList[(slot-1)/2])
+			continue
+		}
+		if slot == 0 {
+			slotList[slot] = 0
+			continue
+		}
+		leftSlot, _ := fromSchema.GetSlotIndex(function, toBoundaryList[slot/2-1])
+		if leftSlot%2 == 1 {
+			leftSlot++
+		}
+		slotList[slot] = leftSlot
+	}
+	return slotList, nil
+}
+
+// mergeMDSchema 合并两个 schema，维度顺序与 newSchema 一致，取值为两者并集
+/**
+ * 离散维度先排列 newSchema 的取值，再追加只在 oldSchema 中出现的取值；范围维度边界值取并集
+ * 两个 schema 的维度及维度类型必须一致
+ **/
+func mergeMDSchema(oldSchema *MDSchema, newSchema *MDSchema) (*MDSchema, error) {
+	if len(oldSchema.functionList) != len(newSchema.functionList) {
+		return nil, fmt.Errorf("%w: function count %d != %d", ErrInconsistentSchema, len(oldSchema.functionList), len(newSchema.functionList))
+	}
+	functionIndexMap := make(map[string]int64)
+	functionValueIndexMap := make(map[string]map[interface{}]int64)
+	rangeFunctionValueIndexMap := make(map[string]map[interface{}]int64)
+	for i, function := range newSchema.functionList {
+		if _, ok := oldSchema.functionIndexMap[function]; !ok || oldSchema.IsRangeFunction(function) != newSchema.IsRangeFunction(function) {
+			return nil, fmt.Errorf("%w: function %s", ErrInconsistentSchema, function)
+		}
+		functionIndexMap[function] = int64(i)
+		if !newSchema.IsRangeFunction(function) {
+			valueIndexMap := make(map[interface{}]int64)
+			for _, value := range newSchema.getEnumValueList(function) {
+				valueIndexMap[value] = int64(len(valueIndexMap))
+			}
+			for _, value := range oldSchema.getEnumValueList(function) {
+				if !newSchema.hasValue(function, value) {
+					valueIndexMap[value] = int64(len(valueIndexMap))
+				}
+			}
+			functionValueIndexMap[function] = valueIndexMap
+			continue
+		}
+		valueList := append([]interface{}{}, newSchema.rangeValueListMap[function]...)
+		for k, value := range oldSchema.rangeValueListMap[function] {
+			if slot, _ := newSchema.GetSlotIndex(function, oldSchema.boundaryListMap[function][k]); slot%2 == 0 {
+				valueList = append(valueList, value)
+			}
+		}
+		sort.Slice(valueList, func(i, j int) bool {
+			left, _ := toFloat64(valueList[i])
+			right, _ := toFloat64(valueList[j])
+			return left < right
+		})
+		boundaryIndexMap := make(map[interface{}]int64)
+		for k, value := range valueList {
+			boundaryIndexMap[value] = int64(2*k + 1)
+		}
+		rangeFunctionValueIndexMap[function] = boundaryIndexMap
+	}
+	schema, err := InitMDSchema(functionIndexMap, functionValueIndexMap, rangeFunctionValueIndexMap)
+	if err != nil {
+		return nil, err
+	}
+	//保留槽位取两者并集
+	for function, newReserved := range newSchema.reservedSlotMap {
+		oldReserved, ok := oldSchema.reservedSlotMap[function]
+		if !ok {
+			oldReserved = &reservedSlot{}
+		}
+		if err := schema.SetReservedSlot(function, newReserved.nullSlot || oldReserved.nullSlot, newReserved.otherSlot || oldReserved.otherSlot); err != nil {
+			return nil, err
+		}
+	}
+	for function, oldReserved := range oldSchema.reservedSlotMap {
+		if _, ok := newSchema.reservedSlotMap[function]; !ok {
+			if err := schema.SetReservedSlot(function, oldReserved.nullSlot, oldReserved.otherSlot); err != nil {
+				return nil, err
+			}
+		}
+	}
+	//树形维度合并两个版本的边，以 newSchema 为准
+	for _, function := range newSchema.functionList {
+		oldTree, oldOk := oldSchema.treeMap[function]
+		newTree, newOk := newSchema.treeMap[function]
+		if !oldOk && !newOk {
+			continue
+		}
+		parentMap := make(map[interface{}]interface{})
+		if oldOk {
+			for child, parent := range oldTree.parentMap {
+				parentMap[child] = parent
+			}
+		}
+		if newOk {
+			for child, parent := range newTree.parentMap {
+				parentMap[child] = parent
+			}
+		}
+		if err := schema.SetFunctionTree(function, parentMap); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+const (
+	schemaFunctionTypeDiscrete = "discrete"
+	schemaFunctionTypeRange    = "range"
+)
+
+// schemaFunctionJSON schema 中单个维度的 json 结构
+type schemaFunctionJSON struct {
+	Function     string        `json:"function"`
+	Type         string        `json:"type"`
+	ValueList    []interface{} `json:"value_list,omitempty"`
+	BoundaryList []interface{} `json:"boundary_list,omitempty"`
+	// 树形维度的边，见 SetFunctionTree
+	TreeList []*schemaTreeEdgeJSON `json:"tree,omitempty"`
+	// 保留槽位，见 SetReservedSlot
+	NullSlot  bool `json:"null_slot,omitempty"`
+	OtherSlot bool `json:"other_slot,omitempty"`
+}
+
+// schemaTreeEdgeJSON 树形维度的一条边
+type schemaTreeEdgeJSON struct {
+	Node   interface{} `json:"node"`
+	Parent interface{} `json:"parent"`
+}
+
+// schemaJSON schema 的 json 结构，维度按下标顺序排列，离散维度取值按槽位顺序排列
+type schemaJSON struct {
+	FunctionList []*schemaFunctionJSON `json:"function_list"`
+}
+
+// MarshalJSON 序列化 schema
+//示例：{"function_list":[{"function":"country","type":"discrete","value_list":["SG","MY"]},{"function":"salary","type":"range","boundary_list":[5000]}]}
+func (s *MDSchema) MarshalJSON() ([]byte, error) {
+	result := schemaJSON{FunctionList: make([]*schemaFunctionJSON, 0, len(s.functionList))}
+	for _, function := range s.functionList {
+		if s.IsRangeFunction(function) {
+			result.FunctionList = append(result.FunctionList, &schemaFunctionJSON{
+				Function:     function,
+				Type:         schemaFunctionTypeRange,
+				BoundaryList: s.rangeValueListMap[function],
+			})
+			continue
+		}
+		functionJSON := &schemaFunctionJSON{
+			Function:  function,
+			Type:      schemaFunctionTypeDiscrete,
+			ValueList: s.getEnumValueList(function),
+		}
+		if tree, ok := s.treeMap[function]; ok {
+			functionJSON.TreeList = tree.getEdgeList()
+		}
+		if reserved, ok := s.reservedSlotMap[function]; ok {
+			functionJSON.NullSlot = reserved.nullSlot
+			functionJSON.OtherSlot = reserved.otherSlot
+		}
+		result.FunctionList = append(result.FunctionList, functionJSON)
+	}
+	return json.Marshal(result)
+}
+
+// UnmarshalJSON 反序列化 schema，整数取值解析为 int64，其余数值解析为 float64
+func (s *MDSchema) UnmarshalJSON(data []byte) error {
+	var result schemaJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return err
+	}
+	functionIndexMap := make(map[string]int64)
+	functionValueIndexMap := make(map[string]map[interface{}]int64)
+	rangeFunctionValueIndexMap := make(map[string]map[interface{}]int64)
+	for i, function := range result.FunctionList {
+		if function == nil {
+			return fmt.Errorf("%w: function %d is null", ErrInvalidSchema, i)
+		}
+		if _, ok := functionIndexMap[function.Function]; ok {
+			return fmt.Errorf("%w: duplicate function %s", ErrInvalidSchema, function.Function)
+		}
+		functionIndexMap[function.Function] = int64(i)
+		switch function.Type {
+		case schemaFunctionTypeDiscrete:
+			valueIndexMap := make(map[interface{}]int64)
+			for j, value := range function.ValueList {
+				value = normalizeJSONValue(value)
+				if value != nil && !reflect.TypeOf(value).Comparable() {
+					return fmt.Errorf("%w: value %v of function %s is not comparable", ErrInvalidSchema, value, function.Function)
+				}
+				valueIndexMap[value] = int64(j)
+			}
+			if len(valueIndexMap) != len(function.ValueList) {
+				return fmt.Errorf("%w: duplicate value in function %s", ErrInvalidSchema, function.Function)
+			}
+			functionValueIndexMap[function.Function] = valueIndexMap
+		case schemaFunctionTypeRange:
+			boundaryList := make([]interface{}, 0, len(function.BoundaryList))
+			for _, value := range function.BoundaryList {
+				boundaryList = append(boundaryList, normalizeJSONValue(value))
+			}
+			sort.SliceStable(boundaryList, func(i, j int) bool {
+				left, _ := toFloat64(boundaryList[i])
+				right, _ := toFloat64(boundaryList[j])
+				return left < right
+			})
+			boundaryIndexMap := make(map[interface{}]int64)
+			for k, value := range boundaryList {
+				if _, ok := toFloat64(value); !ok {
+					return fmt.Errorf("%w: boundary %v of function %s is not a number", ErrInvalidSchema, value, function.Function)
+				}
+				boundaryIndexMap[value] = int64(2*k + 1)
+			}
+			if len(boundaryIndexMap) != len(boundaryList) {
+				return fmt.Errorf("%w: duplicate boundary in function %s", ErrInvalidSchema, function.Function)
+			}
+			rangeFunctionValueIndexMap[function.Function] = boundaryIndexMap
+		default:
+			return fmt.Errorf("%w: unknown type %q of function %s", ErrInvalidSchema, function.Type, function.Function)
+		}
+	}
+	schema, err := InitMDSchema(functionIndexMap, functionValueIndexMap, rangeFunctionValueIndexMap)
+	if err != nil {
+		return err
+	}
+	for _, function := range result.FunctionList {
+		if function.NullSlot || function.OtherSlot {
+			if err := schema.SetReservedSlot(function.Function, function.NullSlot, function.OtherSlot); err != nil {
+				return err
+			}
+		}
+		if len(function.TreeList) == 0 {
+			continue
+		}
+		parentMap := make(map[interface{}]interface{}, len(function.TreeList))
+		for _, edge := range function.TreeList {
+			if edge == nil {
+				return fmt.Errorf("%w: tree edge of function %s is null", ErrInvalidSchema, function.Function)
+			}
+			parentMap[normalizeJSONValue(edge.Node)] = normalizeJSONValue(edge.Parent)
+		}
+		if err := schema.SetFunctionTree(function.Function, parentMap); err != nil {
+			return err
+		}
+	}
+	*s = *schema
+	return nil
+}
+
+//按节点顺序（先根后子）返回树的所有边，保证序列化结果稳定
+func (t *functionTree) getEdgeList() []*schemaTreeEdgeJSON {
+	edgeList := make([]*schemaTreeEdgeJSON, 0, len(t.parentMap))
+	var walk func(nodeList []interface{})
+	walk = func(nodeList []interface{}) {
+		for _, node := range nodeList {
+			for _, child := range t.childListMap[node] {
+				edgeList = append(edgeList, &schemaTreeEdgeJSON{Node: t.nodeMap[child], Parent: t.nodeMap[node]})
+			}
+			walk(t.childListMap[node])
+		}
+	}
+	walk(t.rootList)
+	return edgeList
+}
+
+// normalizeJSONValue 将 json.Number 转换为 int64、超过 int64 范围的 uint64 或 float64
+func normalizeJSONValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if intValue, err := number.Int64(); err == nil {
+		return intValue
+	}
+	if uintValue, err := strconv.ParseUint(string(number), 10, 64); err == nil {
+		return uintValue
+	}
+	floatValue, _ := number.Float64()
+	return floatValue
+}
@@ -0,0 +1,263 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestGetSlotIndex(t *testing.T) {
+	schema := newTestSchema(t)
+	caseList := []struct {
+		function string
+		value    interface{}
+		slot     int64
+		err      error
+	}{
+		{"country", "SG", 0, nil},
+		{"country", "TH", 2, nil},
+		{"country", nil, 3, nil},
+		{"country", "VN", 4, nil},
+		//不可比较的取值不落入其他取值槽位
+		{"country", []string{"SG"}, 0, ErrValueNotFound},
+		{"country", map[string]interface{}{"a": 1}, 0, ErrValueNotFound},
+		{"salary", 999, 0, nil},
+		{"salary", int64(1000), 1, nil},
+		{"salary", 3000.5, 2, nil},
+		{"salary", 5000, 3, nil},
+		{"salary", 5001, 4, nil},
+		{"salary", "5000", 0, ErrValueNotFound},
+		{"level", 1, 0, ErrFunctionNotFound},
+	}
+	for _, testCase := range caseList {
+		slot, err := schema.GetSlotIndex(testCase.function, testCase.value)
+		if testCase.err != nil {
+			if !errors.Is(err, testCase.err) {
+				t.Errorf("GetSlotIndex(%s, %v) error %v, want %v", testCase.function, testCase.value, err, testCase.err)
+			}
+			continue
+		}
+		if err != nil || slot != testCase.slot {
+			t.Errorf("GetSlotIndex(%s, %v) = %d, %v, want %d", testCase.function, testCase.value, slot, err, testCase.slot)
+		}
+	}
+}
+
+//条件取值不在枚举取值中时不能落入其他取值槽位，in / not_in 均返回 ErrValueNotFound
+func TestConditionOtherSlot(t *testing.T) {
+	schema := newTestSchema(t)
+	caseList := []struct {
+		condition *MDCondition
+		slotList  []int64
+		err       error
+	}{
+		{&MDCondition{Function: "country", ValueList: []interface{}{"VN"}}, nil, ErrValueNotFound},
+		{&MDCondition{Function: "country", Operator: OperatorIn, ValueList: []interface{}{"SG", "VN"}}, nil, ErrValueNotFound},
+		{&MDCondition{Function: "country", Operator: OperatorNotIn, ValueList: []interface{}{"VN"}}, nil, ErrValueNotFound},
+		{&MDCondition{Function: "country", ValueList: []interface{}{[]string{"SG"}}}, nil, ErrValueNotFound},
+		{&MDCondition{Function: "country", ValueList: []interface{}{OtherValue}}, []int64{4}, nil},
+		{&MDCondition{Function: "country", ValueList: []interface{}{"SG", nil}}, []int64{0, 3}, nil},
+		{&MDCondition{Function: "country", Operator: OperatorNotIn, ValueList: []interface{}{"SG"}}, []int64{1, 2, 3, 4}, nil},
+		{&MDCondition{Function: "country", Operator: OperatorNotIn, ValueList: []interface{}{"SG", OtherValue}}, []int64{1, 2, 3}, nil},
+	}
+	for _, testCase := range caseList {
+		slotList, err := schema.getConditionSlotList(testCase.condition)
+		if testCase.err != nil {
+			if !errors.Is(err, testCase.err) {
+				t.Errorf("%s %v error %v, want %v", testCase.condition.Operator, testCase.condition.ValueList, err, testCase.err)
+			}
+			_, err := CompileMDBitMap(schema, []*MDRule{{ConditionList: []*MDCondition{testCase.condition}}})
+			if !errors.Is(err, testCase.err) {
+				t.Errorf("CompileMDBitMap %s %v error %v, want %v", testCase.condition.Operator, testCase.condition.ValueList, err, testCase.err)
+			}
+			continue
+		}
+		if err != nil || !equalInt64List(slotList, testCase.slotList) {
+			t.Errorf("%s %v = %v, %v, want %v", testCase.condition.Operator, testCase.condition.ValueList, slotList, err, testCase.slotList)
+		}
+	}
+	//记录查找仍落入其他取值槽位
+	if slot, err := schema.GetSlotIndex("country", "VN"); err != nil || slot != 4 {
+		t.Errorf("GetSlotIndex(country, VN) = %d, %v", slot, err)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	caseList := []struct {
+		value  interface{}
+		expect interface{}
+	}{
+		{1, int64(1)},
+		{uint8(1), int64(1)},
+		{float32(1), int64(1)},
+		{1.0, int64(1)},
+		{json.Number("1"), int64(1)},
+		{1.5, 1.5},
+		{int64(9007199254740993), int64(9007199254740993)},
+		{uint64(1 << 63), uint64(1 << 63)},
+		{float64(1 << 63), uint64(1 << 63)},
+		{json.Number("18446744073709551615"), uint64(18446744073709551615)},
+		{math.Inf(1), math.Inf(1)},
+		{"1", "1"},
+		{nil, nil},
+	}
+	for _, testCase := range caseList {
+		if result := normalizeValue(testCase.value); result != testCase.expect {
+			t.Errorf("normalizeValue(%v %T) = %v %T, want %v %T", testCase.value, testCase.value, result, result, testCase.expect, testCase.expect)
+		}
+	}
+}
+
+//超过 2^53 的不同整数不能落入同一个槽位
+func TestLargeIntegerSlot(t *testing.T) {
+	schema, err := InitMDSchema(map[string]int64{"employee_id": 0},
+		map[string]map[interface{}]int64{"employee_id": {int64(9007199254740993): 0, int64(9007199254740992): 1, 2: 2}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caseList := []struct {
+		value interface{}
+		slot  int64
+	}{
+		{int64(9007199254740993), 0},
+		{uint64(9007199254740993), 0},
+		{json.Number("9007199254740993"), 0},
+		{int64(9007199254740992), 1},
+		{float64(9007199254740992), 1},
+		{2.0, 2},
+	}
+	for _, testCase := range caseList {
+		if slot, err := schema.GetSlotIndex("employee_id", testCase.value); err != nil || slot != testCase.slot {
+			t.Errorf("GetSlotIndex(%v %T) = %d, %v, want %d", testCase.value, testCase.value, slot, err, testCase.slot)
+		}
+	}
+	bitMap, err := CompileMDBitMap(schema, []*MDRule{{ConditionList: []*MDCondition{
+		{Function: "employee_id", ValueList: []interface{}{int64(9007199254740993)}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := bitMap.CountMDBitMap(); count != 1 {
+		t.Fatalf("rule covers %d cells, want 1", count)
+	}
+	schema, err = InitMDSchema(map[string]int64{"employee_id": 0},
+		map[string]map[interface{}]int64{"employee_id": {int64(9007199254740993): 0, 2: 1}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := schema.GetIndexList(map[string]interface{}{"employee_id": int64(9007199254740992)}); !errors.Is(err, ErrValueNotFound) {
+		t.Fatalf("GetIndexList(9007199254740992) error %v", err)
+	}
+}
+
+//department 取值 [HR-1, HR-2, IT-1, IT-2]，树：HR-1、IT-1 → BU-1，HR-2、IT-2 → BU-2，BU-1、BU-2 → Company
+const testTreeSchemaJSON = `{"function_list":[
+	{"function":"department","type":"discrete","value_list":["HR-1","HR-2","IT-1","IT-2"],"tree":[
+		{"node":"HR-1","parent":"BU-1"},{"node":"IT-1","parent":"BU-1"},
+		{"node":"HR-2","parent":"BU-2"},{"node":"IT-2","parent":"BU-2"},
+		{"node":"BU-1","parent":"Company"},{"node":"BU-2","parent":"Company"}]},
+	{"function":"level","type":"discrete","value_list":[1,2]}]}`
+
+func newTestTreeSchema(t *testing.T) *MDSchema {
+	t.Helper()
+	schema := &MDSchema{}
+	if err := json.Unmarshal([]byte(testTreeSchemaJSON), schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+//节点展开为所有后代叶子节点的槽位
+func TestTreeConditionSlotList(t *testing.T) {
+	schema := newTestTreeSchema(t)
+	if !schema.IsTreeFunction("department") || schema.IsTreeFunction("level") {
+		t.Fatal("tree function mismatch")
+	}
+	caseList := []struct {
+		valueList []interface{}
+		slotList  []int64
+	}{
+		{[]interface{}{"HR-2"}, []int64{1}},
+		{[]interface{}{"BU-1"}, []int64{0, 2}},
+		{[]interface{}{"BU-2", "HR-1"}, []int64{0, 1, 3}},
+		{[]interface{}{"BU-1", "IT-1"}, []int64{0, 2}},
+		{[]interface{}{"Company"}, []int64{0, 1, 2, 3}},
+	}
+	for _, testCase := range caseList {
+		slotList, err := schema.getConditionSlotList(&MDCondition{Function: "department", ValueList: testCase.valueList})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalInt64List(slotList, testCase.slotList) {
+			t.Errorf("%v: slot list %v, want %v", testCase.valueList, slotList, testCase.slotList)
+		}
+	}
+	if _, err := schema.getConditionSlotList(&MDCondition{Function: "department", ValueList: []interface{}{"BU-3"}}); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("unknown node error %v", err)
+	}
+}
+
+//完全覆盖的子树合并为父节点，部分覆盖时递归到子节点
+func TestTreeCollapse(t *testing.T) {
+	schema := newTestTreeSchema(t)
+	caseList := []struct {
+		slotList  []int64
+		valueList []interface{}
+	}{
+		{[]int64{}, []interface{}{}},
+		{[]int64{1}, []interface{}{"HR-2"}},
+		{[]int64{0, 2}, []interface{}{"BU-1"}},
+		{[]int64{0, 1, 2}, []interface{}{"BU-1", "HR-2"}},
+		{[]int64{0, 1, 2, 3}, []interface{}{"Company"}},
+	}
+	for _, testCase := range caseList {
+		valueList := schema.collapseTreeSlotList("department", testCase.slotList)
+		if !reflect.DeepEqual(valueList, testCase.valueList) {
+			t.Errorf("%v: value list %v, want %v", testCase.slotList, valueList, testCase.valueList)
+		}
+	}
+	//反编译结果合并子树，重新编译结果一致
+	ruleList := getTestRuleList(t, `[{"condition_list":[{"function":"department","value_list":["HR-1","IT-1","HR-2"]},{"function":"level","value_list":[2]}]}]`)
+	bitMap, err := CompileMDBitMap(schema, ruleList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minimalRuleList, err := bitMap.ToMinimalRuleList(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(minimalRuleList) != 1 || len(minimalRuleList[0].ConditionList) != 2 ||
+		!reflect.DeepEqual(minimalRuleList[0].ConditionList[0].ValueList, []interface{}{"BU-1", "HR-2"}) {
+		t.Fatalf("minimal rule list %v", minimalRuleList)
+	}
+	compiledBitMap, err := CompileMDBitMap(schema, minimalRuleList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compiledBitMap.EqualMDBitMap(bitMap) {
+		t.Fatal("recompiled bitmap mismatch")
+	}
+}
+
+func TestSetFunctionTreeError(t *testing.T) {
+	caseList := []map[interface{}]interface{}{
+		//中间节点不能是取值
+		{"HR-1": "HR-2"},
+		//环
+		{"HR-1": "BU-1", "BU-1": "BU-2", "BU-2": "BU-1"},
+		//不可比较的节点
+		{"HR-1": []interface{}{"BU-1"}},
+	}
+	for _, parentMap := range caseList {
+		schema := newTestTreeSchema(t)
+		if err := schema.SetFunctionTree("department", parentMap); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%v: error %v", parentMap, err)
+		}
+	}
+	schema := newTestTreeSchema(t)
+	if err := schema.SetFunctionTree("department", nil); err != nil || schema.IsTreeFunction("department") {
+		t.Errorf("remove tree error %v", err)
+	}
+}
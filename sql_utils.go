@@ -0,0 +1,199 @@
+package my_utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSQLColumnNotFound 维度没有配置对应的列名
+	ErrSQLColumnNotFound = errors.New("sql column of function not found")
+	// ErrSQLInListTooLarge IN 列表长度超过上限
+	ErrSQLInListTooLarge = errors.New("sql in list too large")
+)
+
+// SQLDialect SQL 方言，决定占位符格式
+type SQLDialect int
+
+const (
+	// SQLDialectMySQL 占位符为 ?
+	SQLDialectMySQL SQLDialect = iota
+	// SQLDialectPostgreSQL 占位符为 $1, $2 ...
+	SQLDialectPostgreSQL
+)
+
+// DefaultSQLMaxInListSize 默认 IN 列表长度上限
+const DefaultSQLMaxInListSize = 1000
+
+// SQLOption 生成 SQL 条件的配置
+type SQLOption struct {
+	Dialect SQLDialect
+	// 维度 → 列名，列名原样拼接到 SQL 中（可带表别名，如 e.country），不能来自外部输入
+	ColumnMap map[string]string
+	// 单个 IN 列表的长度上限，<=0 时使用 DefaultSQLMaxInListSize
+	MaxInListSize int
+	// PostgreSQL 占位符起始偏移，拼接到已有参数的语句中时使用，如已有 2 个参数则传 2，生成 $3 开始的占位符
+	PlaceholderOffset int
+}
+
+// ToSQLWhere 将 MDBitMap 转换为参数化的 SQL WHERE 条件
+/**
+ * @Description 先反编译为最简规则列表，规则之间用 OR 连接，规则内各维度条件用 AND 连接
+ * 离散维度生成 = / IN，取值 nil 生成 IS NULL；范围维度按区间开闭生成 > >= < <=，单点区间生成 =
+ * 多条规则时整体加括号，如 ((a AND b) OR c)，可直接用 AND 拼接到已有的 WHERE 条件中
+ * 位图全为 false 时返回 1 = 0，全为 true 时返回 1 = 1
+ * @Param schema 位图结构， option 列名及方言配置
+ * @return 条件语句，参数列表
+ * @e.g.
+	country 取值 [SG, MY, TH]，salary 边界值 [5000]
+	规则 {country in [SG, MY], salary in (5000,+∞)}，MySQL 方言
+	返回：country IN (?, ?) AND salary > ?, [SG, MY, 5000]
+ **/
+func (m *MDBitMap) ToSQLWhere(schema *MDSchema, option *SQLOption) (string, []interface{}, error) {
+	ruleList, err := m.ToMinimalRuleList(schema)
+	if err != nil {
+		return "", nil, err
+	}
+	if option == nil {
+		option = &SQLOption{}
+	}
+	builder := &sqlBuilder{schema: schema, option: option, argList: make([]interface{}, 0)}
+	if len(ruleList) == 0 {
+		return "1 = 0", builder.argList, nil
+	}
+	ruleSQLList := make([]string, 0, len(ruleList))
+	for _, rule := range ruleList {
+		//规则不限制任何维度，说明位图全为 true
+		if len(rule.ConditionList) == 0 {
+			return "1 = 1", make([]interface{}, 0), nil
+		}
+		conditionSQLList := make([]string, 0, len(rule.ConditionList))
+		for _, condition := range rule.ConditionList {
+			conditionSQL, err := builder.buildCondition(condition)
+			if err != nil {
+				return "", nil, err
+			}
+			conditionSQLList = append(conditionSQLList, conditionSQL)
+		}
+		//只有一条规则时不需要外层括号
+		if len(ruleList) == 1 {
+			return strings.Join(conditionSQLList, " AND "), builder.argList, nil
+		}
+		ruleSQLList = append(ruleSQLList, joinSQL(conditionSQLList, " AND "))
+	}
+	//多条规则整体加括号，调用方可直接用 AND 与其他条件拼接
+	return joinSQL(ruleSQLList, " OR "), builder.argList, nil
+}
+
+type sqlBuilder struct {
+	schema  *MDSchema
+	option  *SQLOption
+	argList []interface{}
+}
+
+//添加参数并返回对应占位符
+func (b *sqlBuilder) placeholder(arg interface{}) string {
+	b.argList = append(b.argList, arg)
+	if b.option.Dialect == SQLDialectPostgreSQL {
+		return "$" + strconv.Itoa(b.option.PlaceholderOffset+len(b.argList))
+	}
+	return "?"
+}
+
+func (b *sqlBuilder) buildCondition(condition *MDCondition) (string, error) {
+	column, ok := b.option.ColumnMap[condition.Function]
+	if !ok || column == "" {
+		return "", fmt.Errorf("%w: %s", ErrSQLColumnNotFound, condition.Function)
+	}
+	if b.schema.IsRangeFunction(condition.Function) {
+		sqlList := make([]string, 0, len(condition.IntervalList))
+		for _, interval := range condition.IntervalList {
+			sqlList = append(sqlList, b.buildInterval(condition.Function, column, interval))
+		}
+		return joinSQL(sqlList, " OR "), nil
+	}
+	sqlList := make([]string, 0, 2)
+	conditionValueList := b.schema.getConditionValueList(condition)
+	valueList := make([]interface{}, 0, len(conditionValueList))
+	hasNull := false
+	for _, value := range conditionValueList {
+		if value == nil {
+			hasNull = true
+			continue
+		}
+		valueList = append(valueList, value)
+	}
+	maxInListSize := b.option.MaxInListSize
+	if maxInListSize <= 0 {
+		maxInListSize = DefaultSQLMaxInListSize
+	}
+	//包含其他取值槽位时，改为排除条件未覆盖的枚举取值
+	excludeList, hasOther := b.schema.getOtherExcludeValueList(condition.Function, conditionValueList)
+	if hasOther {
+		valueList = nil
+		if len(excludeList) > maxInListSize {
+			return "", fmt.Errorf("%w: function %s excludes %d values, limit %d", ErrSQLInListTooLarge, condition.Function, len(excludeList), maxInListSize)
+		}
+		switch len(excludeList) {
+		case 0:
+			sqlList = append(sqlList, column+" IS NOT NULL")
+		case 1:
+			sqlList = append(sqlList, column+" <> "+b.placeholder(excludeList[0]))
+		default:
+			placeholderList := make([]string, 0, len(excludeList))
+			for _, value := range excludeList {
+				placeholderList = append(placeholderList, b.placeholder(value))
+			}
+			sqlList = append(sqlList, column+" NOT IN ("+strings.Join(placeholderList, ", ")+")")
+		}
+	}
+	if len(valueList) > maxInListSize {
+		return "", fmt.Errorf("%w: function %s has %d values, limit %d", ErrSQLInListTooLarge, condition.Function, len(valueList), maxInListSize)
+	}
+	if len(valueList) == 1 {
+		sqlList = append(sqlList, column+" = "+b.placeholder(valueList[0]))
+	} else if len(valueList) > 1 {
+		placeholderList := make([]string, 0, len(valueList))
+		for _, value := range valueList {
+			placeholderList = append(placeholderList, b.placeholder(value))
+		}
+		sqlList = append(sqlList, column+" IN ("+strings.Join(placeholderList, ", ")+")")
+	}
+	if hasNull {
+		sqlList = append(sqlList, column+" IS NULL")
+	}
+	return joinSQL(sqlList, " OR "), nil
+}
+
+//区间转换为比较条件，如 (5000,+∞) → salary > ?，[1000,5000) → salary >= ? AND salary < ?
+func (b *sqlBuilder) buildInterval(function string, column string, interval *Interval) string {
+	if interval.isPoint() {
+		return column + " = " + b.placeholder(b.schema.getBoundaryValue(function, interval.leftBoundary))
+	}
+	sqlList := make([]string, 0, 2)
+	if interval.leftBoundary != nil {
+		operator := " > "
+		if interval.leftEqual {
+			operator = " >= "
+		}
+		sqlList = append(sqlList, column+operator+b.placeholder(b.schema.getBoundaryValue(function, interval.leftBoundary)))
+	}
+	if interval.rightBoundary != nil {
+		operator := " < "
+		if interval.rightEqual {
+			operator = " <= "
+		}
+		sqlList = append(sqlList, column+operator+b.placeholder(b.schema.getBoundaryValue(function, interval.rightBoundary)))
+	}
+	return joinSQL(sqlList, " AND ")
+}
+
+//多个条件用 separator 连接并加括号，单个条件原样返回
+func joinSQL(sqlList []string, separator string) string {
+	if len(sqlList) == 1 {
+		return sqlList[0]
+	}
+	return "(" + strings.Join(sqlList, separator) + ")"
+}
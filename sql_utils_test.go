@@ -0,0 +1,100 @@
+package my_utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testSQLColumnMap = map[string]string{"country": "e.country", "salary": "salary"}
+
+func TestToSQLWhere(t *testing.T) {
+	schema := newTestSchema(t)
+	caseList := []struct {
+		ruleJSON string
+		option   *SQLOption
+		where    string
+		argList  []interface{}
+	}{
+		//多条规则整体加括号
+		{`[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]},
+			{"condition_list":[{"function":"country","value_list":["TH"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"((e.country IN (?, ?) AND salary > ?) OR e.country = ?)", []interface{}{"SG", "MY", int64(5000), "TH"}},
+		{`[{"condition_list":[{"function":"country","value_list":["SG","MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]},
+			{"condition_list":[{"function":"country","value_list":["TH"]}]}]`,
+			&SQLOption{Dialect: SQLDialectPostgreSQL, ColumnMap: testSQLColumnMap},
+			"((e.country IN ($1, $2) AND salary > $3) OR e.country = $4)", []interface{}{"SG", "MY", int64(5000), "TH"}},
+		//占位符偏移
+		{`[{"condition_list":[{"function":"salary","operator":"gte","value_list":[1000]},{"function":"salary","operator":"lt","value_list":[5000]}]}]`,
+			&SQLOption{Dialect: SQLDialectPostgreSQL, ColumnMap: testSQLColumnMap, PlaceholderOffset: 2},
+			"(salary >= $3 AND salary < $4)", []interface{}{int64(1000), int64(5000)}},
+		//MySQL 忽略占位符偏移
+		{`[{"condition_list":[{"function":"salary","operator":"gte","value_list":[1000]},{"function":"salary","operator":"lt","value_list":[5000]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap, PlaceholderOffset: 2},
+			"(salary >= ? AND salary < ?)", []interface{}{int64(1000), int64(5000)}},
+		{`[{"condition_list":[{"function":"salary","value_list":[5000]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"salary = ?", []interface{}{int64(5000)}},
+		{`[{"condition_list":[{"function":"country","value_list":[null,"SG"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"(e.country = ? OR e.country IS NULL)", []interface{}{"SG"}},
+		{`[{"condition_list":[{"function":"country","value_list":[null]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"e.country IS NULL", []interface{}{}},
+		//其他取值槽位改为排除未覆盖的枚举取值
+		{`[{"condition_list":[{"function":"country","value_list":["<other>","SG"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"e.country NOT IN (?, ?)", []interface{}{"MY", "TH"}},
+		{`[{"condition_list":[{"function":"country","value_list":["<other>","SG","MY"]}]}]`,
+			&SQLOption{Dialect: SQLDialectPostgreSQL, ColumnMap: testSQLColumnMap, PlaceholderOffset: 1},
+			"e.country <> $2", []interface{}{"TH"}},
+		{`[{"condition_list":[{"function":"country","value_list":["<other>","SG","MY","TH"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"e.country IS NOT NULL", []interface{}{}},
+		{`[{"condition_list":[{"function":"country","value_list":["<other>",null]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap},
+			"(e.country NOT IN (?, ?, ?) OR e.country IS NULL)", []interface{}{"SG", "MY", "TH"}},
+		{`[]`, nil, "1 = 0", []interface{}{}},
+		{`[{"condition_list":[]}]`, nil, "1 = 1", []interface{}{}},
+	}
+	for _, testCase := range caseList {
+		bitMap := compileTestRuleList(t, schema, testCase.ruleJSON)
+		where, argList, err := bitMap.ToSQLWhere(schema, testCase.option)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.ruleJSON, err)
+			continue
+		}
+		if where != testCase.where || !reflect.DeepEqual(argList, testCase.argList) {
+			t.Errorf("%s: got %s %#v, want %s %#v", testCase.ruleJSON, where, argList, testCase.where, testCase.argList)
+		}
+	}
+}
+
+func TestToSQLWhereError(t *testing.T) {
+	schema := newTestSchema(t)
+	caseList := []struct {
+		ruleJSON string
+		option   *SQLOption
+		err      error
+	}{
+		{`[{"condition_list":[{"function":"country","value_list":["SG","MY","TH"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap, MaxInListSize: 2}, ErrSQLInListTooLarge},
+		{`[{"condition_list":[{"function":"country","value_list":["<other>"]}]}]`,
+			&SQLOption{ColumnMap: testSQLColumnMap, MaxInListSize: 2}, ErrSQLInListTooLarge},
+		{`[{"condition_list":[{"function":"country","value_list":["SG"]}]}]`,
+			&SQLOption{ColumnMap: map[string]string{"salary": "salary"}}, ErrSQLColumnNotFound},
+		{`[{"condition_list":[{"function":"country","value_list":["SG"]}]}]`, nil, ErrSQLColumnNotFound},
+	}
+	for _, testCase := range caseList {
+		bitMap := compileTestRuleList(t, schema, testCase.ruleJSON)
+		if _, _, err := bitMap.ToSQLWhere(schema, testCase.option); !errors.Is(err, testCase.err) {
+			t.Errorf("%s: error %v, want %v", testCase.ruleJSON, err, testCase.err)
+		}
+	}
+	//上限内的 IN 列表正常生成
+	bitMap := compileTestRuleList(t, schema, `[{"condition_list":[{"function":"country","value_list":["SG","MY"]}]}]`)
+	if _, _, err := bitMap.ToSQLWhere(schema, &SQLOption{ColumnMap: testSQLColumnMap, MaxInListSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,463 @@
+package my_utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPolicyNotFound 策略或策略版本不存在
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrRevisionConflict 策略当前版本号与期望版本号不一致，说明已被其他写入方修改
+	ErrRevisionConflict = errors.New("policy revision conflict")
+	// ErrInvalidPolicy 策略不合法
+	ErrInvalidPolicy = errors.New("invalid policy")
+)
+
+// Policy 命名的角色策略，每次写入生成一个新的版本
+type Policy struct {
+	Name string `json:"name"`
+	// 策略的条件源码，即编译前的规则列表
+	Source []*MDRule `json:"source"`
+	// 编译后的位图，只读
+	BitMap *MDBitMap `json:"-"`
+	// 编译时 schema 的版本号，见 MDSchema.Version；为空且位图附加了 schema 时写入时自动填充
+	SchemaVersion string `json:"schema_version"`
+	// 版本号，从 1 开始递增，由 PolicyStore 写入时生成
+	Revision int64 `json:"revision"`
+	// 写入时间，由 PolicyStore 写入时生成
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// PolicyStore 带历史版本的策略存储，实现需并发安全
+/**
+ * @Description 乐观并发控制：写入时传入期望的当前版本号 expectedRevision，与实际不一致时返回 ErrRevisionConflict，
+ * 新策略的 expectedRevision 为 0；写入成功后版本号为 expectedRevision+1
+ * 返回的 Policy 为拷贝，其中的位图为只读
+ **/
+type PolicyStore interface {
+	// Put 写入策略的新版本，返回写入后的策略
+	Put(policy *Policy, expectedRevision int64) (*Policy, error)
+	// Get 获取策略的最新版本
+	Get(name string) (*Policy, error)
+	// List 获取所有策略的最新版本，按名称排序
+	List() ([]*Policy, error)
+	// History 获取策略的所有版本，按版本号升序
+	History(name string) ([]*Policy, error)
+	// Rollback 将策略回滚到 revision 版本：以该版本的内容写入一个新版本，历史版本保留
+	Rollback(name string, revision int64, expectedRevision int64) (*Policy, error)
+}
+
+//校验待写入的策略并生成新版本
+func newPolicyRevision(policy *Policy, expectedRevision int64) (*Policy, error) {
+	if policy == nil || policy.Name == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidPolicy)
+	}
+	if policy.BitMap == nil {
+		return nil, fmt.Errorf("%w: %s has no bitmap", ErrInvalidPolicy, policy.Name)
+	}
+	if expectedRevision < 0 {
+		return nil, fmt.Errorf("%w: expected revision %d", ErrInvalidPolicy, expectedRevision)
+	}
+	result := policy.copyPolicy()
+	result.BitMap = policy.BitMap.CopyMDBitMap()
+	if result.SchemaVersion == "" && result.BitMap.schema != nil {
+		version, err := result.BitMap.schema.Version()
+		if err != nil {
+			return nil, err
+		}
+		result.SchemaVersion = version
+	}
+	result.Revision = expectedRevision + 1
+	result.UpdateTime = time.Now()
+	return result, nil
+}
+
+//拷贝策略，源码深拷贝，调用方修改返回的规则、条件不影响 store 中的版本；位图只读，共用
+func (p *Policy) copyPolicy() *Policy {
+	result := *p
+	result.Source = copyRuleList(p.Source)
+	return &result
+}
+
+//深拷贝规则列表，nil 规则、条件原样保留；区间不提供修改方法，按值拷贝
+func copyRuleList(ruleList []*MDRule) []*MDRule {
+	if ruleList == nil {
+		return nil
+	}
+	result := make([]*MDRule, len(ruleList))
+	for i, rule := range ruleList {
+		if rule == nil {
+			continue
+		}
+		copiedRule := &MDRule{}
+		if rule.ConditionList != nil {
+			copiedRule.ConditionList = make([]*MDCondition, len(rule.ConditionList))
+		}
+		for j, condition := range rule.ConditionList {
+			if condition == nil {
+				continue
+			}
+			copiedCondition := *condition
+			if condition.ValueList != nil {
+				copiedCondition.ValueList = append([]interface{}{}, condition.ValueList...)
+			}
+			if condition.IntervalList != nil {
+				copiedCondition.IntervalList = make([]*Interval, len(condition.IntervalList))
+				for k, interval := range condition.IntervalList {
+					if interval != nil {
+						copiedInterval := *interval
+						copiedCondition.IntervalList[k] = &copiedInterval
+					}
+				}
+			}
+			if condition.slotList != nil {
+				copiedCondition.slotList = append([]int64{}, condition.slotList...)
+			}
+			copiedRule.ConditionList[j] = &copiedCondition
+		}
+		result[i] = copiedRule
+	}
+	return result
+}
+
+//以 store 中 revision 版本的内容写入新版本
+func rollbackPolicy(store PolicyStore, name string, revision int64, expectedRevision int64) (*Policy, error) {
+	historyList, err := store.History(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range historyList {
+		if policy.Revision == revision {
+			return store.Put(policy, expectedRevision)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s revision %d", ErrPolicyNotFound, name, revision)
+}
+
+// MemoryPolicyStore 内存实现的 PolicyStore
+type MemoryPolicyStore struct {
+	mutex sync.RWMutex
+	// 策略名称 → 按版本号升序的所有版本
+	historyMap map[string][]*Policy
+}
+
+// InitMemoryPolicyStore 构造方法
+func InitMemoryPolicyStore() *MemoryPolicyStore {
+	return &MemoryPolicyStore{historyMap: make(map[string][]*Policy)}
+}
+
+// Put 见 PolicyStore
+func (s *MemoryPolicyStore) Put(policy *Policy, expectedRevision int64) (*Policy, error) {
+	result, err := newPolicyRevision(policy, expectedRevision)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	historyList := s.historyMap[result.Name]
+	if int64(len(historyList)) != expectedRevision {
+		return nil, fmt.Errorf("%w: %s current revision %d, expect %d", ErrRevisionConflict, result.Name, len(historyList), expectedRevision)
+	}
+	s.historyMap[result.Name] = append(historyList, result)
+	return result.copyPolicy(), nil
+}
+
+// Get 见 PolicyStore
+func (s *MemoryPolicyStore) Get(name string) (*Policy, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	historyList, ok := s.historyMap[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, name)
+	}
+	return historyList[len(historyList)-1].copyPolicy(), nil
+}
+
+// List 见 PolicyStore
+func (s *MemoryPolicyStore) List() ([]*Policy, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	policyList := make([]*Policy, 0, len(s.historyMap))
+	for _, historyList := range s.historyMap {
+		policyList = append(policyList, historyList[len(historyList)-1].copyPolicy())
+	}
+	sort.Slice(policyList, func(i, j int) bool { return policyList[i].Name < policyList[j].Name })
+	return policyList, nil
+}
+
+// History 见 PolicyStore
+func (s *MemoryPolicyStore) History(name string) ([]*Policy, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	historyList, ok := s.historyMap[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, name)
+	}
+	policyList := make([]*Policy, 0, len(historyList))
+	for _, policy := range historyList {
+		policyList = append(policyList, policy.copyPolicy())
+	}
+	return policyList, nil
+}
+
+// Rollback 见 PolicyStore
+func (s *MemoryPolicyStore) Rollback(name string, revision int64, expectedRevision int64) (*Policy, error) {
+	return rollbackPolicy(s, name, revision, expectedRevision)
+}
+
+// policyFileExt 策略版本文件扩展名
+const policyFileExt = ".policy"
+
+// FSPolicyStore 文件系统实现的 PolicyStore，多个进程可共用同一目录
+/**
+ * @Description 目录结构：dir/<转义后的策略名称>/<20 位版本号>.policy，每个版本一个文件，写入后不再修改
+ * 文件格式：元数据 json 长度（uvarint）| 元数据 json（Policy 除位图外的字段）| 位图（MarshalBinary 格式）
+ * 写入时先写临时文件，再用 os.Link 创建版本文件，版本文件已存在时 Link 失败，即版本号冲突，
+ * 因此多个进程并发写入同一版本时只有一个成功，不会出现部分写入的文件
+ * 策略名称经 url.PathEscape 转义，不能为 "." 或 ".."
+ **/
+type FSPolicyStore struct {
+	dir string
+}
+
+// InitFSPolicyStore 构造方法，dir 不存在时自动创建
+func InitFSPolicyStore(dir string) (*FSPolicyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FSPolicyStore{dir: dir}, nil
+}
+
+// Put 见 PolicyStore
+func (s *FSPolicyStore) Put(policy *Policy, expectedRevision int64) (*Policy, error) {
+	result, err := newPolicyRevision(policy, expectedRevision)
+	if err != nil {
+		return nil, err
+	}
+	policyDir, err := s.getPolicyDir(result.Name)
+	if err != nil {
+		return nil, err
+	}
+	revisionList, err := s.getRevisionList(policyDir)
+	if err != nil && !errors.Is(err, ErrPolicyNotFound) {
+		return nil, err
+	}
+	currentRevision := int64(0)
+	if len(revisionList) > 0 {
+		currentRevision = revisionList[len(revisionList)-1]
+	}
+	if currentRevision != expectedRevision {
+		return nil, fmt.Errorf("%w: %s current revision %d, expect %d", ErrRevisionConflict, result.Name, currentRevision, expectedRevision)
+	}
+	data, err := encodePolicyFile(result)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(policyDir, 0o755); err != nil {
+		return nil, err
+	}
+	tempFile, err := os.CreateTemp(policyDir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempFile.Name())
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return nil, err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return nil, err
+	}
+	if err := tempFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Link(tempFile.Name(), filepath.Join(policyDir, getPolicyFileName(result.Revision))); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%w: %s revision %d already exists", ErrRevisionConflict, result.Name, result.Revision)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get 见 PolicyStore
+func (s *FSPolicyStore) Get(name string) (*Policy, error) {
+	policyDir, err := s.getPolicyDir(name)
+	if err != nil {
+		return nil, err
+	}
+	revisionList, err := s.getRevisionList(policyDir)
+	if err != nil {
+		return nil, err
+	}
+	return readPolicyFile(filepath.Join(policyDir, getPolicyFileName(revisionList[len(revisionList)-1])))
+}
+
+// List 见 PolicyStore
+func (s *FSPolicyStore) List() ([]*Policy, error) {
+	entryList, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	policyList := make([]*Policy, 0, len(entryList))
+	for _, entry := range entryList {
+		if !entry.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+		policy, err := s.Get(name)
+		if errors.Is(err, ErrPolicyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		policyList = append(policyList, policy)
+	}
+	sort.Slice(policyList, func(i, j int) bool { return policyList[i].Name < policyList[j].Name })
+	return policyList, nil
+}
+
+// History 见 PolicyStore
+func (s *FSPolicyStore) History(name string) ([]*Policy, error) {
+	policyDir, err := s.getPolicyDir(name)
+	if err != nil {
+		return nil, err
+	}
+	revisionList, err := s.getRevisionList(policyDir)
+	if err != nil {
+		return nil, err
+	}
+	policyList := make([]*Policy, 0, len(revisionList))
+	for _, revision := range revisionList {
+		policy, err := readPolicyFile(filepath.Join(policyDir, getPolicyFileName(revision)))
+		if err != nil {
+			return nil, err
+		}
+		policyList = append(policyList, policy)
+	}
+	return policyList, nil
+}
+
+// Rollback 见 PolicyStore
+func (s *FSPolicyStore) Rollback(name string, revision int64, expectedRevision int64) (*Policy, error) {
+	return rollbackPolicy(s, name, revision, expectedRevision)
+}
+
+func (s *FSPolicyStore) getPolicyDir(name string) (string, error) {
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: invalid name %q", ErrInvalidPolicy, name)
+	}
+	return filepath.Join(s.dir, url.PathEscape(name)), nil
+}
+
+//获取策略目录下所有版本号，升序；没有任何版本时返回 ErrPolicyNotFound
+func (s *FSPolicyStore) getRevisionList(policyDir string) ([]int64, error) {
+	entryList, err := os.ReadDir(policyDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	revisionList := make([]int64, 0, len(entryList))
+	for _, entry := range entryList {
+		if !strings.HasSuffix(entry.Name(), policyFileExt) {
+			continue
+		}
+		revision, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), policyFileExt), 10, 64)
+		if err != nil || revision <= 0 {
+			continue
+		}
+		revisionList = append(revisionList, revision)
+	}
+	if len(revisionList) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, filepath.Base(policyDir))
+	}
+	sort.Slice(revisionList, func(i, j int) bool { return revisionList[i] < revisionList[j] })
+	return revisionList, nil
+}
+
+func getPolicyFileName(revision int64) string {
+	return fmt.Sprintf("%020d%s", revision, policyFileExt)
+}
+
+//编码策略版本文件：元数据 json 长度 | 元数据 json | 位图二进制
+func encodePolicyFile(policy *Policy) ([]byte, error) {
+	meta, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	bitData, err := policy.BitMap.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writeUvarint(&buffer, uint64(len(meta)))
+	buffer.Write(meta)
+	buffer.Write(bitData)
+	return buffer.Bytes(), nil
+}
+
+func readPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return nil, fmt.Errorf("%w: bad policy file %s", ErrInvalidPolicy, path)
+	}
+	policy := &Policy{}
+	decoder := json.NewDecoder(bytes.NewReader(data[n : n+int(length)]))
+	decoder.UseNumber()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("%w: bad policy file %s: %v", ErrInvalidPolicy, path, err)
+	}
+	policy.BitMap = &MDBitMap{}
+	if err := policy.BitMap.UnmarshalBinary(data[n+int(length):]); err != nil {
+		return nil, err
+	}
+	if err := normalizePolicySource(policy); err != nil {
+		return nil, fmt.Errorf("%w: bad policy file %s: %v", ErrInvalidPolicy, path, err)
+	}
+	return policy, nil
+}
+
+//还原 json 反序列化后的条件取值：json.Number 转换为数值，OtherValue 序列化后的 "<other>" 还原为 OtherValue
+//只有位图 schema 中该维度有其他取值槽位、且 "<other>" 不是枚举取值时才还原
+func normalizePolicySource(policy *Policy) error {
+	schema := policy.BitMap.schema
+	for i, rule := range policy.Source {
+		if rule == nil {
+			return fmt.Errorf("rule %d is null", i)
+		}
+		for _, condition := range rule.ConditionList {
+			if condition == nil {
+				return fmt.Errorf("condition of rule %d is null", i)
+			}
+			for j, value := range condition.ValueList {
+				value = normalizeJSONValue(value)
+				if value == (otherValue{}).String() && schema != nil &&
+					schema.hasOtherSlot(condition.Function) && !schema.hasValue(condition.Function, value) {
+					value = OtherValue
+				}
+				condition.ValueList[j] = value
+			}
+		}
+	}
+	return nil
+}
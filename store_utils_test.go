@@ -0,0 +1,120 @@
+package my_utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFSPolicyStoreSource(t *testing.T) {
+	store, err := InitFSPolicyStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := newTestSchema(t)
+	source := []*MDRule{{ConditionList: []*MDCondition{
+		{Function: "country", ValueList: []interface{}{"SG", OtherValue}},
+		{Function: "salary", Operator: OperatorGTE, ValueList: []interface{}{1000}},
+	}}}
+	bitMap, err := CompileMDBitMap(schema, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(&Policy{Name: "hr", Source: source, BitMap: bitMap}, 0); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := store.Get("hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valueList := policy.Source[0].ConditionList[0].ValueList
+	if !reflect.DeepEqual(valueList, []interface{}{"SG", OtherValue}) {
+		t.Fatalf("source value list %#v", valueList)
+	}
+	//读回的源码重新编译结果一致
+	compiledBitMap, err := CompileMDBitMap(schema, policy.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compiledBitMap.EqualMDBitMap(bitMap) || !policy.BitMap.EqualMDBitMap(bitMap) {
+		t.Fatal("policy bitmap mismatch")
+	}
+}
+
+func TestReadPolicyFileNullSource(t *testing.T) {
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range [][]*MDRule{
+		{nil},
+		{{ConditionList: []*MDCondition{nil}}},
+	} {
+		data, err := encodePolicyFile(&Policy{Name: "hr", Source: source, BitMap: bitMap})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), getPolicyFileName(1))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readPolicyFile(path); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("readPolicyFile error %v, want ErrInvalidPolicy", err)
+		}
+	}
+}
+
+//修改 Put、Get 返回的源码或写入后修改入参，不影响 store 中的版本
+func TestMemoryPolicyStoreSourceCopy(t *testing.T) {
+	store := InitMemoryPolicyStore()
+	bitMap := &MDBitMap{}
+	if err := bitMap.InitMDBitMap([]int64{2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	newSource := func() []*MDRule {
+		return []*MDRule{{ConditionList: []*MDCondition{
+			{Function: "country", ValueList: []interface{}{"SG", "MY"}},
+			{Function: "salary", IntervalList: []*Interval{InitInterval(nil, false, nil, false)}},
+		}}}
+	}
+	source := newSource()
+	result, err := store.Put(&Policy{Name: "hr", Source: source, BitMap: bitMap}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate := func(ruleList []*MDRule) {
+		ruleList[0].ConditionList[0].ValueList[0] = "TH"
+		ruleList[0].ConditionList[0].Function = "department"
+		ruleList[0].ConditionList[1].IntervalList[0] = nil
+		ruleList[0].ConditionList = ruleList[0].ConditionList[:1]
+	}
+	mutate(source)
+	mutate(result.Source)
+	policy, err := store.Get("hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate(policy.Source)
+	for _, getPolicyList := range []func() ([]*Policy, error){
+		store.List,
+		func() ([]*Policy, error) { return store.History("hr") },
+	} {
+		policyList, err := getPolicyList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(policyList) != 1 || !reflect.DeepEqual(policyList[0].Source, newSource()) {
+			t.Fatalf("source %#v", policyList[0].Source)
+		}
+		mutate(policyList[0].Source)
+	}
+	policy, err = store.Get("hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy.Source, newSource()) {
+		t.Fatalf("source %#v", policy.Source)
+	}
+}
@@ -0,0 +1,273 @@
+package my_utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrTemplateParameterNotFound 主体缺少模板引用的属性
+var ErrTemplateParameterNotFound = errors.New("md template parameter not found")
+
+// MDPolicyTemplate 带占位符的策略模板，编译一次，按主体（调用方）属性实例化为 MDBitMap
+/**
+ * @Description 规则相对于调用方时（如 "department in [${user.department}]"、"level lt ${user.level}"），
+ * 不需要为每个用户单独编译全部规则：
+ *   编译：不含占位符的规则编译为基础位图；含占位符的规则中，不含占位符的条件预先转换为各维度槽位列表
+ *   实例化：将占位符替换为主体属性，只计算含占位符条件的槽位，与预先计算的槽位求交集后，在基础位图的拷贝上 SetBox
+ *   缓存：实例化结果按模板引用的属性取值缓存，属性相同的主体共用一个位图，缓存策略见 PolicyCache
+ * 占位符为 ValueList 中形如 "${user.department}" 的完整字符串，按 "." 逐层读取主体的 map[string]interface{}；
+ * 属性为切片或数组（任意元素类型）时展开为多个取值；取值只能是 nil、bool、字符串或数值，map、结构体等返回 ErrInvalidCondition；
+ * 数值按 normalizeValue 归一化，整数保持精确，因此 []string{"HR"} 与 []interface{}{"HR"}、int 1 与 float64 1 的实例化结果相同；
+ * 替换后的取值需满足 CompileMDBitMap 的要求，如范围维度比较的取值必须是边界值；
+ * 离散维度的取值不在 schema 中（如新增的部门）或为其他取值槽位的标签 "<other>" 时返回 ErrValueNotFound，不会授予其他取值槽位
+ * 实例化结果被属性相同的主体共享，只读，需要修改时先调用 CopyMDBitMap；模板并发安全
+ * @e.g.
+	规则：[{department in [${user.department}]}, {department in [Public]}]
+	主体：{"user": {"department": "HR"}}
+	实例化结果与规则 [{department in [HR]}, {department in [Public]}] 的编译结果相同
+ **/
+type MDPolicyTemplate struct {
+	schema *MDSchema
+	// 不含占位符的规则编译的位图
+	baseBitMap *MDBitMap
+	ruleList   []*mdTemplateRule
+	// 模板引用的属性路径，升序不重复
+	parameterList []string
+	cache         *PolicyCache
+}
+
+//含占位符的规则
+type mdTemplateRule struct {
+	// 不含占位符的条件对应的各维度槽位列表，nil 表示该维度不做限制
+	box [][]int64
+	// 含占位符的条件
+	conditionList []*MDCondition
+}
+
+// CompileMDPolicyTemplate 将带占位符的规则列表编译为模板，规则格式见 CompileMDBitMap；cacheOption 为实例化结果的缓存配置，可为 nil
+func CompileMDPolicyTemplate(schema *MDSchema, ruleList []*MDRule, cacheOption *PolicyCacheOption) (*MDPolicyTemplate, error) {
+	template := &MDPolicyTemplate{schema: schema, cache: InitPolicyCache(cacheOption)}
+	staticRuleList := make([]*MDRule, 0, len(ruleList))
+	parameterSet := make(map[string]bool)
+	for _, rule := range ruleList {
+		if rule == nil {
+			return nil, fmt.Errorf("%w: rule is null", ErrInvalidCondition)
+		}
+		staticRule := &MDRule{ConditionList: make([]*MDCondition, 0, len(rule.ConditionList))}
+		templateRule := &mdTemplateRule{}
+		for _, condition := range rule.ConditionList {
+			if condition == nil {
+				return nil, fmt.Errorf("%w: condition is null", ErrInvalidCondition)
+			}
+			pathList := getPlaceholderPathList(condition)
+			if len(pathList) == 0 {
+				staticRule.ConditionList = append(staticRule.ConditionList, condition)
+				continue
+			}
+			if _, ok := schema.functionIndexMap[condition.Function]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, condition.Function)
+			}
+			for _, path := range pathList {
+				parameterSet[path] = true
+			}
+			templateRule.conditionList = append(templateRule.conditionList, condition)
+		}
+		if len(templateRule.conditionList) == 0 {
+			staticRuleList = append(staticRuleList, staticRule)
+			continue
+		}
+		box, err := schema.getRuleBox(staticRule)
+		if err != nil {
+			return nil, err
+		}
+		//不含占位符的条件已经不覆盖任何元素，实例化结果与该规则无关
+		if box == nil {
+			continue
+		}
+		templateRule.box = box
+		template.ruleList = append(template.ruleList, templateRule)
+	}
+	baseBitMap, err := CompileMDBitMap(schema, staticRuleList)
+	if err != nil {
+		return nil, err
+	}
+	template.baseBitMap = baseBitMap
+	for path := range parameterSet {
+		template.parameterList = append(template.parameterList, path)
+	}
+	sort.Strings(template.parameterList)
+	return template, nil
+}
+
+// ParameterList 返回模板引用的属性路径，如 ["user.department", "user.level"]
+func (t *MDPolicyTemplate) ParameterList() []string {
+	return append([]string{}, t.parameterList...)
+}
+
+// Instantiate 按主体属性实例化模板，结果只读；属性缺失时返回 ErrTemplateParameterNotFound，属性类型不支持时返回 ErrInvalidCondition，
+// 属性取值不在 schema 中时返回 ErrValueNotFound
+func (t *MDPolicyTemplate) Instantiate(principal map[string]interface{}) (*MDBitMap, error) {
+	parameterMap := make(map[string][]interface{}, len(t.parameterList))
+	//缓存 key 由展开、归一化后的取值生成，与属性的原始类型无关
+	keyList := make([][]interface{}, len(t.parameterList))
+	for i, path := range t.parameterList {
+		value, err := getPrincipalAttribute(principal, path)
+		if err != nil {
+			return nil, err
+		}
+		valueList, err := getParameterValueList(path, value)
+		if err != nil {
+			return nil, err
+		}
+		parameterMap[path], keyList[i] = valueList, valueList
+	}
+	data, err := json.Marshal(keyList)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCondition, err)
+	}
+	sum := sha256.Sum256(data)
+	return t.cache.getOrCreate(hex.EncodeToString(sum[:]), func() (*MDBitMap, error) {
+		return t.instantiate(parameterMap)
+	})
+}
+
+// CacheStats 返回实例化结果的缓存统计
+func (t *MDPolicyTemplate) CacheStats() PolicyCacheStats {
+	return t.cache.Stats()
+}
+
+func (t *MDPolicyTemplate) instantiate(parameterMap map[string][]interface{}) (*MDBitMap, error) {
+	finalMDBitMap := t.baseBitMap.CopyMDBitMap()
+	for _, templateRule := range t.ruleList {
+		box := make([][]int64, len(templateRule.box))
+		copy(box, templateRule.box)
+		empty := false
+		for _, condition := range templateRule.conditionList {
+			resolvedCondition, err := t.schema.resolveCondition(condition, parameterMap)
+			if err != nil {
+				return nil, err
+			}
+			slotList, err := t.schema.getConditionSlotList(resolvedCondition)
+			if err != nil {
+				return nil, err
+			}
+			functionIndex := t.schema.functionIndexMap[condition.Function]
+			if box[functionIndex] != nil {
+				slotList = intersectSlotList(box[functionIndex], slotList)
+			}
+			if len(slotList) == 0 {
+				empty = true
+				break
+			}
+			box[functionIndex] = slotList
+		}
+		if empty {
+			continue
+		}
+		if err := finalMDBitMap.SetBox(box); err != nil {
+			return nil, err
+		}
+	}
+	return finalMDBitMap, nil
+}
+
+//替换条件中的占位符为属性展开后的取值；主体属性不能是其他取值槽位的标签，否则会授予所有未枚举的取值
+func (s *MDSchema) resolveCondition(condition *MDCondition, parameterMap map[string][]interface{}) (*MDCondition, error) {
+	resolvedCondition := *condition
+	resolvedCondition.ValueList = make([]interface{}, 0, len(condition.ValueList))
+	for _, value := range condition.ValueList {
+		path, ok := getPlaceholderPath(value)
+		if !ok {
+			resolvedCondition.ValueList = append(resolvedCondition.ValueList, value)
+			continue
+		}
+		for _, parameter := range parameterMap[path] {
+			if parameter == (otherValue{}).String() && s.hasOtherSlot(condition.Function) {
+				return nil, fmt.Errorf("%w: parameter %s value %v of function %s", ErrValueNotFound, path, parameter, condition.Function)
+			}
+		}
+		resolvedCondition.ValueList = append(resolvedCondition.ValueList, parameterMap[path]...)
+	}
+	return &resolvedCondition, nil
+}
+
+//属性展开为取值列表：切片、数组展开为各元素，其余为单个取值；取值只能是 nil、bool、字符串或数值，数值按 normalizeValue 归一化
+func getParameterValueList(path string, value interface{}) ([]interface{}, error) {
+	reflectValue := reflect.ValueOf(value)
+	if _, ok := value.(json.Number); ok || !reflectValue.IsValid() ||
+		(reflectValue.Kind() != reflect.Slice && reflectValue.Kind() != reflect.Array) {
+		scalar, err := getParameterScalar(path, value)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{scalar}, nil
+	}
+	valueList := make([]interface{}, 0, reflectValue.Len())
+	for i := 0; i < reflectValue.Len(); i++ {
+		scalar, err := getParameterScalar(path, reflectValue.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		valueList = append(valueList, scalar)
+	}
+	return valueList, nil
+}
+
+func getParameterScalar(path string, value interface{}) (interface{}, error) {
+	value = normalizeJSONValue(value)
+	if value == nil {
+		return nil, nil
+	}
+	//自定义的字符串、bool 类型转换为基础类型，与 schema 中的取值一致
+	switch reflectValue := reflect.ValueOf(value); reflectValue.Kind() {
+	case reflect.Bool:
+		return reflectValue.Bool(), nil
+	case reflect.String:
+		return reflectValue.String(), nil
+	}
+	if _, ok := toFloat64(value); ok {
+		return normalizeValue(value), nil
+	}
+	return nil, fmt.Errorf("%w: parameter %s value %v of type %T is not a scalar", ErrInvalidCondition, path, value, value)
+}
+
+//条件中引用的属性路径
+func getPlaceholderPathList(condition *MDCondition) []string {
+	pathList := make([]string, 0)
+	for _, value := range condition.ValueList {
+		if path, ok := getPlaceholderPath(value); ok {
+			pathList = append(pathList, path)
+		}
+	}
+	return pathList
+}
+
+//"${user.department}" 返回 "user.department"
+func getPlaceholderPath(value interface{}) (string, bool) {
+	text, ok := value.(string)
+	if !ok || !strings.HasPrefix(text, "${") || !strings.HasSuffix(text, "}") || len(text) <= 3 {
+		return "", false
+	}
+	return text[2 : len(text)-1], true
+}
+
+//按 "." 逐层读取主体属性
+func getPrincipalAttribute(principal map[string]interface{}, path string) (interface{}, error) {
+	var value interface{} = principal
+	for _, key := range strings.Split(path, ".") {
+		valueMap, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateParameterNotFound, path)
+		}
+		if value, ok = valueMap[key]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateParameterNotFound, path)
+		}
+	}
+	return value, nil
+}
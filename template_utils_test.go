@@ -0,0 +1,124 @@
+package my_utils
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+//规则：[{country in [${user.country}], salary lt ${user.salary}}, {country in [MY], salary gt 5000}]
+func newTestPolicyTemplate(t *testing.T, schema *MDSchema) *MDPolicyTemplate {
+	t.Helper()
+	ruleList := make([]*MDRule, 0)
+	err := json.Unmarshal([]byte(`[
+		{"condition_list":[{"function":"country","value_list":["${user.country}"]},{"function":"salary","operator":"lt","value_list":["${user.salary}"]}]},
+		{"condition_list":[{"function":"country","value_list":["MY"]},{"function":"salary","operator":"gt","value_list":[5000]}]}]`), &ruleList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := CompileMDPolicyTemplate(schema, ruleList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func TestMDPolicyTemplateInstantiate(t *testing.T) {
+	schema := newTestSchema(t)
+	template := newTestPolicyTemplate(t, schema)
+	if parameterList := template.ParameterList(); len(parameterList) != 2 || parameterList[0] != "user.country" || parameterList[1] != "user.salary" {
+		t.Fatalf("ParameterList() = %v", parameterList)
+	}
+	type department string
+	caseList := []struct {
+		name        string
+		country     interface{}
+		salary      interface{}
+		countryList []interface{}
+	}{
+		{"scalar", "SG", 5000, []interface{}{"SG"}},
+		{"json_number", "SG", json.Number("5000"), []interface{}{"SG"}},
+		{"custom_string", department("TH"), 1000.0, []interface{}{"TH"}},
+		{"interface_slice", []interface{}{"SG", "MY"}, 1000, []interface{}{"SG", "MY"}},
+		{"string_slice", []string{"SG", "TH"}, int64(1000), []interface{}{"SG", "TH"}},
+		{"array", [2]string{"MY", "TH"}, 5000, []interface{}{"MY", "TH"}},
+		{"empty_slice", []string{}, 5000, []interface{}{}},
+	}
+	for _, testCase := range caseList {
+		t.Run(testCase.name, func(t *testing.T) {
+			principal := map[string]interface{}{"user": map[string]interface{}{"country": testCase.country, "salary": testCase.salary}}
+			bitMap, err := template.Instantiate(principal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectBitMap, err := CompileMDBitMap(schema, []*MDRule{
+				{ConditionList: []*MDCondition{
+					{Function: "country", ValueList: testCase.countryList},
+					{Function: "salary", Operator: OperatorLT, ValueList: []interface{}{normalizeJSONValue(testCase.salary)}},
+				}},
+				{ConditionList: []*MDCondition{
+					{Function: "country", ValueList: []interface{}{"MY"}},
+					{Function: "salary", Operator: OperatorGT, ValueList: []interface{}{5000}},
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bitMap.EqualMDBitMap(expectBitMap) {
+				t.Fatal("instantiate result mismatch")
+			}
+		})
+	}
+}
+
+func TestMDPolicyTemplateInvalidParameter(t *testing.T) {
+	template := newTestPolicyTemplate(t, newTestSchema(t))
+	caseList := []struct {
+		principal map[string]interface{}
+		err       error
+	}{
+		{map[string]interface{}{"user": map[string]interface{}{"country": "SG"}}, ErrTemplateParameterNotFound},
+		{map[string]interface{}{"user": "SG"}, ErrTemplateParameterNotFound},
+		{map[string]interface{}{}, ErrTemplateParameterNotFound},
+		{map[string]interface{}{"user": map[string]interface{}{"country": map[string]interface{}{"a": "SG"}, "salary": 5000}}, ErrInvalidCondition},
+		{map[string]interface{}{"user": map[string]interface{}{"country": [][]string{{"SG"}}, "salary": 5000}}, ErrInvalidCondition},
+		{map[string]interface{}{"user": map[string]interface{}{"country": struct{ Name string }{"SG"}, "salary": 5000}}, ErrInvalidCondition},
+		//schema 中没有的取值不能授予其他取值槽位
+		{map[string]interface{}{"user": map[string]interface{}{"country": "VN", "salary": 5000}}, ErrValueNotFound},
+		{map[string]interface{}{"user": map[string]interface{}{"country": []string{"SG", "VN"}, "salary": 5000}}, ErrValueNotFound},
+		{map[string]interface{}{"user": map[string]interface{}{"country": "<other>", "salary": 5000}}, ErrValueNotFound},
+		//范围维度比较的取值必须是边界值
+		{map[string]interface{}{"user": map[string]interface{}{"country": "SG", "salary": 3000}}, ErrInvalidCondition},
+	}
+	for _, testCase := range caseList {
+		if _, err := template.Instantiate(testCase.principal); !errors.Is(err, testCase.err) {
+			t.Errorf("Instantiate(%v) error %v, want %v", testCase.principal, err, testCase.err)
+		}
+	}
+}
+
+//属性取值相同的主体共用缓存，与属性的原始类型无关
+func TestMDPolicyTemplateCache(t *testing.T) {
+	template := newTestPolicyTemplate(t, newTestSchema(t))
+	first, err := template.Instantiate(map[string]interface{}{"user": map[string]interface{}{"country": []string{"SG", "MY"}, "salary": 5000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := template.Instantiate(map[string]interface{}{"user": map[string]interface{}{"country": []interface{}{"SG", "MY"}, "salary": 5000.0, "name": "bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("principals with the same attributes should share the cached bitmap")
+	}
+	third, err := template.Instantiate(map[string]interface{}{"user": map[string]interface{}{"country": "SG", "salary": 5000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first || third.EqualMDBitMap(first) {
+		t.Fatal("different attributes should not share the cached bitmap")
+	}
+	if stats := template.CacheStats(); stats.HitCount != 1 || stats.MissCount != 2 || stats.EntryNum != 2 {
+		t.Fatalf("CacheStats() = %+v", stats)
+	}
+}